@@ -2,17 +2,28 @@ package main
 
 import (
 	"context"
+	"os"
 	"os/signal"
 	"syscall"
 
 	"github.com/frangi01/bbtelgo/internal/app"
 	"github.com/frangi01/bbtelgo/internal/config"
 	"github.com/frangi01/bbtelgo/internal/db"
+	"github.com/frangi01/bbtelgo/internal/handlers"
 	"github.com/frangi01/bbtelgo/internal/i18n"
 	"github.com/frangi01/bbtelgo/internal/logx"
+	"github.com/frangi01/bbtelgo/internal/migrations"
+	"github.com/frangi01/bbtelgo/internal/session"
 )
 
 func main() {
+	// deferred first, so it runs after every other deferred cleanup
+	exitCode := 0
+	defer func() {
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
+	}()
 
 	logger, err := logx.New("logs/bot.log", logx.Options{
 		Level:      logx.Debug, 		// minimum level to print
@@ -41,24 +52,46 @@ func main() {
 	}
 	defer dbclient.Disconnect(ctx)
 
-	repositoryList, err := db.NewRepositoryList(config.MongoCfg, dbclient, logger)
-	if err != nil {
-		logger.Errorf("mongo listrepo: %v", err)
-		return
-	}
-
 	cacheClient, err := db.NewCacheClient(ctx, config.RedisCfg)
 	if err != nil {
 		logger.Warnf("redis connect: %v", err)
 	}
 	defer cacheClient.Close()
 
+	migrator := migrations.NewRunner(dbclient.Database(config.MongoCfg.DB), cacheClient, logger, migrations.All()...)
+
+	// bbtelgo migrate up|down|status
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrate(ctx, migrator, os.Args[2:], os.Stdout); err != nil {
+			logger.Errorf("migrate: %v", err)
+			exitCode = 1
+		}
+		return
+	}
+
+	// before the repositories: they rely on the indexes created by the migrations
+	if _, err := migrator.Up(ctx); err != nil {
+		logger.Errorf("mongo migrate: %v", err)
+		return
+	}
+
+	repositoryList := db.NewRepositoryList(config.MongoCfg, dbclient, logger)
+
 	i18nBundle, err := i18n.Load("internal/i18n/locales", "en")
 	if err != nil {
 		logger.Errorf("i18n load: %v", err)
 	}
 
-	app, err := app.New(logger, config, dbclient, repositoryList, cacheClient, i18nBundle)
+	// register handlers for other update types here (OnEditedMessage, OnInlineQuery, ...)
+	// and a custom error handler with dispatcher.OnError
+	dispatcher := handlers.NewDispatcher()
+
+	app, err := app.New(logger, config, dbclient, repositoryList, cacheClient, i18nBundle, dispatcher,
+		session.Middleware(cacheClient, logger, session.Options{
+			TTL:   config.RedisCfg.SessionTTL,
+			Scope: session.Scope(config.RedisCfg.SessionScope),
+		}),
+	)
 	if err != nil {
 		logger.Errorf("bot - new")
 		return
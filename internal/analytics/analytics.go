@@ -0,0 +1,320 @@
+package analytics
+
+import (
+	"context"
+	"time"
+
+	"github.com/frangi01/bbtelgo/internal/entities"
+	"github.com/frangi01/bbtelgo/internal/repo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	day  = 24 * time.Hour
+	week = 7 * day
+
+	dayLayout = "2006-01-02"
+
+	// MaxDays bounds the period of a Report
+	MaxDays = 365
+)
+
+// Service computes usage statistics with aggregation pipelines over the users and
+// messages collections (Mongo only). Activity is read from the stored incoming messages,
+// so it needs APP_PERSIST_MESSAGES; soft-deleted users are left out. Days are UTC.
+type Service struct {
+	users    *mongo.Collection
+	messages *mongo.Collection
+}
+
+func New(client *mongo.Client, dbName string) *Service {
+	database := client.Database(dbName)
+	return &Service{
+		users:    database.Collection(repo.UserCollection),
+		messages: database.Collection(repo.MessageCollection),
+	}
+}
+
+// Active counts the distinct users who wrote to the bot in the last day, week and 30 days.
+type Active struct {
+	DAU int64 `bson:"dau"`
+	WAU int64 `bson:"wau"`
+	MAU int64 `bson:"mau"`
+}
+
+// DayCount is the value of a metric on one day.
+type DayCount struct {
+	Day   time.Time
+	Count int64
+}
+
+// KeyCount is the value of a metric for one key (a command, a language...).
+type KeyCount struct {
+	Key   string `bson:"_id"`
+	Count int64  `bson:"n"`
+}
+
+// Cohort groups the users who joined in the week starting at Week: Active[k] is how
+// many of them wrote to the bot k weeks later (Active[0] = the week they joined).
+type Cohort struct {
+	Week   time.Time
+	Size   int64
+	Active []int64
+}
+
+// incoming matches the messages sent to the bot by users in [from, to); the anonymized
+// ones (GDPR erasure, sender ID 0) are left out.
+func incoming(from, to time.Time) bson.M {
+	return bson.M{
+		"direction":  entities.DirectionIn,
+		"from.id":    bson.M{"$gt": 0},
+		"from.isbot": bson.M{"$ne": true},
+		"date":       bson.M{"$gte": from.Unix(), "$lt": to.Unix()},
+	}
+}
+
+// liveUsers matches the users not soft-deleted, plus cond.
+func liveUsers(cond bson.M) bson.M {
+	cond["deletedAt"] = bson.M{"$exists": false}
+	return cond
+}
+
+// dayOf is the "YYYY-MM-DD" (UTC) of a unix-seconds field (models.Message.Date).
+func dayOf(field string) bson.M {
+	return bson.M{"$dateToString": bson.M{
+		"format": "%Y-%m-%d",
+		"date":   bson.M{"$toDate": bson.M{"$multiply": bson.A{bson.M{"$toLong": field}, 1000}}},
+	}}
+}
+
+// ActiveUsers returns DAU, WAU and MAU at "at".
+func (s *Service) ActiveUsers(ctx context.Context, at time.Time) (Active, error) {
+	var out Active
+	sinceCond := func(d time.Duration) bson.M {
+		return bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$gte": bson.A{"$last", at.Add(-d).Unix()}}, 1, 0}}}
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: incoming(at.Add(-30*day), at)}},
+		{{Key: "$group", Value: bson.M{"_id": "$from.id", "last": bson.M{"$max": "$date"}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id": nil,
+			"mau": bson.M{"$sum": 1},
+			"wau": sinceCond(week),
+			"dau": sinceCond(day),
+		}}},
+	}
+	rows, err := aggregate[Active](ctx, s.messages, pipeline)
+	if len(rows) > 0 {
+		out = rows[0]
+	}
+	return out, err
+}
+
+// DailyActive returns the distinct active users of each day in [from, to).
+func (s *Service) DailyActive(ctx context.Context, from, to time.Time) ([]DayCount, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: incoming(from, to)}},
+		{{Key: "$group", Value: bson.M{"_id": bson.M{"d": dayOf("$date"), "u": "$from.id"}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$_id.d", "n": bson.M{"$sum": 1}}}},
+	}
+	rows, err := aggregate[KeyCount](ctx, s.messages, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	return byDay(rows, from, to), nil
+}
+
+// NewUsers returns the users created on each day in [from, to).
+func (s *Service) NewUsers(ctx context.Context, from, to time.Time) ([]DayCount, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: liveUsers(bson.M{"createdAt": bson.M{"$gte": from, "$lt": to}})}},
+		{{Key: "$group", Value: bson.M{
+			"_id": bson.M{"$dateToString": bson.M{"format": "%Y-%m-%d", "date": "$createdAt"}},
+			"n":   bson.M{"$sum": 1},
+		}}},
+	}
+	rows, err := aggregate[KeyCount](ctx, s.users, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	return byDay(rows, from, to), nil
+}
+
+// Cohorts returns the weekly retention of the users created from the week of since to at.
+func (s *Service) Cohorts(ctx context.Context, since, at time.Time) ([]Cohort, error) {
+	since = weekStart(since)
+	weeks := int((at.Sub(since) + week - 1) / week)
+	if weeks <= 0 {
+		return nil, nil
+	}
+	weekIndex := func(elapsed any) bson.M {
+		return bson.M{"$floor": bson.M{"$divide": bson.A{elapsed, week.Milliseconds()}}}
+	}
+
+	sizes, err := aggregate[struct {
+		Cohort int64 `bson:"_id"`
+		N      int64 `bson:"n"`
+	}](ctx, s.users, mongo.Pipeline{
+		{{Key: "$match", Value: liveUsers(bson.M{"createdAt": bson.M{"$gte": since, "$lt": at}})}},
+		{{Key: "$group", Value: bson.M{
+			"_id": weekIndex(bson.M{"$subtract": bson.A{"$createdAt", since}}),
+			"n":   bson.M{"$sum": 1},
+		}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// (user, week of activity) pairs, joined with the signup week of the user
+	active, err := aggregate[struct {
+		Key struct {
+			Cohort int64 `bson:"c"`
+			Offset int64 `bson:"o"`
+		} `bson:"_id"`
+		N int64 `bson:"n"`
+	}](ctx, s.messages, mongo.Pipeline{
+		{{Key: "$match", Value: incoming(since, at)}},
+		{{Key: "$group", Value: bson.M{"_id": bson.M{
+			"u": "$from.id",
+			"w": weekIndex(bson.M{"$multiply": bson.A{bson.M{"$subtract": bson.A{bson.M{"$toLong": "$date"}, since.Unix()}}, 1000}}),
+		}}}},
+		{{Key: "$lookup", Value: bson.M{"from": repo.UserCollection, "localField": "_id.u", "foreignField": "id", "as": "user"}}},
+		{{Key: "$unwind", Value: "$user"}},
+		{{Key: "$match", Value: bson.M{"user.createdAt": bson.M{"$gte": since}, "user.deletedAt": bson.M{"$exists": false}}}},
+		{{Key: "$project", Value: bson.M{
+			"c": weekIndex(bson.M{"$subtract": bson.A{"$user.createdAt", since}}),
+			"w": "$_id.w",
+		}}},
+		{{Key: "$group", Value: bson.M{
+			"_id": bson.M{"c": "$c", "o": bson.M{"$subtract": bson.A{"$w", "$c"}}},
+			"n":   bson.M{"$sum": 1},
+		}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	cohorts := make([]Cohort, weeks)
+	for i := range cohorts {
+		cohorts[i] = Cohort{Week: since.Add(time.Duration(i) * week), Active: make([]int64, weeks-i)}
+	}
+	for _, row := range sizes {
+		if row.Cohort >= 0 && row.Cohort < int64(weeks) {
+			cohorts[row.Cohort].Size = row.N
+		}
+	}
+	for _, row := range active {
+		c, o := row.Key.Cohort, row.Key.Offset
+		if c >= 0 && c < int64(weeks) && o >= 0 && o < int64(len(cohorts[c].Active)) {
+			cohorts[c].Active[o] = row.N
+		}
+	}
+	return cohorts, nil
+}
+
+// CommandUsage returns the commands sent to the bot in [from, to), most used first
+// (at most limit; 0 = all).
+func (s *Service) CommandUsage(ctx context.Context, from, to time.Time, limit int64) ([]KeyCount, error) {
+	match := incoming(from, to)
+	match["text"] = bson.M{"$regex": "^/"}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$project", Value: bson.M{"cmd": bson.M{"$toLower": bson.M{"$let": bson.M{
+			"vars": bson.M{"m": bson.M{"$regexFind": bson.M{"input": "$text", "regex": "^/[A-Za-z0-9_]+"}}},
+			"in":   "$$m.match",
+		}}}}}},
+		{{Key: "$match", Value: bson.M{"cmd": bson.M{"$ne": ""}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$cmd", "n": bson.M{"$sum": 1}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "n", Value: -1}, {Key: "_id", Value: 1}}}},
+	}
+	if limit > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$limit", Value: limit}})
+	}
+	return aggregate[KeyCount](ctx, s.messages, pipeline)
+}
+
+// Languages returns the users per Telegram language (models.User.LanguageCode, ""
+// when unknown), most common first.
+func (s *Service) Languages(ctx context.Context) ([]KeyCount, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: liveUsers(bson.M{})}},
+		{{Key: "$group", Value: bson.M{"_id": bson.M{"$ifNull": bson.A{"$languagecode", ""}}, "n": bson.M{"$sum": 1}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "n", Value: -1}, {Key: "_id", Value: 1}}}},
+	}
+	return aggregate[KeyCount](ctx, s.users, pipeline)
+}
+
+// Report gathers every statistic of the last days (today included).
+type Report struct {
+	GeneratedAt time.Time
+	From        time.Time // first day
+	To          time.Time // end (exclusive)
+	Active      Active
+	DailyActive []DayCount
+	NewUsers    []DayCount
+	Cohorts     []Cohort
+	Commands    []KeyCount
+	Languages   []KeyCount
+}
+
+func (s *Service) Report(ctx context.Context, days int) (*Report, error) {
+	days = min(max(days, 1), MaxDays)
+	now := time.Now().UTC()
+	r := &Report{GeneratedAt: now, To: now}
+	r.From = now.Truncate(day).Add(-time.Duration(days-1) * day)
+
+	var err error
+	if r.Active, err = s.ActiveUsers(ctx, now); err != nil {
+		return nil, err
+	}
+	if r.DailyActive, err = s.DailyActive(ctx, r.From, r.To); err != nil {
+		return nil, err
+	}
+	if r.NewUsers, err = s.NewUsers(ctx, r.From, r.To); err != nil {
+		return nil, err
+	}
+	if r.Cohorts, err = s.Cohorts(ctx, r.From, r.To); err != nil {
+		return nil, err
+	}
+	if r.Commands, err = s.CommandUsage(ctx, r.From, r.To, 0); err != nil {
+		return nil, err
+	}
+	if r.Languages, err = s.Languages(ctx); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func aggregate[T any](ctx context.Context, col *mongo.Collection, pipeline mongo.Pipeline) ([]T, error) {
+	cur, err := col.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var out []T
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// byDay spreads the "YYYY-MM-DD" rows over every day of [from, to), zero when missing.
+func byDay(rows []KeyCount, from, to time.Time) []DayCount {
+	counts := make(map[string]int64, len(rows))
+	for _, r := range rows {
+		counts[r.Key] = r.Count
+	}
+	var out []DayCount
+	for d := from.UTC().Truncate(day); d.Before(to); d = d.Add(day) {
+		out = append(out, DayCount{Day: d, Count: counts[d.Format(dayLayout)]})
+	}
+	return out
+}
+
+// weekStart is the Monday 00:00 UTC of the week of t.
+func weekStart(t time.Time) time.Time {
+	t = t.UTC().Truncate(day)
+	return t.Add(-time.Duration((int(t.Weekday())+6)%7) * day)
+}
@@ -0,0 +1,51 @@
+package analytics
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// WriteCSV writes r in long format, one value per row: metric,date,key,value.
+//
+//	active,<to>,dau|wau|mau,N
+//	daily_active,<day>,,N
+//	new_users,<day>,,N
+//	cohort,<week>,size|week_<k>,N
+//	command,,/start,N
+//	language,,en,N
+func WriteCSV(w io.Writer, r *Report) error {
+	cw := csv.NewWriter(w)
+	row := func(metric, date, key string, value int64) {
+		_ = cw.Write([]string{metric, date, key, strconv.FormatInt(value, 10)})
+	}
+
+	_ = cw.Write([]string{"metric", "date", "key", "value"})
+	to := r.To.Format(dayLayout)
+	row("active", to, "dau", r.Active.DAU)
+	row("active", to, "wau", r.Active.WAU)
+	row("active", to, "mau", r.Active.MAU)
+	for _, d := range r.DailyActive {
+		row("daily_active", d.Day.Format(dayLayout), "", d.Count)
+	}
+	for _, d := range r.NewUsers {
+		row("new_users", d.Day.Format(dayLayout), "", d.Count)
+	}
+	for _, c := range r.Cohorts {
+		date := c.Week.Format(dayLayout)
+		row("cohort", date, "size", c.Size)
+		for k, n := range c.Active {
+			row("cohort", date, fmt.Sprintf("week_%d", k), n)
+		}
+	}
+	for _, c := range r.Commands {
+		row("command", "", c.Key, c.Count)
+	}
+	for _, l := range r.Languages {
+		row("language", "", l.Key, l.Count)
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
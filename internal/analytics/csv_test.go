@@ -0,0 +1,42 @@
+package analytics
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteCSV(t *testing.T) {
+	day := time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC)
+	r := &Report{
+		To:          day.AddDate(0, 0, 1),
+		Active:      Active{DAU: 1, WAU: 2, MAU: 3},
+		DailyActive: []DayCount{{Day: day, Count: 4}},
+		NewUsers:    []DayCount{{Day: day, Count: 5}},
+		Cohorts:     []Cohort{{Week: day, Size: 6, Active: []int64{6, 1}}},
+		Commands:    []KeyCount{{Key: "/start", Count: 7}},
+		Languages:   []KeyCount{{Key: "en", Count: 8}, {Key: "", Count: 9}},
+	}
+
+	var sb strings.Builder
+	if err := WriteCSV(&sb, r); err != nil {
+		t.Fatalf("WriteCSV: %v", err)
+	}
+	want := strings.Join([]string{
+		"metric,date,key,value",
+		"active,2026-01-06,dau,1",
+		"active,2026-01-06,wau,2",
+		"active,2026-01-06,mau,3",
+		"daily_active,2026-01-05,,4",
+		"new_users,2026-01-05,,5",
+		"cohort,2026-01-05,size,6",
+		"cohort,2026-01-05,week_0,6",
+		"cohort,2026-01-05,week_1,1",
+		"command,,/start,7",
+		"language,,en,8",
+		"language,,,9",
+	}, "\n") + "\n"
+	if got := sb.String(); got != want {
+		t.Fatalf("csv =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -2,9 +2,11 @@ package app
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"time"
 
+	"github.com/frangi01/bbtelgo/internal/commands"
 	"github.com/frangi01/bbtelgo/internal/config"
 	"github.com/frangi01/bbtelgo/internal/db"
 	"github.com/frangi01/bbtelgo/internal/handlers"
@@ -16,18 +18,34 @@ import (
 	tgbot "github.com/go-telegram/bot"
 )
 
+// getMeTimeout bounds the getMe of the startup (the default of the bot library)
+const getMeTimeout = 5 * time.Second
+
 type App struct {
 	logger 		*logx.Logger
 	config 		config.Config
 	bot	 		*tgbot.Bot
+	allowedUpdates	[]string
+	i18n			*i18n.Bundle
+	commands		*commands.Registry
+	deps			*utils.HandlerDeps
 }
 
-func New(logger *logx.Logger, cfg config.Config, dbclient *mongo.Client, repositoryList *db.RepositoryList, cache *db.CacheClient, i18nBundle *i18n.Bundle) (*App, error) {
+// New builds the bot; middlewares run after the built-in ones, in the given order.
+// Handlers must be registered on dispatcher (nil = built-in routes only) before calling New,
+// since its update types become the allowed_updates of the bot.
+func New(logger *logx.Logger, cfg config.Config, dbclient *mongo.Client, repositoryList *db.RepositoryList, cache *db.CacheClient, i18nBundle *i18n.Bundle, dispatcher *handlers.Dispatcher, middlewares ...handlers.Middleware) (*App, error) {
+	if dispatcher == nil {
+		dispatcher = handlers.NewDispatcher()
+	}
 	deps := utils.NewDeps(logger, cfg, repositoryList, cache, i18nBundle)
-	h := handlers.Handler(deps)
+	h := handlers.Handler(deps, dispatcher, middlewares...)
+	allowedUpdates := dispatcher.AllowedUpdates()
 	
 	opts := []tgbot.Option{
 		tgbot.WithDefaultHandler(h),
+		tgbot.WithAllowedUpdates(allowedUpdates),
+		tgbot.WithSkipGetMe(), // called below, to keep the bot username
 	}
 
 	httpClient := &http.Client{
@@ -44,14 +62,34 @@ func New(logger *logx.Logger, cfg config.Config, dbclient *mongo.Client, reposit
 	}
 
 	botx, err := tgbot.New(cfg.Token, opts...)
+	if err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), getMeTimeout)
+		me, meErr := botx.GetMe(ctx)
+		cancel()
+		if meErr != nil {
+			err = fmt.Errorf("error call getMe, %w", meErr)
+		} else {
+			deps.SetBotUsername(me.Username)
+		}
+	}
 	if err != nil {
 		logger.Errorf("Error init bot %s", err)
 	}
 
-	return &App{logger: logger, config: cfg, bot: botx}, err
+	return &App{
+		logger: logger,
+		config: cfg,
+		bot: botx,
+		allowedUpdates: allowedUpdates,
+		i18n: i18nBundle,
+		commands: handlers.Commands(),
+		deps: deps,
+	}, err
 }
 
 func (app *App) Run(context context.Context) {
+	defer app.deps.Sender.Close()
+
 	if app.config.ResetWebHook {
 		deleteWebhookResult, err := app.bot.DeleteWebhook(
 			context,
@@ -64,6 +102,22 @@ func (app *App) Run(context context.Context) {
 			app.logger.Debugf("DeleteWebhook error: %v", err)
 		}
 	}
+	// keep the Telegram command menu aligned with the route tables
+	if app.i18n != nil {
+		if err := app.commands.Sync(context, app.bot, app.i18n, app.logger); err != nil {
+			app.logger.Errorf("setMyCommands: %v", err)
+		}
+	}
+
+	// campaigns are sent in the background, throttled by the shared sender
+	if app.deps.Broadcast != nil {
+		go app.deps.Broadcast.Run(context, app.bot)
+	}
+	// old messages are deleted (and archived) according to APP_RETENTION
+	if app.deps.Retention != nil {
+		go app.deps.Retention.Run(context)
+	}
+
 	switch app.config.Mode {
 		case "polling":
 			app.bot.Start(context)
@@ -75,6 +129,7 @@ func (app *App) Run(context context.Context) {
 			setWebHookResult, err := app.bot.SetWebhook(context, &tgbot.SetWebhookParams{
 				URL: app.config.WebHookPublicUrl,
 				SecretToken: app.config.WebHookSecret,
+				AllowedUpdates: app.allowedUpdates,
 			})
 
 			app.logger.Debugf("SetWebHook result: %v", setWebHookResult)
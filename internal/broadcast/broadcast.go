@@ -0,0 +1,362 @@
+package broadcast
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/frangi01/bbtelgo/internal/db"
+	"github.com/frangi01/bbtelgo/internal/entities"
+	"github.com/frangi01/bbtelgo/internal/logx"
+	"github.com/frangi01/bbtelgo/internal/repo"
+	"github.com/frangi01/bbtelgo/internal/sender"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	DefaultInterval  = 5 * time.Second
+	DefaultBatchSize = 100
+	DefaultWorkers   = 8
+	DefaultLockTTL   = 2 * time.Minute
+
+	// claimTTL: a delivery claimed longer ago was left by a worker that died while
+	// sending, so it is queued again
+	claimTTL = 15 * time.Minute
+
+	queueChunk = 1000 // deliveries inserted at once by Start
+
+	maxTextLen    = 4096
+	maxCaptionLen = 1024
+)
+
+var (
+	ErrEmpty   = errors.New("broadcast: campaign without text or photo")
+	ErrTooLong = errors.New("broadcast: campaign text too long")
+)
+
+type Options struct {
+	Interval  time.Duration // how often running campaigns are polled
+	BatchSize int64         // deliveries processed per lock
+	Workers   int           // concurrent sends (the sender still enforces the flood limits)
+	LockTTL   time.Duration // per-campaign lock, so replicas do not work on the same batch (deliveries are also claimed one by one)
+}
+
+// Service manages the campaigns and fans them out in the low priority lane of the sender.
+type Service struct {
+	campaigns  *repo.CampaignRepository
+	deliveries *repo.DeliveryRepository
+	users      repo.UserStore
+	cache      *db.CacheClient
+	sender     *sender.Sender
+	logger     *logx.Logger
+	opts       Options
+	instance   string
+}
+
+// New: cache is optional (without it a single worker instance is assumed).
+func New(campaigns *repo.CampaignRepository, deliveries *repo.DeliveryRepository, users repo.UserStore, cache *db.CacheClient, s *sender.Sender, logger *logx.Logger, opts Options) *Service {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultInterval
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = DefaultWorkers
+	}
+	if opts.LockTTL <= 0 {
+		opts.LockTTL = DefaultLockTTL
+	}
+	buf := make([]byte, 8)
+	_, _ = rand.Read(buf)
+
+	return &Service{
+		campaigns:  campaigns,
+		deliveries: deliveries,
+		users:      users,
+		cache:      cache,
+		sender:     s,
+		logger:     logger,
+		opts:       opts,
+		instance:   hex.EncodeToString(buf),
+	}
+}
+
+// Create stores a draft campaign; call Start to send it.
+func (s *Service) Create(ctx context.Context, c *entities.CampaignEntity) (primitive.ObjectID, error) {
+	if c.Text == "" && c.PhotoFileID == "" {
+		return primitive.NilObjectID, ErrEmpty
+	}
+	limit := maxTextLen
+	if c.PhotoFileID != "" {
+		limit = maxCaptionLen
+	}
+	if utf8.RuneCountInString(c.Text) > limit {
+		return primitive.NilObjectID, ErrTooLong
+	}
+	return s.campaigns.Create(ctx, c)
+}
+
+// Get returns the campaign with its counters.
+func (s *Service) Get(ctx context.Context, id primitive.ObjectID) (*entities.CampaignEntity, error) {
+	return s.campaigns.FindByObjectID(ctx, id)
+}
+
+// Start queues a delivery for every user matching the filter and hands the campaign to the worker.
+func (s *Service) Start(ctx context.Context, id primitive.ObjectID) error {
+	c, err := s.campaigns.FindByObjectID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if c.Status != entities.CampaignDraft {
+		return repo.CampaignErrTransition
+	}
+
+	// streamed in chunks; idempotent, so a failed Start can be repeated
+	userIDs := make([]int64, 0, queueChunk)
+	err = s.users.Iterate(ctx, c.Filter, func(u *entities.UserEntity) error {
+		userIDs = append(userIDs, u.ID)
+		if len(userIDs) < queueChunk {
+			return nil
+		}
+		_, err := s.deliveries.InsertPending(ctx, id, userIDs)
+		userIDs = userIDs[:0]
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := s.deliveries.InsertPending(ctx, id, userIDs); err != nil {
+		return err
+	}
+	counts, err := s.deliveries.CountByStatus(ctx, id)
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, n := range counts {
+		total += n
+	}
+
+	return s.campaigns.Transition(ctx, id, []entities.CampaignStatus{entities.CampaignDraft}, entities.CampaignRunning, bson.M{
+		"stats.total": total,
+		"startedAt":   time.Now().UTC(),
+	})
+}
+
+// Pause stops the worker after the batch in progress.
+func (s *Service) Pause(ctx context.Context, id primitive.ObjectID) error {
+	return s.campaigns.Transition(ctx, id, []entities.CampaignStatus{entities.CampaignRunning}, entities.CampaignPaused, nil)
+}
+
+func (s *Service) Resume(ctx context.Context, id primitive.ObjectID) error {
+	return s.campaigns.Transition(ctx, id, []entities.CampaignStatus{entities.CampaignPaused}, entities.CampaignRunning, nil)
+}
+
+// Cancel ends the campaign for good: pending deliveries are never sent.
+func (s *Service) Cancel(ctx context.Context, id primitive.ObjectID) error {
+	from := []entities.CampaignStatus{entities.CampaignDraft, entities.CampaignRunning, entities.CampaignPaused}
+	return s.campaigns.Transition(ctx, id, from, entities.CampaignCancelled, bson.M{"finishedAt": time.Now().UTC()})
+}
+
+// Run polls the running campaigns until ctx is done.
+func (s *Service) Run(ctx context.Context, b *bot.Bot) {
+	ticker := time.NewTicker(s.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		s.tick(ctx, b)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Service) tick(ctx context.Context, b *bot.Bot) {
+	running, err := s.campaigns.ListByStatus(ctx, entities.CampaignRunning)
+	if err != nil {
+		if ctx.Err() == nil {
+			s.logger.Errorf("broadcast: list campaigns: %v", err)
+		}
+		return
+	}
+	for i := range running {
+		if err := s.process(ctx, b, running[i].MongoID); err != nil && ctx.Err() == nil {
+			s.logger.Errorf("broadcast: campaign %s: %v", running[i].MongoID.Hex(), err)
+		}
+	}
+}
+
+// process sends batches of the campaign until it is drained, paused or cancelled.
+func (s *Service) process(ctx context.Context, b *bot.Bot, id primitive.ObjectID) error {
+	for ctx.Err() == nil {
+		done, err := s.batch(ctx, b, id)
+		if err != nil || done {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+func (s *Service) batch(ctx context.Context, b *bot.Bot, id primitive.ObjectID) (done bool, err error) {
+	lockKey := "broadcast:lock:" + id.Hex()
+	if s.cache != nil {
+		ok, err := s.cache.AcquireLock(ctx, lockKey, s.instance, s.opts.LockTTL)
+		if err != nil {
+			return true, err
+		}
+		if !ok {
+			// another replica is on it
+			return true, nil
+		}
+		defer func() {
+			if _, err := s.cache.ReleaseLock(context.Background(), lockKey, s.instance); err != nil {
+				s.logger.Warnf("broadcast: release lock %s: %v", lockKey, err)
+			}
+		}()
+	}
+
+	// re-read every batch so pause/cancel take effect quickly
+	c, err := s.campaigns.FindByObjectID(ctx, id)
+	if err != nil {
+		return true, err
+	}
+	if c.Status != entities.CampaignRunning {
+		return true, nil
+	}
+
+	if n, err := s.deliveries.ReleaseStale(ctx, id, time.Now().UTC().Add(-claimTTL)); err != nil {
+		return true, err
+	} else if n > 0 {
+		s.logger.Warnf("broadcast: campaign %s: %d stale deliveries queued again", id.Hex(), n)
+	}
+	pending, err := s.deliveries.Pending(ctx, id, s.opts.BatchSize)
+	if err != nil {
+		return true, err
+	}
+	if len(pending) == 0 {
+		// deliveries still being sent by another worker: complete on a later tick
+		sending, err := s.deliveries.Count(ctx, id, entities.DeliverySending)
+		if err != nil || sending > 0 {
+			return true, err
+		}
+		err = s.campaigns.Transition(ctx, id, []entities.CampaignStatus{entities.CampaignRunning}, entities.CampaignCompleted, bson.M{"finishedAt": time.Now().UTC()})
+		if err == nil {
+			s.logger.Infof("broadcast: campaign %s completed (sent %d, blocked %d, failed %d of %d)",
+				id.Hex(), c.Stats.Sent, c.Stats.Blocked, c.Stats.Failed, c.Stats.Total)
+		}
+		return true, err
+	}
+
+	var (
+		mu    sync.Mutex
+		delta entities.CampaignStats
+		wg    sync.WaitGroup
+		slots = make(chan struct{}, s.opts.Workers)
+	)
+	for i := range pending {
+		d := &pending[i]
+		slots <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() { <-slots; wg.Done() }()
+
+			status, ok := s.deliver(ctx, b, c, d)
+			if !ok {
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			switch status {
+			case entities.DeliverySent:
+				delta.Sent++
+			case entities.DeliveryBlocked:
+				delta.Blocked++
+			case entities.DeliveryFailed:
+				delta.Failed++
+			}
+		}()
+	}
+	wg.Wait()
+
+	// counters are best effort: the deliveries are the source of truth
+	if err := s.campaigns.IncStats(context.Background(), id, delta); err != nil {
+		s.logger.Errorf("broadcast: update stats %s: %v", id.Hex(), err)
+	}
+	return false, ctx.Err()
+}
+
+// deliver claims the delivery, sends the campaign to the user and records the outcome.
+// ok=false means the delivery stays pending (shutdown) or was taken by someone else.
+func (s *Service) deliver(ctx context.Context, b *bot.Bot, c *entities.CampaignEntity, d *entities.DeliveryEntity) (entities.DeliveryStatus, bool) {
+	claimed, err := s.deliveries.Claim(ctx, d.MongoID)
+	if err != nil || !claimed {
+		if err != nil && ctx.Err() == nil {
+			s.logger.Errorf("broadcast: claim delivery %s: %v", d.MongoID.Hex(), err)
+		}
+		return "", false
+	}
+
+	msg, err := s.send(ctx, b, c, d.UserID)
+	if err != nil && ctx.Err() != nil {
+		if _, err := s.deliveries.Release(context.Background(), d.MongoID); err != nil {
+			s.logger.Errorf("broadcast: release delivery %s: %v", d.MongoID.Hex(), err)
+		}
+		return "", false
+	}
+
+	status, messageID, errMsg := entities.DeliverySent, 0, ""
+	switch {
+	case err == nil:
+		if msg != nil {
+			messageID = msg.ID
+		}
+	case errors.Is(err, bot.ErrorForbidden):
+		status, errMsg = entities.DeliveryBlocked, err.Error()
+		if err := s.users.SetBlocked(ctx, d.UserID, true); err != nil && !errors.Is(err, repo.UserErrNotFound) {
+			s.logger.Errorf("broadcast: mark user %d blocked: %v", d.UserID, err)
+		}
+	default:
+		status, errMsg = entities.DeliveryFailed, err.Error()
+	}
+
+	updated, err := s.deliveries.Complete(context.Background(), d.MongoID, status, messageID, errMsg)
+	if err != nil {
+		s.logger.Errorf("broadcast: record delivery %s: %v", d.MongoID.Hex(), err)
+		return "", false
+	}
+	return status, updated
+}
+
+func (s *Service) send(ctx context.Context, b *bot.Bot, c *entities.CampaignEntity, chatID int64) (*models.Message, error) {
+	// a nil *InlineKeyboardMarkup in the interface would be sent as "null"
+	var markup models.ReplyMarkup
+	if c.Keyboard != nil {
+		markup = c.Keyboard
+	}
+
+	if c.PhotoFileID != "" {
+		return s.sender.SendPhotoWithPriority(ctx, b, &bot.SendPhotoParams{
+			ChatID:      chatID,
+			Photo:       &models.InputFileString{Data: c.PhotoFileID},
+			Caption:     c.Text,
+			ParseMode:   c.ParseMode,
+			ReplyMarkup: markup,
+		}, sender.PriorityLow)
+	}
+	return s.sender.SendMessageWithPriority(ctx, b, &bot.SendMessageParams{
+		ChatID:      chatID,
+		Text:        c.Text,
+		ParseMode:   c.ParseMode,
+		ReplyMarkup: markup,
+	}, sender.PriorityLow)
+}
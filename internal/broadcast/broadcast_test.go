@@ -0,0 +1,42 @@
+package broadcast
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/frangi01/bbtelgo/internal/entities"
+)
+
+func TestCreateValidates(t *testing.T) {
+	// the validation runs before the repository is touched
+	s := New(nil, nil, nil, nil, nil, nil, Options{})
+
+	tests := []struct {
+		name string
+		c    *entities.CampaignEntity
+		want error
+	}{
+		{"empty", &entities.CampaignEntity{}, ErrEmpty},
+		{"text too long", &entities.CampaignEntity{Text: strings.Repeat("a", maxTextLen+1)}, ErrTooLong},
+		{"caption too long", &entities.CampaignEntity{Text: strings.Repeat("a", maxCaptionLen+1), PhotoFileID: "photo"}, ErrTooLong},
+		{"multibyte text too long", &entities.CampaignEntity{Text: strings.Repeat("è", maxTextLen+1)}, ErrTooLong},
+	}
+	for _, tt := range tests {
+		if _, err := s.Create(context.Background(), tt.c); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Create error = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestNewDefaults(t *testing.T) {
+	s := New(nil, nil, nil, nil, nil, nil, Options{})
+	if s.opts.Interval != DefaultInterval || s.opts.BatchSize != DefaultBatchSize ||
+		s.opts.Workers != DefaultWorkers || s.opts.LockTTL != DefaultLockTTL {
+		t.Fatalf("opts = %+v, want the defaults", s.opts)
+	}
+	if other := New(nil, nil, nil, nil, nil, nil, Options{}); other.instance == s.instance {
+		t.Fatalf("two services share the instance id %q", s.instance)
+	}
+}
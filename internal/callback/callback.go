@@ -0,0 +1,198 @@
+package callback
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/frangi01/bbtelgo/internal/db"
+)
+
+// Telegram limit for InlineKeyboardButton.callback_data
+const MaxDataLen = 64
+
+const (
+	DefaultTTL = 24 * time.Hour
+	sigLen     = 6  // bytes of HMAC kept in the data (8 chars in base64)
+	tokenLen   = 12 // bytes of the random token of spilled payloads (16 chars)
+)
+
+var (
+	ErrInvalid = errors.New("callback: malformed data")
+	ErrForged  = errors.New("callback: bad signature")
+	ErrExpired = errors.New("callback: expired")
+	ErrTooLong = errors.New("callback: payload too long and no redis to spill it")
+	b64        = base64.RawURLEncoding
+)
+
+// Validator is implemented by payloads that check themselves after decoding.
+type Validator interface {
+	Validate() error
+}
+
+// Codec encodes payloads into signed callback data:
+//
+//	<route>:<expiry base36>.<base64 json>.<signature>
+//
+// When the result exceeds 64 bytes the json goes to Redis and the data carries a token:
+//
+//	<route>:<expiry base36>.~<token>.<signature>
+type Codec struct {
+	secret []byte
+	cache  *db.CacheClient
+	ttl    time.Duration
+}
+
+// NewCodec: cache may be nil (no spilling), ttl 0 = DefaultTTL, ttl < 0 = no expiry
+// (spilled payloads are still kept for DefaultTTL only).
+func NewCodec(secret string, cache *db.CacheClient, ttl time.Duration) *Codec {
+	if ttl == 0 {
+		ttl = DefaultTTL
+	}
+	return &Codec{secret: []byte(secret), cache: cache, ttl: ttl}
+}
+
+// Route returns the route name of data (the part before the first ':').
+func Route(data string) string {
+	if i := strings.IndexByte(data, ':'); i >= 0 {
+		return data[:i]
+	}
+	return data
+}
+
+// Encode builds the callback data of route with payload (nil = no payload).
+func (c *Codec) Encode(ctx context.Context, route string, payload any) (string, error) {
+	if route == "" || strings.ContainsAny(route, ":.") {
+		return "", fmt.Errorf("callback: invalid route %q", route)
+	}
+	body := []byte{}
+	if payload != nil {
+		var err error
+		if body, err = json.Marshal(payload); err != nil {
+			return "", fmt.Errorf("callback: encode %s: %w", route, err)
+		}
+	}
+
+	exp := "0"
+	var expiresAt time.Time
+	if c.ttl > 0 {
+		expiresAt = time.Now().Add(c.ttl)
+		exp = strconv.FormatInt(expiresAt.Unix(), 36)
+	}
+
+	value := b64.EncodeToString(body)
+	data := c.pack(route, exp, value)
+	if len(data) <= MaxDataLen {
+		return data, nil
+	}
+
+	// spill to Redis
+	if c.cache == nil {
+		return "", ErrTooLong
+	}
+	raw := make([]byte, tokenLen)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := b64.EncodeToString(raw)
+	// the spilled payload always expires, even when the data does not (ttl < 0)
+	ttl := DefaultTTL
+	if !expiresAt.IsZero() {
+		ttl = time.Until(expiresAt)
+	}
+	if err := c.cache.SetString(ctx, spillKey(token), string(body), ttl); err != nil {
+		return "", fmt.Errorf("callback: spill %s: %w", route, err)
+	}
+
+	data = c.pack(route, exp, "~"+token)
+	if len(data) > MaxDataLen {
+		return "", fmt.Errorf("callback: route %q too long", route)
+	}
+	return data, nil
+}
+
+// Decode verifies data (signature, expiry) and unmarshals its payload into out (nil to skip).
+func (c *Codec) Decode(ctx context.Context, data string, out any) error {
+	route, rest, ok := strings.Cut(data, ":")
+	if !ok {
+		return ErrInvalid
+	}
+	parts := strings.Split(rest, ".")
+	if len(parts) != 3 {
+		return ErrInvalid
+	}
+	exp, value, sig := parts[0], parts[1], parts[2]
+
+	if !hmac.Equal([]byte(sig), []byte(c.sign(route, exp, value))) {
+		return ErrForged
+	}
+	if exp != "0" {
+		unix, err := strconv.ParseInt(exp, 36, 64)
+		if err != nil {
+			return ErrInvalid
+		}
+		if time.Now().Unix() > unix {
+			return ErrExpired
+		}
+	}
+
+	var body []byte
+	if token, spilled := strings.CutPrefix(value, "~"); spilled {
+		if c.cache == nil {
+			return ErrExpired
+		}
+		s, err := c.cache.GetString(ctx, spillKey(token))
+		if err != nil {
+			return err
+		}
+		if s == "" {
+			return ErrExpired
+		}
+		body = []byte(s)
+	} else {
+		var err error
+		if body, err = b64.DecodeString(value); err != nil {
+			return ErrInvalid
+		}
+	}
+
+	if out == nil || len(body) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	if v, ok := out.(Validator); ok {
+		return v.Validate()
+	}
+	return nil
+}
+
+// Decode is the generic form of Codec.Decode.
+func Decode[T any](ctx context.Context, c *Codec, data string) (T, error) {
+	var v T
+	err := c.Decode(ctx, data, &v)
+	return v, err
+}
+
+func (c *Codec) pack(route, exp, value string) string {
+	return route + ":" + exp + "." + value + "." + c.sign(route, exp, value)
+}
+
+func (c *Codec) sign(route, exp, value string) string {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write([]byte(route + ":" + exp + "." + value))
+	return b64.EncodeToString(mac.Sum(nil)[:sigLen])
+}
+
+func spillKey(token string) string {
+	return "cb:" + token
+}
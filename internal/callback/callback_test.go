@@ -0,0 +1,133 @@
+package callback
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testPayload struct {
+	ID   int64  `json:"i"`
+	Name string `json:"n"`
+}
+
+func (p testPayload) Validate() error {
+	if p.ID <= 0 {
+		return errors.New("bad id")
+	}
+	return nil
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name string
+		ttl  time.Duration
+	}{
+		{"default ttl", 0},
+		{"custom ttl", time.Hour},
+		{"no expiry", -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCodec("secret", nil, tt.ttl)
+			data, err := c.Encode(ctx, "admin", testPayload{ID: 42, Name: "x"})
+			if err != nil {
+				t.Fatalf("encode: %v", err)
+			}
+			if len(data) > MaxDataLen {
+				t.Fatalf("data %q is %d bytes, over %d", data, len(data), MaxDataLen)
+			}
+			if Route(data) != "admin" {
+				t.Fatalf("Route(%q) = %q", data, Route(data))
+			}
+			got, err := Decode[testPayload](ctx, c, data)
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if got != (testPayload{ID: 42, Name: "x"}) {
+				t.Fatalf("decoded %+v", got)
+			}
+		})
+	}
+}
+
+func TestCodecNilPayload(t *testing.T) {
+	ctx := context.Background()
+	c := NewCodec("secret", nil, 0)
+	data, err := c.Encode(ctx, "ping", nil)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if err := c.Decode(ctx, data, nil); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+}
+
+func TestCodecRejects(t *testing.T) {
+	ctx := context.Background()
+	c := NewCodec("secret", nil, time.Hour)
+	valid, err := c.Encode(ctx, "admin", testPayload{ID: 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	invalidPayload, err := c.Encode(ctx, "admin", testPayload{ID: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewCodec("other secret", nil, time.Hour).Encode(ctx, "admin", testPayload{ID: 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	route, rest, _ := strings.Cut(valid, ":")
+	exp, tail, _ := strings.Cut(rest, ".")
+	past := strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 36)
+	value, _, _ := strings.Cut(tail, ".")
+
+	tests := []struct {
+		name string
+		data string
+		want error
+	}{
+		{"no route", "admin", ErrInvalid},
+		{"missing parts", "admin:abc.def", ErrInvalid},
+		{"other secret", other, ErrForged},
+		{"other route", "users:" + rest, ErrForged},
+		{"extended expiry", route + ":" + exp + "z." + tail, ErrForged},
+		{"tampered payload", route + ":" + exp + ".e30." + strings.SplitN(tail, ".", 2)[1], ErrForged},
+		{"expired", c.pack(route, past, value), ErrExpired},
+		{"bad expiry", c.pack(route, "!", value), ErrInvalid},
+		{"bad base64", c.pack(route, exp, "***"), ErrInvalid},
+		{"spilled without redis", c.pack(route, exp, "~token"), ErrExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Decode[testPayload](ctx, c, tt.data); !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	t.Run("validator", func(t *testing.T) {
+		if _, err := Decode[testPayload](ctx, c, invalidPayload); err == nil || err.Error() != "bad id" {
+			t.Fatalf("err = %v, want the Validate error", err)
+		}
+	})
+}
+
+func TestCodecEncodeErrors(t *testing.T) {
+	ctx := context.Background()
+	c := NewCodec("secret", nil, 0)
+
+	for _, route := range []string{"", "a:b", "a.b"} {
+		if _, err := c.Encode(ctx, route, nil); err == nil {
+			t.Errorf("Encode(%q) succeeded, want an invalid route error", route)
+		}
+	}
+	if _, err := c.Encode(ctx, "admin", testPayload{ID: 1, Name: strings.Repeat("x", MaxDataLen)}); !errors.Is(err, ErrTooLong) {
+		t.Errorf("long payload without redis: err = %v, want ErrTooLong", err)
+	}
+}
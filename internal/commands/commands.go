@@ -0,0 +1,170 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/frangi01/bbtelgo/internal/i18n"
+	"github.com/frangi01/bbtelgo/internal/logx"
+	"github.com/frangi01/bbtelgo/internal/rbac"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// Scope is where a command is offered in the Telegram menu (and accepted).
+type Scope string
+
+const (
+	ScopePrivate     Scope = "private"
+	ScopeGroup       Scope = "group"
+	ScopeGroupAdmins Scope = "admins" // groups, only for chat administrators
+)
+
+type Command struct {
+	Name        string // without "/", lowercase (Telegram: 1-32 chars a-z0-9_)
+	Description string // i18n key of the menu description
+	Scope       Scope
+	Hidden      bool      // routed, but not listed in the menu
+	Access      rbac.Rule // required roles/permissions (zero = everyone); restricted commands are not listed
+}
+
+// Route binds a command to the handler type of a route package.
+type Route[H any] struct {
+	Command
+	Handler H
+}
+
+// Table is the command route table of one chat type, in declaration order.
+type Table[H any] struct {
+	routes []Route[H]
+	byName map[string]int
+}
+
+// NewTable: routes without Scope get scope.
+func NewTable[H any](scope Scope, routes ...Route[H]) *Table[H] {
+	t := &Table[H]{byName: make(map[string]int, len(routes))}
+	for _, r := range routes {
+		if r.Scope == "" {
+			r.Scope = scope
+		}
+		r.Name = strings.TrimPrefix(r.Name, "/")
+		if _, dup := t.byName[r.Name]; dup {
+			panic(fmt.Sprintf("commands: duplicate command /%s", r.Name))
+		}
+		t.byName[r.Name] = len(t.routes)
+		t.routes = append(t.routes, r)
+	}
+	return t
+}
+
+// Lookup finds the route of cmd ("/start"); text without the leading "/" never matches.
+func (t *Table[H]) Lookup(cmd string) (Route[H], bool) {
+	if !strings.HasPrefix(cmd, "/") {
+		return Route[H]{}, false
+	}
+	i, ok := t.byName[strings.ToLower(cmd[1:])]
+	if !ok {
+		return Route[H]{}, false
+	}
+	return t.routes[i], true
+}
+
+// Commands returns the metadata of every route, for the Registry.
+func (t *Table[H]) Commands() []Command {
+	out := make([]Command, 0, len(t.routes))
+	for _, r := range t.routes {
+		out = append(out, r.Command)
+	}
+	return out
+}
+
+// Registry collects the commands of all route tables and publishes them with setMyCommands.
+type Registry struct {
+	commands []Command
+}
+
+func NewRegistry(cmds ...Command) *Registry {
+	r := &Registry{}
+	r.Register(cmds...)
+	return r
+}
+
+func (r *Registry) Register(cmds ...Command) {
+	r.commands = append(r.commands, cmds...)
+}
+
+// Visible returns the menu of a scope. The administrators scope replaces the group
+// one for admins, so it lists group commands too. The menu is the same for every
+// user, so commands with an Access rule are left out.
+func (r *Registry) Visible(scope Scope) []Command {
+	var out []Command
+	for _, c := range r.commands {
+		if c.Hidden || !c.Access.Public() {
+			continue
+		}
+		if c.Scope == scope || (scope == ScopeGroupAdmins && c.Scope == ScopeGroup) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func botScope(scope Scope) models.BotCommandScope {
+	switch scope {
+	case ScopeGroup:
+		return &models.BotCommandScopeAllGroupChats{}
+	case ScopeGroupAdmins:
+		return &models.BotCommandScopeAllChatAdministrators{}
+	default:
+		return &models.BotCommandScopeAllPrivateChats{}
+	}
+}
+
+// Sync calls setMyCommands for every scope and every language of the bundle, plus
+// the default language without language_code (fallback for the other clients).
+// Scopes without commands are cleared with deleteMyCommands.
+func (r *Registry) Sync(ctx context.Context, b *bot.Bot, bundle *i18n.Bundle, logger *logx.Logger) error {
+	langs := append([]string{""}, bundle.Langs()...)
+
+	var errs []error
+	for _, scope := range []Scope{ScopePrivate, ScopeGroup, ScopeGroupAdmins} {
+		cmds := r.Visible(scope)
+		for _, lang := range langs {
+			var err error
+			if len(cmds) == 0 {
+				_, err = b.DeleteMyCommands(ctx, &bot.DeleteMyCommandsParams{
+					Scope:        botScope(scope),
+					LanguageCode: lang,
+				})
+			} else {
+				_, err = b.SetMyCommands(ctx, &bot.SetMyCommandsParams{
+					Commands:     botCommands(cmds, bundle, lang),
+					Scope:        botScope(scope),
+					LanguageCode: lang,
+				})
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("scope %s lang %q: %w", scope, lang, err))
+				continue
+			}
+			logger.Debugf("commands synced: scope=%s lang=%q count=%d", scope, lang, len(cmds))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func botCommands(cmds []Command, bundle *i18n.Bundle, lang string) []models.BotCommand {
+	if lang == "" {
+		lang = bundle.DefaultLang()
+	}
+	out := make([]models.BotCommand, 0, len(cmds))
+	for _, c := range cmds {
+		out = append(out, models.BotCommand{
+			Command:     c.Name,
+			Description: bundle.T(lang, c.Description, nil),
+		})
+	}
+	return out
+}
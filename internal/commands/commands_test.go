@@ -0,0 +1,75 @@
+package commands
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestTableLookup(t *testing.T) {
+	table := NewTable(ScopePrivate,
+		Route[int]{Command: Command{Name: "/start"}, Handler: 1},
+		Route[int]{Command: Command{Name: "help", Scope: ScopeGroup}, Handler: 2},
+	)
+
+	tests := []struct {
+		cmd    string
+		want   int
+		wantOK bool
+	}{
+		{"/start", 1, true},
+		{"/START", 1, true},
+		{"/help", 2, true},
+		{"start", 0, false},
+		{"/unknown", 0, false},
+	}
+	for _, tt := range tests {
+		r, ok := table.Lookup(tt.cmd)
+		if ok != tt.wantOK || r.Handler != tt.want {
+			t.Errorf("Lookup(%q) = (%v, %v), want (%v, %v)", tt.cmd, r.Handler, ok, tt.want, tt.wantOK)
+		}
+	}
+
+	cmds := table.Commands()
+	if len(cmds) != 2 || cmds[0].Name != "start" || cmds[0].Scope != ScopePrivate || cmds[1].Scope != ScopeGroup {
+		t.Errorf("Commands() = %+v", cmds)
+	}
+}
+
+func TestTableDuplicate(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("duplicate command accepted")
+		}
+	}()
+	NewTable(ScopePrivate, Route[int]{Command: Command{Name: "/start"}}, Route[int]{Command: Command{Name: "start"}})
+}
+
+func TestRegistryVisible(t *testing.T) {
+	r := NewRegistry(
+		Command{Name: "start", Scope: ScopePrivate},
+		Command{Name: "secret", Scope: ScopePrivate, Hidden: true},
+		Command{Name: "ping", Scope: ScopeGroup},
+		Command{Name: "ban", Scope: ScopeGroupAdmins},
+	)
+	names := func(cmds []Command) []string {
+		var out []string
+		for _, c := range cmds {
+			out = append(out, c.Name)
+		}
+		return out
+	}
+
+	tests := []struct {
+		scope Scope
+		want  []string
+	}{
+		{ScopePrivate, []string{"start"}},
+		{ScopeGroup, []string{"ping"}},
+		{ScopeGroupAdmins, []string{"ping", "ban"}},
+	}
+	for _, tt := range tests {
+		if got := names(r.Visible(tt.scope)); !slices.Equal(got, tt.want) {
+			t.Errorf("Visible(%s) = %v, want %v", tt.scope, got, tt.want)
+		}
+	}
+}
@@ -1,9 +1,12 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/frangi01/bbtelgo/internal/logx"
@@ -63,6 +66,16 @@ type RedisCfg struct {
 	RateLimitType	RateLimitType
 	RateLimitMessages int
 	RateLimitMs		int
+	SessionTTL		time.Duration
+	SessionScope	string
+}
+
+// RetentionCfg: messages older than Policies[chat type] are deleted by the retention
+// sweeper, archived first to gzipped JSONL files in ArchiveDir when set.
+type RetentionCfg struct {
+	Policies	map[string]time.Duration // chat type -> max age (types without policy are kept forever)
+	ArchiveDir	string
+	Interval	time.Duration
 }
 
 type Config struct {
@@ -83,6 +96,11 @@ type Config struct {
 	WebHookPublicUrl 			string
 	WebHookTLSKeyFile 			string
 	WebHookTLSCertFile 			string
+	CallbackSecret				string
+	CallbackTTL					time.Duration
+	PersistChatTypes			[]string // chat types whose messages are stored (empty = off)
+	AdminIDs					[]int64 // bootstrap admins (Telegram IDs), always granted the admin role
+	Retention					RetentionCfg
 	MongoCfg					MongoCfg
 	RedisCfg					RedisCfg
 }
@@ -165,6 +183,71 @@ func Load(logger *logx.Logger) (Config, error) {
 		logger.Errorf("env REDIS_RATE_LIMIT_MS")
 	}
 
+	// optional: 0 = session default
+	sessionTTL := 0
+	if strSessionTTL := os.Getenv("REDIS_SESSION_TTL"); strSessionTTL != "" {
+		sessionTTL, err = strconv.Atoi(strSessionTTL)
+		if err != nil {
+			logger.Errorf("env REDIS_SESSION_TTL")
+		}
+	}
+
+	// optional: 0 = codec default, negative = no expiry
+	callbackTTL := 0
+	if strCallbackTTL := os.Getenv("APP_CALLBACK_TTL"); strCallbackTTL != "" {
+		callbackTTL, err = strconv.Atoi(strCallbackTTL)
+		if err != nil {
+			logger.Errorf("env APP_CALLBACK_TTL")
+		}
+	}
+
+	// optional: comma separated chat types, e.g. "private,group,supergroup"
+	var persistChatTypes []string
+	for _, t := range strings.Split(os.Getenv("APP_PERSIST_MESSAGES"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			persistChatTypes = append(persistChatTypes, t)
+		}
+	}
+
+	// optional: comma separated Telegram user IDs
+	var adminIDs []int64
+	for _, str := range strings.Split(os.Getenv("APP_ADMIN_IDS"), ",") {
+		if str = strings.TrimSpace(str); str == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			logger.Errorf("env APP_ADMIN_IDS")
+			continue
+		}
+		adminIDs = append(adminIDs, id)
+	}
+
+	// optional: "private=90d,group=30d" (days, or a Go duration like 720h)
+	retention := RetentionCfg{
+		Policies:   map[string]time.Duration{},
+		ArchiveDir: os.Getenv("APP_RETENTION_ARCHIVE_DIR"),
+	}
+	for _, str := range strings.Split(os.Getenv("APP_RETENTION"), ",") {
+		if str = strings.TrimSpace(str); str == "" {
+			continue
+		}
+		chatType, age, _ := strings.Cut(str, "=")
+		maxAge, err := parseAge(strings.TrimSpace(age))
+		if err != nil || maxAge <= 0 {
+			logger.Errorf("env APP_RETENTION")
+			continue
+		}
+		retention.Policies[strings.TrimSpace(chatType)] = maxAge
+	}
+	if strInterval := os.Getenv("APP_RETENTION_INTERVAL"); strInterval != "" {
+		interval, err := strconv.Atoi(strInterval)
+		if err != nil {
+			logger.Errorf("env APP_RETENTION_INTERVAL")
+		}
+		retention.Interval = time.Duration(interval) * time.Second
+	}
+
 	cfg := Config{
 		LogLevel: 					logLevel,
 		LogFile:					os.Getenv("APP_LOG_FILE") == "true",
@@ -183,6 +266,11 @@ func Load(logger *logx.Logger) (Config, error) {
 		WebHookPort: os.Getenv("APP_WEBHOOK_PORT"),
 		WebHookTLSCertFile: os.Getenv("APP_WEBHOOK_TLS_CERT_FILE"),
 		WebHookTLSKeyFile: os.Getenv("APP_WEBHOOK_TLS_KEY_FILE"),
+		CallbackSecret: os.Getenv("APP_CALLBACK_SECRET"),
+		CallbackTTL: time.Duration(callbackTTL) * time.Second,
+		PersistChatTypes: persistChatTypes,
+		AdminIDs: adminIDs,
+		Retention: retention,
 		MongoCfg: MongoCfg{
 			URI: os.Getenv("MONGO_URI"),
 			DB: os.Getenv("MONGO_DB"),
@@ -200,6 +288,8 @@ func Load(logger *logx.Logger) (Config, error) {
 			RateLimitType: RateLimitType(os.Getenv("REDIS_RATE_LIMIT")),
 			RateLimitMessages: rateLimitMessages,
 			RateLimitMs: rateLimitMs,
+			SessionTTL: time.Duration(sessionTTL) * time.Second,
+			SessionScope: os.Getenv("REDIS_SESSION_SCOPE"),
 		},
 	}
 
@@ -209,6 +299,12 @@ func Load(logger *logx.Logger) (Config, error) {
 		return Config{}, err
 	}
 
+	if cfg.CallbackSecret == "" {
+		// stable across restarts and replicas, secret as long as the token is
+		sum := sha256.Sum256([]byte("callback:" + cfg.Token))
+		cfg.CallbackSecret = hex.EncodeToString(sum[:])
+	}
+
 	if cfg.Mode != ModeWebhook && cfg.Mode != ModePolling {
 		err := fmt.Errorf("APP_MODE should be 'webhook' or 'polling'")
 		logger.Errorf("%v", err)
@@ -252,4 +348,13 @@ func Load(logger *logx.Logger) (Config, error) {
 	}
 
 	return cfg, nil
-}
\ No newline at end of file
+}
+
+// parseAge accepts days ("90d") or a Go duration ("720h").
+func parseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		return time.Duration(n) * 24 * time.Hour, err
+	}
+	return time.ParseDuration(s)
+}
@@ -0,0 +1,240 @@
+package conversation
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/frangi01/bbtelgo/internal/entities"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// State of a flow. End closes the conversation.
+type State string
+
+const End State = ""
+
+const DefaultTimeout = 10 * time.Minute
+
+// Handler processes the user input for the current state and returns the next one.
+// conv.Data can be changed freely: it is saved together with the new state.
+// D is the dependency type of the caller (e.g. *utils.HandlerDeps).
+type Handler[D any] func(ctx context.Context, b *bot.Bot, u *models.Update, conv *entities.ConversationEntity, deps D, lang string) (State, error)
+
+// Hook is called on enter/cancel/timeout events.
+type Hook[D any] func(ctx context.Context, b *bot.Bot, u *models.Update, conv *entities.ConversationEntity, deps D, lang string) error
+
+type Step[D any] struct {
+	Enter  Hook[D]    // optional: prompt sent when the conversation moves into this state
+	Handle Handler[D] // input handler
+	Next   []State    // allowed transitions (End and the same state are always allowed; empty = any)
+}
+
+type Flow[D any] struct {
+	Name      string
+	Initial   State
+	Timeout   time.Duration // inactivity timeout (0 = DefaultTimeout)
+	Steps     map[State]Step[D]
+	OnCancel  Hook[D]
+	OnTimeout Hook[D]
+}
+
+// Manager holds the declared flows and drives them.
+type Manager[D any] struct {
+	mu            sync.RWMutex
+	flows         map[string]*Flow[D]
+	cancelCommand string
+}
+
+// NewManager: cancelCommand (e.g. "/cancel") aborts any active conversation; other
+// commands abort it as well and are then routed as usual.
+func NewManager[D any](cancelCommand string) *Manager[D] {
+	return &Manager[D]{flows: make(map[string]*Flow[D]), cancelCommand: cancelCommand}
+}
+
+// Register adds a flow; it panics on invalid declarations, as route tables are built at init.
+func (m *Manager[D]) Register(f Flow[D]) {
+	if f.Name == "" {
+		panic("conversation: flow without name")
+	}
+	if _, ok := f.Steps[f.Initial]; !ok {
+		panic(fmt.Sprintf("conversation: flow %q: initial state %q not declared", f.Name, f.Initial))
+	}
+	for st, step := range f.Steps {
+		if step.Handle == nil {
+			panic(fmt.Sprintf("conversation: flow %q: state %q without handler", f.Name, st))
+		}
+		for _, next := range step.Next {
+			if _, ok := f.Steps[next]; !ok && next != End {
+				panic(fmt.Sprintf("conversation: flow %q: transition %q -> %q to undeclared state", f.Name, st, next))
+			}
+		}
+	}
+	if f.Timeout <= 0 {
+		f.Timeout = DefaultTimeout
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.flows[f.Name] = &f
+}
+
+func (m *Manager[D]) flow(name string) (*Flow[D], bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	f, ok := m.flows[name]
+	return f, ok
+}
+
+// Start opens (or restarts) the flow for the sender of u and runs the Enter hook of the initial state.
+func (m *Manager[D]) Start(ctx context.Context, b *bot.Bot, u *models.Update, store Store, name string, deps D, lang string) error {
+	f, ok := m.flow(name)
+	if !ok {
+		return fmt.Errorf("conversation: unknown flow %q", name)
+	}
+	chatID, userID := participants(u)
+	if chatID == 0 || userID == 0 {
+		return fmt.Errorf("conversation: update %d without chat or sender", u.ID)
+	}
+
+	now := time.Now().UTC()
+	conv := &entities.ConversationEntity{
+		ChatID:    chatID,
+		UserID:    userID,
+		Flow:      f.Name,
+		State:     string(f.Initial),
+		Data:      map[string]string{},
+		ExpiresAt: now.Add(f.Timeout),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := store.Save(ctx, conv); err != nil {
+		return err
+	}
+	return m.enter(ctx, b, u, f, conv, deps, lang)
+}
+
+// Handle feeds u to the active conversation of its sender.
+// handled=false means there is no active conversation (or it just expired, or a command
+// other than cancelCommand ended it) and normal routing should go on.
+func (m *Manager[D]) Handle(ctx context.Context, b *bot.Bot, u *models.Update, store Store, deps D, lang string) (handled bool, err error) {
+	chatID, userID := participants(u)
+	if chatID == 0 || userID == 0 {
+		return false, nil
+	}
+	conv, err := store.Load(ctx, chatID, userID)
+	if err != nil || conv == nil {
+		return false, err
+	}
+	f, ok := m.flow(conv.Flow)
+	if !ok {
+		// flow removed in a newer release
+		return false, store.Delete(ctx, chatID, userID)
+	}
+
+	if time.Now().After(conv.ExpiresAt) {
+		if err := store.Delete(ctx, chatID, userID); err != nil {
+			return false, err
+		}
+		// the notice is sent, then the message goes on to its route
+		if f.OnTimeout == nil {
+			return false, nil
+		}
+		return false, f.OnTimeout(ctx, b, u, conv, deps, lang)
+	}
+
+	// a command is never step input: the cancel command ends the flow, any other one
+	// ends it too and goes on to its route
+	if cmd := command(u); cmd != "" {
+		if err := store.Delete(ctx, chatID, userID); err != nil {
+			return true, err
+		}
+		handled = m.cancelCommand != "" && cmd == m.cancelCommand
+		if f.OnCancel != nil {
+			return handled, f.OnCancel(ctx, b, u, conv, deps, lang)
+		}
+		return handled, nil
+	}
+
+	if conv.Data == nil {
+		conv.Data = map[string]string{}
+	}
+	current := State(conv.State)
+	step, ok := f.Steps[current]
+	if !ok {
+		return true, store.Delete(ctx, chatID, userID)
+	}
+
+	next, err := step.Handle(ctx, b, u, conv, deps, lang)
+	if err != nil {
+		// keep the state: the user can retry
+		return true, err
+	}
+	if next != End && next != current && len(step.Next) > 0 && !slices.Contains(step.Next, next) {
+		return true, fmt.Errorf("conversation: flow %q: transition %q -> %q not allowed", f.Name, current, next)
+	}
+	if next == End {
+		return true, store.Delete(ctx, chatID, userID)
+	}
+	if _, ok := f.Steps[next]; !ok {
+		return true, fmt.Errorf("conversation: flow %q: unknown state %q", f.Name, next)
+	}
+
+	now := time.Now().UTC()
+	conv.State = string(next)
+	conv.ExpiresAt = now.Add(f.Timeout)
+	conv.UpdatedAt = now
+	if err := store.Save(ctx, conv); err != nil {
+		return true, err
+	}
+	if next == current {
+		return true, nil
+	}
+	return true, m.enter(ctx, b, u, f, conv, deps, lang)
+}
+
+// Cancel aborts the active conversation of (chatID, userID), if any.
+func (m *Manager[D]) Cancel(ctx context.Context, store Store, chatID, userID int64) error {
+	return store.Delete(ctx, chatID, userID)
+}
+
+func (m *Manager[D]) enter(ctx context.Context, b *bot.Bot, u *models.Update, f *Flow[D], conv *entities.ConversationEntity, deps D, lang string) error {
+	if step := f.Steps[State(conv.State)]; step.Enter != nil {
+		return step.Enter(ctx, b, u, conv, deps, lang)
+	}
+	return nil
+}
+
+// command returns the command of a message ("/start@Bot foo" -> "/start"), "" if it has none.
+func command(u *models.Update) string {
+	if u.Message == nil {
+		return ""
+	}
+	fields := strings.Fields(u.Message.Text)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+		return ""
+	}
+	cmd := fields[0]
+	if i := strings.IndexByte(cmd, '@'); i > 0 {
+		cmd = cmd[:i]
+	}
+	return cmd
+}
+
+func participants(u *models.Update) (chatID, userID int64) {
+	switch {
+	case u.Message != nil:
+		if u.Message.From != nil {
+			return u.Message.Chat.ID, u.Message.From.ID
+		}
+	case u.CallbackQuery != nil:
+		if u.CallbackQuery.Message.Message != nil {
+			return u.CallbackQuery.Message.Message.Chat.ID, u.CallbackQuery.From.ID
+		}
+	}
+	return 0, 0
+}
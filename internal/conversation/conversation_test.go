@@ -0,0 +1,175 @@
+package conversation
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/frangi01/bbtelgo/internal/entities"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+type memStore map[string]entities.ConversationEntity
+
+func (s memStore) Load(ctx context.Context, chatID, userID int64) (*entities.ConversationEntity, error) {
+	c, ok := s[key(chatID, userID)]
+	if !ok {
+		return nil, nil
+	}
+	return &c, nil
+}
+
+func (s memStore) Save(ctx context.Context, c *entities.ConversationEntity) error {
+	s[key(c.ChatID, c.UserID)] = *c
+	return nil
+}
+
+func (s memStore) Delete(ctx context.Context, chatID, userID int64) error {
+	delete(s, key(chatID, userID))
+	return nil
+}
+
+// events records the hooks and steps run, the deps of the test flow
+type events []string
+
+const (
+	askName  State = "name"
+	askEmail State = "email"
+)
+
+func testManager() *Manager[*events] {
+	m := NewManager[*events]("/cancel")
+	hook := func(name string) Hook[*events] {
+		return func(ctx context.Context, b *bot.Bot, u *models.Update, conv *entities.ConversationEntity, ev *events, lang string) error {
+			*ev = append(*ev, name)
+			return nil
+		}
+	}
+	m.Register(Flow[*events]{
+		Name:    "register",
+		Initial: askName,
+		Steps: map[State]Step[*events]{
+			askName: {
+				Enter: hook("enter name"),
+				Handle: func(ctx context.Context, b *bot.Bot, u *models.Update, conv *entities.ConversationEntity, ev *events, lang string) (State, error) {
+					conv.Data["name"] = u.Message.Text
+					*ev = append(*ev, "name="+u.Message.Text)
+					return askEmail, nil
+				},
+				Next: []State{askEmail},
+			},
+			askEmail: {
+				Enter: hook("enter email"),
+				Handle: func(ctx context.Context, b *bot.Bot, u *models.Update, conv *entities.ConversationEntity, ev *events, lang string) (State, error) {
+					*ev = append(*ev, "email="+u.Message.Text)
+					if u.Message.Text == "loop" {
+						return askName, nil // not in Next
+					}
+					return End, nil
+				},
+				Next: []State{End},
+			},
+		},
+		OnCancel:  hook("cancel"),
+		OnTimeout: hook("timeout"),
+	})
+	return m
+}
+
+func text(s string) *models.Update {
+	return &models.Update{Message: &models.Message{Chat: models.Chat{ID: 1}, From: &models.User{ID: 1}, Text: s}}
+}
+
+func TestFlow(t *testing.T) {
+	ctx := context.Background()
+	m, store, ev := testManager(), memStore{}, &events{}
+
+	if handled, err := m.Handle(ctx, nil, text("hi"), store, ev, ""); handled || err != nil {
+		t.Fatalf("no conversation: handled=%v err=%v", handled, err)
+	}
+	if err := m.Start(ctx, nil, text("/register"), store, "register", ev, ""); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	for _, in := range []string{"Ada", "ada@example.com"} {
+		if handled, err := m.Handle(ctx, nil, text(in), store, ev, ""); !handled || err != nil {
+			t.Fatalf("%q: handled=%v err=%v", in, handled, err)
+		}
+	}
+	want := events{"enter name", "name=Ada", "enter email", "email=ada@example.com"}
+	if fmt.Sprint(*ev) != fmt.Sprint(want) {
+		t.Fatalf("events = %v, want %v", *ev, want)
+	}
+	if len(store) != 0 {
+		t.Fatalf("conversation still stored after End: %v", store)
+	}
+}
+
+func TestFlowTransitionNotAllowed(t *testing.T) {
+	ctx := context.Background()
+	m, store, ev := testManager(), memStore{}, &events{}
+	_ = m.Start(ctx, nil, text("/register"), store, "register", ev, "")
+	_, _ = m.Handle(ctx, nil, text("Ada"), store, ev, "")
+
+	if _, err := m.Handle(ctx, nil, text("loop"), store, ev, ""); err == nil {
+		t.Fatal("transition outside Next accepted")
+	}
+	if c, _ := store.Load(ctx, 1, 1); c == nil || State(c.State) != askEmail {
+		t.Fatalf("state after a refused transition = %+v, want %q", c, askEmail)
+	}
+}
+
+func TestFlowCommands(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		wantHandled bool
+	}{
+		{"cancel", "/cancel", true},
+		{"cancel addressed", "/cancel@MyBot", true},
+		{"other command", "/start", false},
+		{"other command addressed", "/help@MyBot now", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			m, store, ev := testManager(), memStore{}, &events{}
+			_ = m.Start(ctx, nil, text("/register"), store, "register", ev, "")
+
+			handled, err := m.Handle(ctx, nil, text(tt.input), store, ev, "")
+			if err != nil || handled != tt.wantHandled {
+				t.Fatalf("handled=%v err=%v, want handled=%v", handled, err, tt.wantHandled)
+			}
+			// never fed to the step as data
+			want := events{"enter name", "cancel"}
+			if fmt.Sprint(*ev) != fmt.Sprint(want) {
+				t.Fatalf("events = %v, want %v", *ev, want)
+			}
+			if len(store) != 0 {
+				t.Fatalf("conversation still stored: %v", store)
+			}
+		})
+	}
+}
+
+func TestFlowTimeout(t *testing.T) {
+	ctx := context.Background()
+	m, store, ev := testManager(), memStore{}, &events{}
+	_ = m.Start(ctx, nil, text("/register"), store, "register", ev, "")
+	c, _ := store.Load(ctx, 1, 1)
+	c.ExpiresAt = time.Now().Add(-time.Second)
+	_ = store.Save(ctx, c)
+
+	// the notice is sent and the message goes on to its route
+	handled, err := m.Handle(ctx, nil, text("Ada"), store, ev, "")
+	if handled || err != nil {
+		t.Fatalf("handled=%v err=%v, want handled=false", handled, err)
+	}
+	if want := (events{"enter name", "timeout"}); fmt.Sprint(*ev) != fmt.Sprint(want) {
+		t.Fatalf("events = %v, want %v", *ev, want)
+	}
+	if len(store) != 0 {
+		t.Fatalf("expired conversation still stored: %v", store)
+	}
+}
@@ -0,0 +1,94 @@
+package conversation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/frangi01/bbtelgo/internal/db"
+	"github.com/frangi01/bbtelgo/internal/entities"
+	"github.com/frangi01/bbtelgo/internal/logx"
+	"github.com/frangi01/bbtelgo/internal/repo"
+)
+
+// Store persists conversations. Load returns (nil, nil) when there is none.
+type Store interface {
+	Load(ctx context.Context, chatID, userID int64) (*entities.ConversationEntity, error)
+	Save(ctx context.Context, c *entities.ConversationEntity) error
+	Delete(ctx context.Context, chatID, userID int64) error
+}
+
+// keep the key a bit longer than the timeout, to tell the user the dialog expired
+const redisGrace = time.Hour
+
+// fallbackStore uses Redis and falls back to Mongo when Redis is not configured or fails.
+type fallbackStore struct {
+	cache  *db.CacheClient
+	repo   *repo.ConversationRepository
+	logger *logx.Logger
+}
+
+// NewStore: cache or repo can be nil (not both, or every call fails).
+func NewStore(cache *db.CacheClient, convRepo *repo.ConversationRepository, logger *logx.Logger) Store {
+	return &fallbackStore{cache: cache, repo: convRepo, logger: logger}
+}
+
+func key(chatID, userID int64) string {
+	return fmt.Sprintf("conv:%d:%d", chatID, userID)
+}
+
+var errNoBackend = errors.New("conversation store: no redis nor mongo available")
+
+func (s *fallbackStore) Load(ctx context.Context, chatID, userID int64) (*entities.ConversationEntity, error) {
+	if s.cache != nil {
+		var c entities.ConversationEntity
+		ok, err := s.cache.GetJSON(ctx, key(chatID, userID), &c)
+		if err == nil {
+			if !ok {
+				return nil, nil
+			}
+			return &c, nil
+		}
+		s.logger.Warnf("conversation load from redis: %v (fallback to mongo)", err)
+	}
+	if s.repo == nil {
+		return nil, errNoBackend
+	}
+	c, err := s.repo.FindByChatAndUser(ctx, chatID, userID)
+	if errors.Is(err, repo.ConversationErrNotFound) {
+		return nil, nil
+	}
+	return c, err
+}
+
+func (s *fallbackStore) Save(ctx context.Context, c *entities.ConversationEntity) error {
+	if s.cache != nil {
+		ttl := time.Until(c.ExpiresAt) + redisGrace
+		err := s.cache.SetJSON(ctx, key(c.ChatID, c.UserID), c, ttl)
+		if err == nil {
+			return nil
+		}
+		s.logger.Warnf("conversation save to redis: %v (fallback to mongo)", err)
+	}
+	if s.repo == nil {
+		return errNoBackend
+	}
+	return s.repo.UpsertByChatAndUser(ctx, c)
+}
+
+func (s *fallbackStore) Delete(ctx context.Context, chatID, userID int64) error {
+	var errs []error
+	if s.cache != nil {
+		if _, err := s.cache.Delete(ctx, key(chatID, userID)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	// also clean Mongo: the conversation may have been saved there during a Redis outage
+	if s.repo != nil {
+		if err := s.repo.DeleteByChatAndUser(ctx, chatID, userID); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
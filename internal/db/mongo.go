@@ -5,6 +5,7 @@ import (
 	"errors"
 	"time"
 
+	"github.com/frangi01/bbtelgo/internal/analytics"
 	"github.com/frangi01/bbtelgo/internal/config"
 	"github.com/frangi01/bbtelgo/internal/logx"
 	"github.com/frangi01/bbtelgo/internal/repo"
@@ -78,20 +79,38 @@ func NewDBClient(ctx context.Context, config config.MongoCfg) (*mongo.Client, er
 }
 
 type RepositoryList struct {
-	UserRepository 		*repo.UserRepository
-	MessageRepository 	*repo.MessageRepository
+	UserRepository 			repo.UserStore
+	MessageRepository 		repo.MessageStore
+	ConversationRepository	*repo.ConversationRepository
+	CampaignRepository		*repo.CampaignRepository
+	DeliveryRepository		*repo.DeliveryRepository
+	AuditRepository			*repo.AuditRepository
+	ChatRepository			*repo.ChatRepository
+	Analytics				*analytics.Service // aggregations, Mongo only
 }
 
-func NewRepositoryList(config config.MongoCfg, client *mongo.Client, logger *logx.Logger) (*RepositoryList, error) {
-	userrepo, err := repo.NewUserRepository(client, config.DB)
-	if err != nil {
-		logger.Errorf("repo init: %v", err)
+// NewRepositoryList binds the repositories to config.DB; run the migrations first
+// (migrations.Runner), they own the indexes. logger reports the audit records that could
+// not be written.
+func NewRepositoryList(config config.MongoCfg, client *mongo.Client, logger *logx.Logger) *RepositoryList {
+	audit := repo.NewAuditRepository(client, config.DB, logger)
+	return &RepositoryList{
+		UserRepository: repo.NewUserRepository(client, config.DB, audit),
+		MessageRepository: repo.NewMessageRepository(client, config.DB, audit),
+		ConversationRepository: repo.NewConversationRepository(client, config.DB),
+		CampaignRepository: repo.NewCampaignRepository(client, config.DB),
+		DeliveryRepository: repo.NewDeliveryRepository(client, config.DB),
+		AuditRepository: audit,
+		ChatRepository: repo.NewChatRepository(client, config.DB),
+		Analytics: analytics.New(client, config.DB),
 	}
+}
 
-	msgrepo, err := repo.NewMessageRepository(client, config.DB)
-	if err != nil {
-		logger.Errorf("repo init: %v", err)
+// NewMemoryRepositoryList keeps users and messages in memory (tests, lightweight deployments);
+// the other repositories are nil, so the features built on them are off.
+func NewMemoryRepositoryList() *RepositoryList {
+	return &RepositoryList{
+		UserRepository: repo.NewMemoryUserRepository(),
+		MessageRepository: repo.NewMemoryMessageRepository(),
 	}
-
-	return &RepositoryList{UserRepository: userrepo, MessageRepository: msgrepo}, err
 }
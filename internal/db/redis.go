@@ -201,6 +201,36 @@ func (c *CacheClient) RateLimitSlidingWindow(ctx context.Context, key string, li
 	return allowed, remaining, resetAt, nil
 }
 
+// --- TOKEN BUCKET (Lua, shared across replicas) ---
+
+var tokenBucketScript = redis.NewScript(`
+local rate   = tonumber(ARGV[1])
+local burst  = tonumber(ARGV[2])
+local now    = tonumber(ARGV[3])
+local state  = redis.call("hmget", KEYS[1], "tokens", "ts")
+local tokens = tonumber(state[1]) or burst
+local ts     = tonumber(state[2]) or now
+tokens = math.min(burst, tokens + (math.max(0, now - ts) / 1000) * rate)
+local wait = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+else
+  wait = math.ceil((1 - tokens) / rate * 1000)
+end
+redis.call("hset", KEYS[1], "tokens", tokens, "ts", now)
+redis.call("pexpire", KEYS[1], math.ceil(burst / rate * 1000) + 1000)
+return wait`)
+
+// TakeToken takes one token from the bucket at key (rate tokens/s, up to burst).
+// Returns 0 if taken, otherwise how long to wait before trying again.
+func (c *CacheClient) TakeToken(ctx context.Context, key string, rate float64, burst int) (time.Duration, error) {
+	ms, err := tokenBucketScript.Run(ctx, c.RDB, []string{"tb:" + key}, rate, burst, time.Now().UnixMilli()).Int64()
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
 // --- DISTRIBUTED LOCK (safe with Lua) ---
 
 var unlockScript = redis.NewScript(`
@@ -210,6 +240,13 @@ else
   return 0
 end`)
 
+var extendScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+  return redis.call("pexpire", KEYS[1], ARGV[2])
+else
+  return 0
+end`)
+
 // AcquireLock tries to acquire a lock with a value (token) and TTL
 // true if obtained, false if already locked.
 func (c *CacheClient) AcquireLock(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
@@ -224,16 +261,27 @@ func (c *CacheClient) ReleaseLock(ctx context.Context, key, value string) (bool,
 	return n == 1, err
 }
 
+// ExtendLock resets the TTL of the lock only if the value matches;
+// false if the lock expired or was taken by someone else.
+func (c *CacheClient) ExtendLock(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	n, err := extendScript.Run(ctx, c.RDB, []string{key}, value, ttl.Milliseconds()).Int()
+	return n == 1, err
+}
+
 // --- SCAN / DELETE by prefix ---
 
 // ScanPrefix returns keys with a certain prefix (uses SCAN, does not block).
 func (c *CacheClient) ScanPrefix(ctx context.Context, prefix string, count int64) ([]string, error) {
+	return c.ScanMatch(ctx, prefix+"*", count)
+}
+
+// ScanMatch returns keys matching a glob pattern, e.g. "sess:*:42" (uses SCAN).
+func (c *CacheClient) ScanMatch(ctx context.Context, pat string, count int64) ([]string, error) {
 	var (
 		cursor uint64
 		keys   []string
 		err    error
 	)
-	pat := prefix + "*"
 	for {
 		var batch []string
 		batch, cursor, err = c.RDB.Scan(ctx, cursor, pat, count).Result()
@@ -248,6 +296,34 @@ func (c *CacheClient) ScanPrefix(ctx context.Context, prefix string, count int64
 	return keys, nil
 }
 
+// Dump reads key whatever its type (string, hash, list, set, zset with scores), for exports.
+// It returns nil for missing keys.
+func (c *CacheClient) Dump(ctx context.Context, key string) (any, error) {
+	typ, err := c.RDB.Type(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	switch typ {
+	case "none":
+		return nil, nil
+	case "string":
+		v, err := c.RDB.Get(ctx, key).Result()
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return v, err
+	case "hash":
+		return c.RDB.HGetAll(ctx, key).Result()
+	case "list":
+		return c.RDB.LRange(ctx, key, 0, -1).Result()
+	case "set":
+		return c.RDB.SMembers(ctx, key).Result()
+	case "zset":
+		return c.RDB.ZRangeWithScores(ctx, key, 0, -1).Result()
+	}
+	return nil, fmt.Errorf("redis: dump %s: unsupported type %s", key, typ)
+}
+
 // DeleteByPrefix deletes all keys with a prefix (caution in production).
 func (c *CacheClient) DeleteByPrefix(ctx context.Context, prefix string, count int64) (int64, error) {
 	keys, err := c.ScanPrefix(ctx, prefix, count)
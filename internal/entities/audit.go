@@ -0,0 +1,30 @@
+package entities
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type AuditOutcome string
+
+const (
+	AuditAllowed AuditOutcome = "allowed"
+	AuditDenied  AuditOutcome = "denied"
+	AuditFailed  AuditOutcome = "failed"
+)
+
+// AuditEntity is an append-only record of a sensitive action (collection "audit_log").
+type AuditEntity struct {
+	MongoID        	primitive.ObjectID 	`bson:"_id,omitempty" json:"id"`
+	Action			string				`bson:"action" json:"action"`                           // e.g. "command:/admin", "user.ban"
+	ActorID			int64				`bson:"actorId,omitempty" json:"actorId,omitempty"`     // Telegram ID of who did it (0 = the bot)
+	TargetID		int64				`bson:"targetId,omitempty" json:"targetId,omitempty"`   // Telegram ID of the subject, if any
+	ChatID			int64				`bson:"chatId,omitempty" json:"chatId,omitempty"`
+	Outcome			AuditOutcome		`bson:"outcome" json:"outcome"`
+	Collection		string				`bson:"collection,omitempty" json:"collection,omitempty"` // changes made by the repositories:
+	DocumentID		primitive.ObjectID	`bson:"documentId,omitempty" json:"documentId,omitempty"` // the document changed
+	Fields			[]string			`bson:"fields,omitempty" json:"fields,omitempty"`         // and the bson keys written
+	Details			map[string]any		`bson:"details,omitempty" json:"details,omitempty"`
+	CreatedAt 		time.Time          	`bson:"createdAt" json:"createdAt"`
+}
@@ -0,0 +1,73 @@
+package entities
+
+import (
+	"time"
+
+	"github.com/go-telegram/bot/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type CampaignStatus string
+
+const (
+	CampaignDraft     CampaignStatus = "draft"
+	CampaignRunning   CampaignStatus = "running"
+	CampaignPaused    CampaignStatus = "paused"
+	CampaignCancelled CampaignStatus = "cancelled"
+	CampaignCompleted CampaignStatus = "completed"
+)
+
+// UserFilter selects the recipients of a campaign (empty = every reachable user).
+type UserFilter struct {
+	LanguageCodes  []string `bson:"languageCodes,omitempty" json:"languageCodes,omitempty"`
+	TelegramIDs    []int64  `bson:"telegramIds,omitempty" json:"telegramIds,omitempty"`
+	IncludeBlocked bool     `bson:"includeBlocked" json:"includeBlocked"`
+	IncludeDeleted bool     `bson:"-" json:"-"` // soft-deleted users too (GDPR), never stored with a campaign
+}
+
+type CampaignStats struct {
+	Total   int64 `bson:"total" json:"total"`
+	Sent    int64 `bson:"sent" json:"sent"`
+	Blocked int64 `bson:"blocked" json:"blocked"`
+	Failed  int64 `bson:"failed" json:"failed"`
+}
+
+// CampaignEntity is a message broadcast to the stored users.
+// With PhotoFileID set the message is a photo and Text its caption.
+type CampaignEntity struct {
+	MongoID        	primitive.ObjectID 				`bson:"_id,omitempty" json:"id"`
+	Text			string							`bson:"text" json:"text"`
+	ParseMode		models.ParseMode				`bson:"parseMode,omitempty" json:"parseMode,omitempty"`
+	PhotoFileID		string							`bson:"photoFileId,omitempty" json:"photoFileId,omitempty"`
+	Keyboard		*models.InlineKeyboardMarkup	`bson:"keyboard,omitempty" json:"keyboard,omitempty"`
+	Filter			UserFilter						`bson:"filter" json:"filter"`
+	Status			CampaignStatus					`bson:"status" json:"status"`
+	Stats			CampaignStats					`bson:"stats" json:"stats"`
+	CreatedBy		int64							`bson:"createdBy,omitempty" json:"createdBy,omitempty"`
+	StartedAt		*time.Time						`bson:"startedAt,omitempty" json:"startedAt,omitempty"`
+	FinishedAt		*time.Time						`bson:"finishedAt,omitempty" json:"finishedAt,omitempty"`
+	CreatedAt 		time.Time          				`bson:"createdAt" json:"createdAt"`
+	UpdatedAt 		time.Time          				`bson:"updatedAt" json:"updatedAt"`
+}
+
+type DeliveryStatus string
+
+const (
+	DeliveryPending DeliveryStatus = "pending"
+	DeliverySending DeliveryStatus = "sending" // claimed by a worker, see DeliveryRepository.Claim
+	DeliverySent    DeliveryStatus = "sent"
+	DeliveryBlocked DeliveryStatus = "blocked"
+	DeliveryFailed  DeliveryStatus = "failed"
+)
+
+// DeliveryEntity tracks the campaign message of one user.
+type DeliveryEntity struct {
+	MongoID        	primitive.ObjectID 	`bson:"_id,omitempty" json:"id"`
+	CampaignID		primitive.ObjectID	`bson:"campaignId" json:"campaignId"`
+	UserID			int64				`bson:"userId" json:"userId"`
+	Status			DeliveryStatus		`bson:"status" json:"status"`
+	MessageID		int					`bson:"messageId,omitempty" json:"messageId,omitempty"`
+	Error			string				`bson:"error,omitempty" json:"error,omitempty"`
+	CreatedAt 		time.Time          	`bson:"createdAt" json:"createdAt"`
+	UpdatedAt 		time.Time          	`bson:"updatedAt" json:"updatedAt"`
+}
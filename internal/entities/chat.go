@@ -0,0 +1,42 @@
+package entities
+
+import (
+	"time"
+
+	"github.com/go-telegram/bot/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ChatStatus is the membership of the bot in a chat.
+type ChatStatus string
+
+const (
+	ChatMember   ChatStatus = "member"
+	ChatAdmin    ChatStatus = "administrator" // promoted
+	ChatLeft     ChatStatus = "left"
+	ChatKicked   ChatStatus = "kicked"
+	ChatMigrated ChatStatus = "migrated" // group upgraded to the supergroup MigratedTo
+)
+
+// Active reports whether the bot is still in the chat.
+func (s ChatStatus) Active() bool {
+	return s == ChatMember || s == ChatAdmin
+}
+
+// ChatEntity is a group, supergroup or channel the bot has been added to.
+type ChatEntity struct {
+	MongoID        	primitive.ObjectID 	`bson:"_id,omitempty" json:"id"`
+	ChatID			int64				`bson:"chatId" json:"chatId"`
+	Type			models.ChatType		`bson:"type" json:"type"`
+	Title			string				`bson:"title,omitempty" json:"title,omitempty"`
+	Username		string				`bson:"username,omitempty" json:"username,omitempty"`
+	Status			ChatStatus			`bson:"status" json:"status"`
+	StatusBy		int64				`bson:"statusBy,omitempty" json:"statusBy,omitempty"` // who added/removed/promoted the bot
+	StatusAt		*time.Time			`bson:"statusAt,omitempty" json:"statusAt,omitempty"`
+	JoinedAt		*time.Time			`bson:"joinedAt,omitempty" json:"joinedAt,omitempty"` // last time the bot was added
+	LeftAt			*time.Time			`bson:"leftAt,omitempty" json:"leftAt,omitempty"`     // last time the bot left or was kicked
+	MigratedTo		int64				`bson:"migratedTo,omitempty" json:"migratedTo,omitempty"`
+	MigratedFrom	int64				`bson:"migratedFrom,omitempty" json:"migratedFrom,omitempty"`
+	CreatedAt 		time.Time          	`bson:"createdAt" json:"createdAt"`
+	UpdatedAt 		time.Time          	`bson:"updatedAt" json:"updatedAt"`
+}
@@ -0,0 +1,20 @@
+package entities
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ConversationEntity is the state of a multi-step dialog of one user in one chat.
+type ConversationEntity struct {
+	MongoID        	primitive.ObjectID 	`bson:"_id,omitempty" json:"id"`
+	ChatID			int64				`bson:"chatId" json:"chatId"`
+	UserID			int64				`bson:"userId" json:"userId"`
+	Flow			string				`bson:"flow" json:"flow"`
+	State			string				`bson:"state" json:"state"`
+	Data			map[string]string	`bson:"data" json:"data"`
+	ExpiresAt		time.Time			`bson:"expiresAt" json:"expiresAt"`
+	CreatedAt 		time.Time          	`bson:"createdAt" json:"createdAt"`
+	UpdatedAt 		time.Time          	`bson:"updatedAt" json:"updatedAt"`
+}
@@ -7,9 +7,18 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+type MessageDirection string
+
+const (
+	DirectionIn  MessageDirection = "in"  // received from a user/chat
+	DirectionOut MessageDirection = "out" // sent by the bot
+)
+
 type MessageEntity struct {
 	MongoID        	primitive.ObjectID 	`bson:"_id,omitempty" json:"id"`
 	models.Message 						`bson:",inline" json:",inline"`
+	Direction		MessageDirection	`bson:"direction,omitempty" json:"direction,omitempty"`
+	DeletedAt		*time.Time			`bson:"deletedAt,omitempty" json:"deletedAt,omitempty"` // soft-deleted (see MessageRepository.Delete)
 	CreatedAt 		time.Time          	`bson:"createdAt" json:"createdAt"`
 	UpdatedAt 		time.Time          	`bson:"updatedAt" json:"updatedAt"`
-}
\ No newline at end of file
+}
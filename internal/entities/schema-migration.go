@@ -0,0 +1,10 @@
+package entities
+
+import "time"
+
+// SchemaMigrationEntity records an applied migration (collection "schema_migrations").
+type SchemaMigrationEntity struct {
+	Version			int			`bson:"_id" json:"version"`
+	Name			string		`bson:"name" json:"name"`
+	AppliedAt		time.Time	`bson:"appliedAt" json:"appliedAt"`
+}
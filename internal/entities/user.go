@@ -1,15 +1,53 @@
 package entities
 
 import (
+	"slices"
 	"time"
 
 	"github.com/go-telegram/bot/models"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+type Role string
+
+const (
+	RoleAdmin     Role = "admin"
+	RoleModerator Role = "moderator"
+	RoleUser      Role = "user"
+)
+
+// UserEntity: the Telegram fields are refreshed on every upsert, the bot-owned
+// profile fields below them only change through the dedicated repository methods.
 type UserEntity struct {
 	MongoID        	primitive.ObjectID 	`bson:"_id,omitempty" json:"id"`
 	models.User 						`bson:",inline" json:",inline"`
+	Language		string				`bson:"language,omitempty" json:"language,omitempty"`     // preferred language, overrides LanguageCode
+	Roles			[]Role				`bson:"roles,omitempty" json:"roles,omitempty"`
+	Blocked			bool				`bson:"blocked,omitempty" json:"blocked,omitempty"`     // the user blocked the bot (403)
+	BlockedAt		*time.Time			`bson:"blockedAt,omitempty" json:"blockedAt,omitempty"`
+	Banned			bool				`bson:"banned,omitempty" json:"banned,omitempty"`       // banned by an admin
+	BannedAt		*time.Time			`bson:"bannedAt,omitempty" json:"bannedAt,omitempty"`
+	BanReason		string				`bson:"banReason,omitempty" json:"banReason,omitempty"`
+	LastSeenAt		*time.Time			`bson:"lastSeenAt,omitempty" json:"lastSeenAt,omitempty"`
+	ReferralSource	string				`bson:"referralSource,omitempty" json:"referralSource,omitempty"` // /start payload of the first visit
+	Settings		map[string]any		`bson:"settings,omitempty" json:"settings,omitempty"`
+	DeletedAt		*time.Time			`bson:"deletedAt,omitempty" json:"deletedAt,omitempty"` // soft-deleted (see UserRepository.Delete)
 	CreatedAt 		time.Time          	`bson:"createdAt" json:"createdAt"`
 	UpdatedAt 		time.Time          	`bson:"updatedAt" json:"updatedAt"`
-}
\ No newline at end of file
+}
+
+// ProfileFields are the bson keys owned by the bot, never taken from the Telegram payload.
+var ProfileFields = []string{"language", "roles", "blocked", "blockedAt", "banned", "bannedAt", "banReason", "lastSeenAt", "referralSource", "settings"}
+
+// Lang returns the preferred language, or the one of the Telegram client.
+func (u *UserEntity) Lang() string {
+	if u.Language != "" {
+		return u.Language
+	}
+	return u.LanguageCode
+}
+
+// HasRole reports whether the user has r (every user has RoleUser).
+func (u *UserEntity) HasRole(r Role) bool {
+	return r == RoleUser || slices.Contains(u.Roles, r)
+}
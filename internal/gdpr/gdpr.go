@@ -0,0 +1,331 @@
+package gdpr
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/frangi01/bbtelgo/internal/db"
+	"github.com/frangi01/bbtelgo/internal/entities"
+	"github.com/frangi01/bbtelgo/internal/logx"
+	"github.com/frangi01/bbtelgo/internal/repo"
+)
+
+// Format of an export.
+type Format string
+
+const (
+	FormatJSON Format = "json" // one JSON document
+	FormatZIP  Format = "zip"  // user.json, messages.jsonl, cache.json
+)
+
+const scanCount = 100
+
+// cacheKeys are the Redis keys holding data of a user (%[1]d = Telegram ID): sessions
+// (any scope), conversations, rate-limit counters of the private chat, role cache.
+var cacheKeys = []string{
+	"sess:user:%[1]d",
+	"sess:chat:%[1]d",
+	"sess:*:%[1]d",
+	"conv:*:%[1]d",
+	"rl:rl:user:%[1]d:msg:*",
+	"rl:sw:rl:user:%[1]d:msg",
+	"rbac:user:%[1]d",
+}
+
+// Service exports and erases the personal data of a user across Mongo and Redis.
+type Service struct {
+	users         repo.UserStore
+	messages      repo.MessageStore
+	conversations *repo.ConversationRepository
+	deliveries    *repo.DeliveryRepository
+	audit         *repo.AuditRepository
+	cache         *db.CacheClient
+	logger        *logx.Logger
+}
+
+// New: every store but users and messages is optional (nil = nothing stored there).
+func New(repositoryList *db.RepositoryList, cache *db.CacheClient, logger *logx.Logger) *Service {
+	return &Service{
+		users:         repositoryList.UserRepository,
+		messages:      repositoryList.MessageRepository,
+		conversations: repositoryList.ConversationRepository,
+		deliveries:    repositoryList.DeliveryRepository,
+		audit:         repositoryList.AuditRepository,
+		cache:         cache,
+		logger:        logger,
+	}
+}
+
+// Header is the first part of an export.
+type Header struct {
+	UserID      int64                `json:"userId"`
+	GeneratedAt time.Time            `json:"generatedAt"`
+	User        *entities.UserEntity `json:"user"` // nil if the user is not stored
+}
+
+// Export writes the data of userID to w: the UserEntity, the messages of their private
+// chat with the bot and the ones they sent elsewhere, and their Redis keys.
+// actorID is who asked for it (the user or an admin), for the audit log.
+func (s *Service) Export(ctx context.Context, w io.Writer, userID, actorID int64, format Format) error {
+	header := Header{UserID: userID, GeneratedAt: time.Now().UTC()}
+	// soft-deleted data is still held, so it is exported too
+	filter := entities.UserFilter{TelegramIDs: []int64{userID}, IncludeBlocked: true, IncludeDeleted: true}
+	err := s.users.Iterate(ctx, filter, func(u *entities.UserEntity) error {
+		header.User = u
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("gdpr: user %d: %w", userID, err)
+	}
+	cache, err := s.cacheData(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case FormatZIP:
+		err = s.writeZIP(ctx, w, header, cache)
+	case FormatJSON:
+		err = s.writeJSON(ctx, w, header, cache)
+	default:
+		err = fmt.Errorf("gdpr: unknown format %q", format)
+	}
+	if err != nil {
+		return err
+	}
+	s.record(ctx, &entities.AuditEntity{
+		Action:   "gdpr.export",
+		ActorID:  actorID,
+		TargetID: userID,
+		Outcome:  entities.AuditAllowed,
+		Details:  map[string]any{"format": format},
+	})
+	return nil
+}
+
+func (s *Service) writeJSON(ctx context.Context, w io.Writer, header Header, cache map[string]any) error {
+	// streamed by hand: the messages can be many
+	head, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "%s,\"messages\":[", head[:len(head)-1]); err != nil {
+		return err
+	}
+	first := true
+	err = s.eachMessage(ctx, header.UserID, func(m *entities.MessageEntity) error {
+		b, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		if !first {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		first = false
+		_, err = w.Write(b)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	tail, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "],\"cache\":%s}\n", tail)
+	return err
+}
+
+func (s *Service) writeZIP(ctx context.Context, w io.Writer, header Header, cache map[string]any) error {
+	zw := zip.NewWriter(w)
+	writeFile := func(name string, write func(io.Writer) error) error {
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: header.GeneratedAt})
+		if err != nil {
+			return err
+		}
+		return write(f)
+	}
+	indented := func(v any) func(io.Writer) error {
+		return func(f io.Writer) error {
+			enc := json.NewEncoder(f)
+			enc.SetIndent("", "  ")
+			return enc.Encode(v)
+		}
+	}
+
+	if err := writeFile("user.json", indented(header)); err != nil {
+		return err
+	}
+	err := writeFile("messages.jsonl", func(f io.Writer) error {
+		enc := json.NewEncoder(f)
+		return s.eachMessage(ctx, header.UserID, func(m *entities.MessageEntity) error {
+			return enc.Encode(m)
+		})
+	})
+	if err != nil {
+		return err
+	}
+	if err := writeFile("cache.json", indented(cache)); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// eachMessage streams the private chat with the bot (both directions), then the
+// messages sent by userID in other chats.
+func (s *Service) eachMessage(ctx context.Context, userID int64, fn func(m *entities.MessageEntity) error) error {
+	if err := s.messages.Iterate(ctx, repo.MessageFilter{ChatID: &userID, IncludeDeleted: true}, fn); err != nil {
+		return fmt.Errorf("gdpr: messages of chat %d: %w", userID, err)
+	}
+	err := s.messages.Iterate(ctx, repo.MessageFilter{FromID: &userID, IncludeDeleted: true}, func(m *entities.MessageEntity) error {
+		if m.Chat.ID == userID {
+			return nil
+		}
+		return fn(m)
+	})
+	if err != nil {
+		return fmt.Errorf("gdpr: messages from %d: %w", userID, err)
+	}
+	return nil
+}
+
+// keys lists the Redis keys of userID.
+func (s *Service) keys(ctx context.Context, userID int64) ([]string, error) {
+	if s.cache == nil {
+		return nil, nil
+	}
+	seen := map[string]bool{}
+	var out []string
+	for _, pattern := range cacheKeys {
+		keys, err := s.cache.ScanMatch(ctx, fmt.Sprintf(pattern, userID), scanCount)
+		if err != nil {
+			return nil, fmt.Errorf("gdpr: scan redis keys of %d: %w", userID, err)
+		}
+		for _, k := range keys {
+			if !seen[k] {
+				seen[k] = true
+				out = append(out, k)
+			}
+		}
+	}
+	return out, nil
+}
+
+func (s *Service) cacheData(ctx context.Context, userID int64) (map[string]any, error) {
+	keys, err := s.keys(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]any, len(keys))
+	for _, k := range keys {
+		v, err := s.cache.Dump(ctx, k)
+		if err != nil {
+			return nil, fmt.Errorf("gdpr: read redis key %s: %w", k, err)
+		}
+		if v != nil {
+			out[k] = v
+		}
+	}
+	return out, nil
+}
+
+// ErasureReport counts what Erase removed.
+type ErasureReport struct {
+	User          bool  `json:"user"`
+	Messages      int64 `json:"messages"`   // private chat with the bot, deleted
+	Anonymized    int64 `json:"anonymized"` // sent in groups/channels, sender replaced
+	Conversations int64 `json:"conversations"`
+	Deliveries    int64 `json:"deliveries"`
+	CacheKeys     int64 `json:"cacheKeys"`
+}
+
+// Erase deletes the data of userID: the UserEntity, the private chat transcript, open
+// conversations, campaign deliveries and Redis keys; the messages sent in groups are kept
+// for the other members but anonymized (repo.AnonymousSender). The audit log is kept
+// (it records the erasure itself). Soft-deleted data is erased as well.
+// Ask for confirmation before calling it.
+func (s *Service) Erase(ctx context.Context, userID, actorID int64) (ErasureReport, error) {
+	ctx = repo.WithActor(ctx, actorID)
+	var report ErasureReport
+	fail := func(step string, err error) (ErasureReport, error) {
+		s.record(ctx, &entities.AuditEntity{
+			Action:   "gdpr.erase",
+			ActorID:  actorID,
+			TargetID: userID,
+			Outcome:  entities.AuditFailed,
+			Details:  map[string]any{"step": step, "error": err.Error()},
+		})
+		return report, fmt.Errorf("gdpr: erase %d: %s: %w", userID, step, err)
+	}
+
+	var err error
+	if report.Messages, err = s.messages.DeleteMany(ctx, repo.MessageFilter{ChatID: &userID}); err != nil {
+		return fail("messages", err)
+	}
+	if report.Anonymized, err = s.messages.AnonymizeSender(ctx, userID); err != nil {
+		return fail("anonymize", err)
+	}
+	if s.conversations != nil {
+		if report.Conversations, err = s.conversations.DeleteByUser(ctx, userID); err != nil {
+			return fail("conversations", err)
+		}
+	}
+	if s.deliveries != nil {
+		if report.Deliveries, err = s.deliveries.DeleteByUser(ctx, userID); err != nil {
+			return fail("deliveries", err)
+		}
+	}
+
+	keys, err := s.keys(ctx, userID)
+	if err != nil {
+		return fail("cache", err)
+	}
+	if len(keys) > 0 {
+		if report.CacheKeys, err = s.cache.Delete(ctx, keys...); err != nil {
+			return fail("cache", err)
+		}
+	}
+
+	// the user last: a failure above leaves them findable for a retry
+	err = s.users.PurgeByTelegramID(ctx, userID)
+	switch {
+	case errors.Is(err, repo.UserErrNotFound):
+	case err != nil:
+		return fail("user", err)
+	default:
+		report.User = true
+	}
+
+	s.logger.Infof("gdpr: user %d erased by %d: %+v", userID, actorID, report)
+	s.record(ctx, &entities.AuditEntity{
+		Action:   "gdpr.erase",
+		ActorID:  actorID,
+		TargetID: userID,
+		Outcome:  entities.AuditAllowed,
+		Details: map[string]any{
+			"user":          report.User,
+			"messages":      report.Messages,
+			"anonymized":    report.Anonymized,
+			"conversations": report.Conversations,
+			"deliveries":    report.Deliveries,
+			"cacheKeys":     report.CacheKeys,
+		},
+	})
+	return report, nil
+}
+
+func (s *Service) record(ctx context.Context, entry *entities.AuditEntity) {
+	if s.audit == nil {
+		return
+	}
+	if err := s.audit.Append(ctx, entry); err != nil {
+		s.logger.Errorf("gdpr: audit %s %d: %v", entry.Action, entry.TargetID, err)
+	}
+}
@@ -0,0 +1,183 @@
+package gdpr
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/frangi01/bbtelgo/internal/db"
+	"github.com/frangi01/bbtelgo/internal/entities"
+	"github.com/frangi01/bbtelgo/internal/logx"
+	"github.com/frangi01/bbtelgo/internal/repo"
+	"github.com/go-telegram/bot/models"
+)
+
+const (
+	userID  = 1
+	otherID = 2
+	groupID = -100
+)
+
+// newTestService stores userID and otherID, a private chat of each with the bot and a
+// group where both wrote.
+func newTestService(t *testing.T) (*Service, repo.UserStore, repo.MessageStore) {
+	t.Helper()
+	logger, err := logx.New(filepath.Join(t.TempDir(), "test.log"), logx.Options{})
+	if err != nil {
+		t.Fatalf("logger: %v", err)
+	}
+	t.Cleanup(func() { _ = logger.Close() })
+
+	users, messages := repo.NewMemoryUserRepository(), repo.NewMemoryMessageRepository()
+	ctx := context.Background()
+	for id, name := range map[int64]string{userID: "me", otherID: "other"} {
+		if _, err := users.Create(ctx, &entities.UserEntity{User: models.User{ID: id, FirstName: name}}); err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+	}
+	for _, m := range []models.Message{
+		{ID: 1, Chat: models.Chat{ID: userID, Type: models.ChatTypePrivate}, From: &models.User{ID: userID}, Text: "hi bot"},
+		{ID: 2, Chat: models.Chat{ID: userID, Type: models.ChatTypePrivate}, From: &models.User{ID: 999, IsBot: true}, Text: "hi user"},
+		{ID: 1, Chat: models.Chat{ID: otherID, Type: models.ChatTypePrivate}, From: &models.User{ID: otherID}, Text: "other private"},
+		{ID: 1, Chat: models.Chat{ID: groupID, Type: models.ChatTypeSupergroup}, From: &models.User{ID: userID}, Text: "in the group"},
+		{ID: 2, Chat: models.Chat{ID: groupID, Type: models.ChatTypeSupergroup}, From: &models.User{ID: otherID}, Text: "other in the group"},
+	} {
+		if _, err := messages.Create(ctx, &entities.MessageEntity{Message: m}); err != nil {
+			t.Fatalf("create message: %v", err)
+		}
+	}
+	s := New(&db.RepositoryList{UserRepository: users, MessageRepository: messages}, nil, logger)
+	return s, users, messages
+}
+
+type export struct {
+	UserID   int64                    `json:"userId"`
+	User     *entities.UserEntity     `json:"user"`
+	Messages []entities.MessageEntity `json:"messages"`
+	Cache    map[string]any           `json:"cache"`
+}
+
+func exportedTexts(messages []entities.MessageEntity) []string {
+	texts := make([]string, len(messages))
+	for i, m := range messages {
+		texts[i] = m.Text
+	}
+	slices.Sort(texts)
+	return texts
+}
+
+var wantExported = []string{"hi bot", "hi user", "in the group"}
+
+func TestExportJSON(t *testing.T) {
+	s, _, _ := newTestService(t)
+	var buf bytes.Buffer
+	if err := s.Export(context.Background(), &buf, userID, userID, FormatJSON); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+
+	var got export
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("export is not valid JSON: %v\n%s", err, buf.String())
+	}
+	if got.UserID != userID || got.User == nil || got.User.FirstName != "me" {
+		t.Fatalf("header = %d %+v, want user %d", got.UserID, got.User, userID)
+	}
+	if texts := exportedTexts(got.Messages); !slices.Equal(texts, wantExported) {
+		t.Fatalf("messages = %q, want %q", texts, wantExported)
+	}
+}
+
+func TestExportZIP(t *testing.T) {
+	s, _, _ := newTestService(t)
+	var buf bytes.Buffer
+	if err := s.Export(context.Background(), &buf, userID, userID, FormatZIP); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("export is not a zip: %v", err)
+	}
+	var names []string
+	var messages []entities.MessageEntity
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+		if f.Name != "messages.jsonl" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("open %s: %v", f.Name, err)
+		}
+		dec := json.NewDecoder(rc)
+		for {
+			var m entities.MessageEntity
+			if err := dec.Decode(&m); errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				t.Fatalf("decode %s: %v", f.Name, err)
+			}
+			messages = append(messages, m)
+		}
+		rc.Close()
+	}
+	if want := []string{"user.json", "messages.jsonl", "cache.json"}; !slices.Equal(names, want) {
+		t.Fatalf("files = %v, want %v", names, want)
+	}
+	if texts := exportedTexts(messages); !slices.Equal(texts, wantExported) {
+		t.Fatalf("messages = %q, want %q", texts, wantExported)
+	}
+}
+
+func TestExportUnknownFormat(t *testing.T) {
+	s, _, _ := newTestService(t)
+	if err := s.Export(context.Background(), io.Discard, userID, userID, "xml"); err == nil {
+		t.Fatal("export with an unknown format succeeded")
+	}
+}
+
+func TestErase(t *testing.T) {
+	s, users, messages := newTestService(t)
+	ctx := context.Background()
+
+	report, err := s.Erase(ctx, userID, userID)
+	if err != nil {
+		t.Fatalf("erase: %v", err)
+	}
+	if !report.User || report.Messages != 2 || report.Anonymized != 1 {
+		t.Fatalf("report = %+v, want the user, 2 messages and 1 anonymized", report)
+	}
+
+	if _, err := users.FindByTelegramID(ctx, userID); !errors.Is(err, repo.UserErrNotFound) {
+		t.Fatalf("erased user: %v, want UserErrNotFound", err)
+	}
+	if _, err := messages.FindByChatAndMessageID(ctx, userID, 1); !errors.Is(err, repo.MessageErrNotFound) {
+		t.Fatalf("private message: %v, want MessageErrNotFound", err)
+	}
+	m, err := messages.FindByChatAndMessageID(ctx, groupID, 1)
+	if err != nil || m.From == nil || *m.From != repo.AnonymousSender {
+		t.Fatalf("group message: %+v, %v, want it kept with an anonymous sender", m, err)
+	}
+
+	// nothing of the other user is touched
+	if _, err := users.FindByTelegramID(ctx, otherID); err != nil {
+		t.Fatalf("other user: %v", err)
+	}
+	for _, key := range [][2]int64{{otherID, 1}, {groupID, 2}} {
+		m, err := messages.FindByChatAndMessageID(ctx, key[0], int(key[1]))
+		if err != nil || m.From == nil || m.From.ID != otherID {
+			t.Fatalf("message %v of the other user: %+v, %v", key, m, err)
+		}
+	}
+
+	// a second erase finds nothing left
+	if report, err := s.Erase(ctx, userID, userID); err != nil || report.User || report.Messages != 0 || report.Anonymized != 0 {
+		t.Fatalf("second erase = %+v, %v, want an empty report", report, err)
+	}
+}
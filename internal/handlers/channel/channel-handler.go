@@ -0,0 +1,72 @@
+package channel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/frangi01/bbtelgo/internal/utils"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+
+// HandleFunc is a route handler: returned errors go to the dispatcher error handler.
+type HandleFunc func(ctx context.Context, b *bot.Bot, u *models.Update, _ []string, deps *utils.HandlerDeps, lang string) error
+
+
+var routes = map[string]HandleFunc{
+	"/ping": 	pingHandler,
+}
+
+var callbackRoutes = map[string]HandleFunc{}
+
+
+// HandlerPost handles channel posts. Posts have no sender user, so the default
+// language is used; commands addressed to other bots are skipped.
+func HandlerPost(ctx context.Context, b *bot.Bot, update *models.Update, handlerDeps *utils.HandlerDeps) error {
+	post := update.ChannelPost
+	if post.Text == "" {
+		return nil
+	}
+
+	cmd, mention, args := utils.ParseCommand(post.Text)
+	if cmd == "" {
+		return nil
+	}
+	if mention != "" && !strings.EqualFold(mention, handlerDeps.BotUsername(ctx, b)) {
+		return nil
+	}
+
+	// Dispatch
+	if h, ok := routes[cmd]; ok {
+		return h(ctx, b, update, args, handlerDeps, handlerDeps.I18n.BestLang(""))
+	}
+	return nil
+}
+
+func HandlerCallBackQuery(ctx context.Context, b *bot.Bot, update *models.Update, handlerDeps *utils.HandlerDeps) error {
+	cb 		:= update.CallbackQuery
+
+	// Example format: "command:arg1:arg2"
+	parts := strings.Split(cb.Data, ":")
+	cmd := parts[0]
+	args := []string{}
+	if len(parts) > 1 {
+		args = parts[1:]
+	}
+
+	var err error
+	if h, ok := callbackRoutes[cmd]; ok {
+		err = h(ctx, b, update, args, handlerDeps, handlerDeps.Lang(ctx, &cb.From))
+	}
+
+	// always answer, or the client keeps the button spinning
+	if _, answerErr := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+		CallbackQueryID: cb.ID,
+	}); answerErr != nil {
+		err = errors.Join(err, fmt.Errorf("answer callback query: %w", answerErr))
+	}
+	return err
+}
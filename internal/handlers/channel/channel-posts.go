@@ -0,0 +1,17 @@
+package channel
+
+import (
+	"context"
+
+	"github.com/frangi01/bbtelgo/internal/utils"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+func pingHandler(ctx context.Context, b *bot.Bot, u *models.Update, _ []string, deps *utils.HandlerDeps, lang string) error {
+	_, err := deps.Sender.SendMessage(ctx, b, &bot.SendMessageParams{
+		ChatID:      u.ChannelPost.Chat.ID,
+		Text:        deps.I18n.T(lang, "channel.pong", nil),
+	})
+	return err
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/frangi01/bbtelgo/internal/entities"
+	"github.com/frangi01/bbtelgo/internal/repo"
+	"github.com/frangi01/bbtelgo/internal/utils"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// Built-in routes keeping the chats collection up to date (no-ops without ChatRepository).
+
+// routeMyChatMember records the bot being added, removed, kicked or promoted in groups and channels.
+func routeMyChatMember(ctx context.Context, b *bot.Bot, update *models.Update, m *models.ChatMemberUpdated, handlerDeps *utils.HandlerDeps) error {
+	chats := chatRepository(handlerDeps)
+	if chats == nil || m.Chat.Type == models.ChatTypePrivate {
+		return nil
+	}
+	status := chatStatus(m.NewChatMember)
+	if err := chats.SetStatus(ctx, m.Chat, status, m.From.ID, time.Unix(int64(m.Date), 0)); err != nil {
+		return fmt.Errorf("chat %d status %s: %w", m.Chat.ID, status, err)
+	}
+	handlerDeps.Logger.Infof("chat %d (%s %q): bot %s by %d", m.Chat.ID, m.Chat.Type, m.Chat.Title, status, m.From.ID)
+	return nil
+}
+
+// trackChat handles the service messages changing a chat: new title and group -> supergroup
+// migration (sent both in the old group, migrate_to_chat_id, and in the new supergroup,
+// migrate_from_chat_id; handling both is harmless).
+func trackChat(ctx context.Context, b *bot.Bot, update *models.Update, msg *models.Message, handlerDeps *utils.HandlerDeps) error {
+	chats := chatRepository(handlerDeps)
+	if chats == nil {
+		return nil
+	}
+	switch {
+	case msg.NewChatTitle != "":
+		chat := msg.Chat
+		chat.Title = msg.NewChatTitle
+		if err := chats.UpdateInfo(ctx, chat); err != nil {
+			return fmt.Errorf("chat %d title: %w", chat.ID, err)
+		}
+	case msg.MigrateToChatID != 0:
+		to := models.Chat{ID: msg.MigrateToChatID, Type: models.ChatTypeSupergroup, Title: msg.Chat.Title}
+		return migrateChat(ctx, handlerDeps, msg.Chat.ID, to)
+	case msg.MigrateFromChatID != 0:
+		return migrateChat(ctx, handlerDeps, msg.MigrateFromChatID, msg.Chat)
+	}
+	return nil
+}
+
+func migrateChat(ctx context.Context, handlerDeps *utils.HandlerDeps, fromID int64, to models.Chat) error {
+	if err := chatRepository(handlerDeps).Migrate(ctx, fromID, to); err != nil {
+		return fmt.Errorf("migrate chat %d -> %d: %w", fromID, to.ID, err)
+	}
+	if handlerDeps.RepositoryList.MessageRepository == nil {
+		return nil
+	}
+	moved, skipped, err := handlerDeps.RepositoryList.MessageRepository.MoveChat(ctx, fromID, to.ID)
+	if err != nil {
+		return fmt.Errorf("move messages of chat %d -> %d: %w", fromID, to.ID, err)
+	}
+	if moved > 0 || skipped > 0 {
+		handlerDeps.Logger.Infof("chat %d migrated to %d: %d messages moved, %d skipped", fromID, to.ID, moved, skipped)
+	}
+	return nil
+}
+
+func chatRepository(handlerDeps *utils.HandlerDeps) *repo.ChatRepository {
+	if handlerDeps.RepositoryList == nil || handlerDeps.RepositoryList.ChatRepository == nil {
+		return nil
+	}
+	return handlerDeps.RepositoryList.ChatRepository
+}
+
+// chatStatus maps the new membership of the bot to the stored status.
+func chatStatus(m models.ChatMember) entities.ChatStatus {
+	switch m.Type {
+	case models.ChatMemberTypeOwner, models.ChatMemberTypeAdministrator:
+		return entities.ChatAdmin
+	case models.ChatMemberTypeMember:
+		return entities.ChatMember
+	case models.ChatMemberTypeRestricted:
+		if m.Restricted != nil && m.Restricted.IsMember {
+			return entities.ChatMember
+		}
+		return entities.ChatLeft
+	case models.ChatMemberTypeBanned:
+		return entities.ChatKicked
+	}
+	return entities.ChatLeft
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/frangi01/bbtelgo/internal/utils"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+const (
+	// dedupTTL covers the redeliveries of Telegram, which keeps an update for up to 24h
+	dedupTTL = 24 * time.Hour
+	// dedupLRUSize is the number of recent update IDs remembered in process
+	dedupLRUSize = 10000
+)
+
+func dedupKey(updateID int64) string {
+	return fmt.Sprintf("upd:%d", updateID)
+}
+
+// DedupMiddleware drops the updates already handled, by update_id: Telegram delivers an
+// update again when the webhook answer is lost or late, and with several replicas two of
+// them can get it. The ID is claimed in Redis (SetNX, dedupTTL) before dispatching; without
+// Redis, or while it fails, the recent IDs kept in process (LRU) are used instead.
+// A claimed update is not retried if its handler fails.
+func DedupMiddleware(handlerDeps *utils.HandlerDeps) Middleware {
+	recent := newIDLRU(dedupLRUSize)
+	return func(next bot.HandlerFunc) bot.HandlerFunc {
+		return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+			if update.ID != 0 && !claimUpdate(ctx, handlerDeps, recent, update.ID) {
+				handlerDeps.Logger.Debugf("duplicate update %d dropped", update.ID)
+				return
+			}
+			next(ctx, b, update)
+		}
+	}
+}
+
+// claimUpdate reports whether updateID is new; the LRU also answers the duplicates seen by
+// this replica without a round trip.
+func claimUpdate(ctx context.Context, handlerDeps *utils.HandlerDeps, recent *idLRU, updateID int64) bool {
+	if recent.contains(updateID) {
+		return false
+	}
+	if handlerDeps.Cache != nil {
+		claimed, err := handlerDeps.Cache.SetNX(ctx, dedupKey(updateID), 1, dedupTTL)
+		if err == nil {
+			recent.claim(updateID)
+			return claimed
+		}
+		handlerDeps.Logger.Warnf("dedup update %d: %v (in-process fallback)", updateID, err)
+	}
+	return recent.claim(updateID)
+}
+
+// idLRU is a fixed-size set of IDs that forgets the least recently claimed first.
+type idLRU struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List // front = most recent
+	items map[int64]*list.Element
+}
+
+func newIDLRU(size int) *idLRU {
+	return &idLRU{size: size, order: list.New(), items: make(map[int64]*list.Element, size)}
+}
+
+func (l *idLRU) contains(id int64) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, ok := l.items[id]
+	return ok
+}
+
+// claim adds id and reports whether it was not there yet.
+func (l *idLRU) claim(id int64) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if e, ok := l.items[id]; ok {
+		l.order.MoveToFront(e)
+		return false
+	}
+	l.items[id] = l.order.PushFront(id)
+	if l.order.Len() > l.size {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.items, oldest.Value.(int64))
+	}
+	return true
+}
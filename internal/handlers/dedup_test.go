@@ -0,0 +1,38 @@
+package handlers
+
+import "testing"
+
+func TestIDLRU(t *testing.T) {
+	l := newIDLRU(2)
+
+	if !l.claim(1) || !l.claim(2) {
+		t.Fatal("first claims must succeed")
+	}
+	if l.claim(1) {
+		t.Fatal("claim(1) again succeeded")
+	}
+	// 1 was claimed again, so 2 is the least recent and goes first
+	if !l.claim(3) {
+		t.Fatal("claim(3) failed")
+	}
+
+	tests := []struct {
+		id   int64
+		want bool
+	}{
+		{1, true},
+		{2, false},
+		{3, true},
+	}
+	for _, tt := range tests {
+		if got := l.contains(tt.id); got != tt.want {
+			t.Errorf("contains(%d) = %v, want %v", tt.id, got, tt.want)
+		}
+	}
+	if l.order.Len() != 2 || len(l.items) != 2 {
+		t.Errorf("size = %d/%d, want 2", l.order.Len(), len(l.items))
+	}
+	if !l.claim(2) {
+		t.Error("an evicted id can be claimed again")
+	}
+}
@@ -0,0 +1,311 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+
+	"github.com/frangi01/bbtelgo/internal/handlers/channel"
+	"github.com/frangi01/bbtelgo/internal/handlers/group"
+	"github.com/frangi01/bbtelgo/internal/handlers/private"
+	"github.com/frangi01/bbtelgo/internal/utils"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// UpdateHandler handles one update variant: payload is the non-nil field of
+// update matching the registration (e.g. update.InlineQuery for OnInlineQuery).
+type UpdateHandler[T any] func(ctx context.Context, b *bot.Bot, update *models.Update, payload *T, deps *utils.HandlerDeps) error
+
+type route func(ctx context.Context, b *bot.Bot, update *models.Update, deps *utils.HandlerDeps) error
+
+// Dispatcher routes every update to the handlers registered for its type,
+// in registration order. Types are keyed by their allowed_updates name.
+type Dispatcher struct {
+	mu           sync.RWMutex
+	routes       map[string][]route
+	errorHandler ErrorHandler
+}
+
+// NewDispatcher returns a dispatcher with the built-in routing already registered:
+// messages and callback queries go to the private/group/channel route tables,
+// membership and service messages update the chats collection.
+func NewDispatcher() *Dispatcher {
+	d := &Dispatcher{routes: make(map[string][]route)}
+	d.OnMessage(trackChat)
+	d.OnMessage(routeMessage)
+	d.OnChannelPost(trackChat)
+	d.OnChannelPost(routeChannelPost)
+	d.OnMyChatMember(routeMyChatMember)
+	d.OnCallbackQuery(routeCallbackQuery)
+	return d
+}
+
+func register[T any](d *Dispatcher, updateType string, h UpdateHandler[T], payload func(*models.Update) *T) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.routes[updateType] = append(d.routes[updateType], func(ctx context.Context, b *bot.Bot, update *models.Update, deps *utils.HandlerDeps) error {
+		if p := payload(update); p != nil {
+			return h(ctx, b, update, p, deps)
+		}
+		return nil
+	})
+}
+
+// OnError replaces the error handler (DefaultErrorHandler if never called).
+func (d *Dispatcher) OnError(h ErrorHandler) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.errorHandler = h
+}
+
+// ErrorHandler returns the configured error handler, or the default one built on handlerDeps.
+func (d *Dispatcher) ErrorHandler(handlerDeps *utils.HandlerDeps) ErrorHandler {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.errorHandler != nil {
+		return d.errorHandler
+	}
+	return DefaultErrorHandler(handlerDeps)
+}
+
+// AllowedUpdates lists the update types with at least one handler, to be passed to
+// getUpdates/setWebhook (chat_member and reactions are only sent when requested).
+func (d *Dispatcher) AllowedUpdates() []string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	out := make([]string, 0, len(d.routes))
+	for _, t := range allUpdateTypes {
+		if len(d.routes[t]) > 0 {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// Handle returns the final bot.HandlerFunc of the middleware chain.
+// Every handler of the type runs; each error is passed to the error handler.
+func (d *Dispatcher) Handle(handlerDeps *utils.HandlerDeps) bot.HandlerFunc {
+	onError := d.ErrorHandler(handlerDeps)
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		updateType := UpdateType(update)
+		if updateType == "" {
+			handlerDeps.Logger.Debugf("update %d: unknown type, skipped", update.ID)
+			return
+		}
+
+		d.mu.RLock()
+		routes := d.routes[updateType]
+		d.mu.RUnlock()
+
+		for _, r := range routes {
+			if err := r(ctx, b, update, handlerDeps); err != nil {
+				onError(ctx, b, update, err)
+			}
+		}
+	}
+}
+
+var allUpdateTypes = []string{
+	models.AllowedUpdateMessage,
+	models.AllowedUpdateEditedMessage,
+	models.AllowedUpdateChannelPost,
+	models.AllowedUpdateEditedChannelPost,
+	models.AllowedUpdateBusinessConnection,
+	models.AllowedUpdateBusinessMessage,
+	models.AllowedUpdateEditedBusinessMessage,
+	models.AllowedUpdateDeletedBusinessMessages,
+	models.AllowedUpdateMessageReaction,
+	models.AllowedUpdateMessageReactionCount,
+	models.AllowedUpdateInlineQuery,
+	models.AllowedUpdateChosenInlineResult,
+	models.AllowedUpdateCallbackQuery,
+	models.AllowedUpdateShippingQuery,
+	models.AllowedUpdatePreCheckoutQuery,
+	models.AllowedUpdatePurchasedPaidMedia,
+	models.AllowedUpdatePoll,
+	models.AllowedUpdatePollAnswer,
+	models.AllowedUpdateMyChatMember,
+	models.AllowedUpdateChatMember,
+	models.AllowedUpdateChatJoinRequest,
+	models.AllowedUpdateChatBoost,
+	models.AllowedUpdateRemovedChatBoost,
+}
+
+// UpdateType returns the allowed_updates name of the update ("" if unknown).
+func UpdateType(u *models.Update) string {
+	switch {
+	case u.Message != nil:
+		return models.AllowedUpdateMessage
+	case u.EditedMessage != nil:
+		return models.AllowedUpdateEditedMessage
+	case u.ChannelPost != nil:
+		return models.AllowedUpdateChannelPost
+	case u.EditedChannelPost != nil:
+		return models.AllowedUpdateEditedChannelPost
+	case u.BusinessConnection != nil:
+		return models.AllowedUpdateBusinessConnection
+	case u.BusinessMessage != nil:
+		return models.AllowedUpdateBusinessMessage
+	case u.EditedBusinessMessage != nil:
+		return models.AllowedUpdateEditedBusinessMessage
+	case u.DeletedBusinessMessages != nil:
+		return models.AllowedUpdateDeletedBusinessMessages
+	case u.MessageReaction != nil:
+		return models.AllowedUpdateMessageReaction
+	case u.MessageReactionCount != nil:
+		return models.AllowedUpdateMessageReactionCount
+	case u.InlineQuery != nil:
+		return models.AllowedUpdateInlineQuery
+	case u.ChosenInlineResult != nil:
+		return models.AllowedUpdateChosenInlineResult
+	case u.CallbackQuery != nil:
+		return models.AllowedUpdateCallbackQuery
+	case u.ShippingQuery != nil:
+		return models.AllowedUpdateShippingQuery
+	case u.PreCheckoutQuery != nil:
+		return models.AllowedUpdatePreCheckoutQuery
+	case u.PurchasedPaidMedia != nil:
+		return models.AllowedUpdatePurchasedPaidMedia
+	case u.Poll != nil:
+		return models.AllowedUpdatePoll
+	case u.PollAnswer != nil:
+		return models.AllowedUpdatePollAnswer
+	case u.MyChatMember != nil:
+		return models.AllowedUpdateMyChatMember
+	case u.ChatMember != nil:
+		return models.AllowedUpdateChatMember
+	case u.ChatJoinRequest != nil:
+		return models.AllowedUpdateChatJoinRequest
+	case u.ChatBoost != nil:
+		return models.AllowedUpdateChatBoost
+	case u.RemovedChatBoost != nil:
+		return models.AllowedUpdateRemovedChatBoost
+	}
+	return ""
+}
+
+// --- typed registration ---
+
+func (d *Dispatcher) OnMessage(h UpdateHandler[models.Message]) {
+	register(d, models.AllowedUpdateMessage, h, func(u *models.Update) *models.Message { return u.Message })
+}
+
+func (d *Dispatcher) OnEditedMessage(h UpdateHandler[models.Message]) {
+	register(d, models.AllowedUpdateEditedMessage, h, func(u *models.Update) *models.Message { return u.EditedMessage })
+}
+
+func (d *Dispatcher) OnChannelPost(h UpdateHandler[models.Message]) {
+	register(d, models.AllowedUpdateChannelPost, h, func(u *models.Update) *models.Message { return u.ChannelPost })
+}
+
+func (d *Dispatcher) OnEditedChannelPost(h UpdateHandler[models.Message]) {
+	register(d, models.AllowedUpdateEditedChannelPost, h, func(u *models.Update) *models.Message { return u.EditedChannelPost })
+}
+
+func (d *Dispatcher) OnBusinessConnection(h UpdateHandler[models.BusinessConnection]) {
+	register(d, models.AllowedUpdateBusinessConnection, h, func(u *models.Update) *models.BusinessConnection { return u.BusinessConnection })
+}
+
+func (d *Dispatcher) OnBusinessMessage(h UpdateHandler[models.Message]) {
+	register(d, models.AllowedUpdateBusinessMessage, h, func(u *models.Update) *models.Message { return u.BusinessMessage })
+}
+
+func (d *Dispatcher) OnEditedBusinessMessage(h UpdateHandler[models.Message]) {
+	register(d, models.AllowedUpdateEditedBusinessMessage, h, func(u *models.Update) *models.Message { return u.EditedBusinessMessage })
+}
+
+func (d *Dispatcher) OnDeletedBusinessMessages(h UpdateHandler[models.BusinessMessagesDeleted]) {
+	register(d, models.AllowedUpdateDeletedBusinessMessages, h, func(u *models.Update) *models.BusinessMessagesDeleted { return u.DeletedBusinessMessages })
+}
+
+func (d *Dispatcher) OnMessageReaction(h UpdateHandler[models.MessageReactionUpdated]) {
+	register(d, models.AllowedUpdateMessageReaction, h, func(u *models.Update) *models.MessageReactionUpdated { return u.MessageReaction })
+}
+
+func (d *Dispatcher) OnMessageReactionCount(h UpdateHandler[models.MessageReactionCountUpdated]) {
+	register(d, models.AllowedUpdateMessageReactionCount, h, func(u *models.Update) *models.MessageReactionCountUpdated { return u.MessageReactionCount })
+}
+
+func (d *Dispatcher) OnInlineQuery(h UpdateHandler[models.InlineQuery]) {
+	register(d, models.AllowedUpdateInlineQuery, h, func(u *models.Update) *models.InlineQuery { return u.InlineQuery })
+}
+
+func (d *Dispatcher) OnChosenInlineResult(h UpdateHandler[models.ChosenInlineResult]) {
+	register(d, models.AllowedUpdateChosenInlineResult, h, func(u *models.Update) *models.ChosenInlineResult { return u.ChosenInlineResult })
+}
+
+func (d *Dispatcher) OnCallbackQuery(h UpdateHandler[models.CallbackQuery]) {
+	register(d, models.AllowedUpdateCallbackQuery, h, func(u *models.Update) *models.CallbackQuery { return u.CallbackQuery })
+}
+
+func (d *Dispatcher) OnShippingQuery(h UpdateHandler[models.ShippingQuery]) {
+	register(d, models.AllowedUpdateShippingQuery, h, func(u *models.Update) *models.ShippingQuery { return u.ShippingQuery })
+}
+
+func (d *Dispatcher) OnPreCheckoutQuery(h UpdateHandler[models.PreCheckoutQuery]) {
+	register(d, models.AllowedUpdatePreCheckoutQuery, h, func(u *models.Update) *models.PreCheckoutQuery { return u.PreCheckoutQuery })
+}
+
+func (d *Dispatcher) OnPurchasedPaidMedia(h UpdateHandler[models.PaidMediaPurchased]) {
+	register(d, models.AllowedUpdatePurchasedPaidMedia, h, func(u *models.Update) *models.PaidMediaPurchased { return u.PurchasedPaidMedia })
+}
+
+func (d *Dispatcher) OnPoll(h UpdateHandler[models.Poll]) {
+	register(d, models.AllowedUpdatePoll, h, func(u *models.Update) *models.Poll { return u.Poll })
+}
+
+func (d *Dispatcher) OnPollAnswer(h UpdateHandler[models.PollAnswer]) {
+	register(d, models.AllowedUpdatePollAnswer, h, func(u *models.Update) *models.PollAnswer { return u.PollAnswer })
+}
+
+func (d *Dispatcher) OnMyChatMember(h UpdateHandler[models.ChatMemberUpdated]) {
+	register(d, models.AllowedUpdateMyChatMember, h, func(u *models.Update) *models.ChatMemberUpdated { return u.MyChatMember })
+}
+
+func (d *Dispatcher) OnChatMember(h UpdateHandler[models.ChatMemberUpdated]) {
+	register(d, models.AllowedUpdateChatMember, h, func(u *models.Update) *models.ChatMemberUpdated { return u.ChatMember })
+}
+
+func (d *Dispatcher) OnChatJoinRequest(h UpdateHandler[models.ChatJoinRequest]) {
+	register(d, models.AllowedUpdateChatJoinRequest, h, func(u *models.Update) *models.ChatJoinRequest { return u.ChatJoinRequest })
+}
+
+func (d *Dispatcher) OnChatBoost(h UpdateHandler[models.ChatBoostUpdated]) {
+	register(d, models.AllowedUpdateChatBoost, h, func(u *models.Update) *models.ChatBoostUpdated { return u.ChatBoost })
+}
+
+func (d *Dispatcher) OnRemovedChatBoost(h UpdateHandler[models.ChatBoostRemoved]) {
+	register(d, models.AllowedUpdateRemovedChatBoost, h, func(u *models.Update) *models.ChatBoostRemoved { return u.RemovedChatBoost })
+}
+
+// --- built-in routes ---
+
+func routeMessage(ctx context.Context, b *bot.Bot, update *models.Update, msg *models.Message, handlerDeps *utils.HandlerDeps) error {
+	switch msg.Chat.Type {
+	case models.ChatTypePrivate:
+		return private.HandlerMessage(ctx, b, update, handlerDeps)
+	case models.ChatTypeGroup, models.ChatTypeSupergroup:
+		return group.HandlerMessage(ctx, b, update, handlerDeps)
+	}
+	return nil
+}
+
+func routeChannelPost(ctx context.Context, b *bot.Bot, update *models.Update, _ *models.Message, handlerDeps *utils.HandlerDeps) error {
+	return channel.HandlerPost(ctx, b, update, handlerDeps)
+}
+
+func routeCallbackQuery(ctx context.Context, b *bot.Bot, update *models.Update, cb *models.CallbackQuery, handlerDeps *utils.HandlerDeps) error {
+	chat := utils.CallbackChat(cb)
+	if chat == nil {
+		return nil
+	}
+	switch chat.Type {
+	case models.ChatTypePrivate:
+		return private.HandlerCallBackQuery(ctx, b, update, handlerDeps)
+	case models.ChatTypeGroup, models.ChatTypeSupergroup:
+		return group.HandlerCallBackQuery(ctx, b, update, handlerDeps)
+	case models.ChatTypeChannel:
+		return channel.HandlerCallBackQuery(ctx, b, update, handlerDeps)
+	}
+	return nil
+}
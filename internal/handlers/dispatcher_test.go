@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/frangi01/bbtelgo/internal/utils"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+func TestDispatcherAllowedUpdates(t *testing.T) {
+	d := NewDispatcher()
+	want := []string{models.AllowedUpdateMessage, models.AllowedUpdateChannelPost, models.AllowedUpdateCallbackQuery, models.AllowedUpdateMyChatMember}
+	if got := d.AllowedUpdates(); !slices.Equal(got, want) {
+		t.Fatalf("built-in AllowedUpdates = %v, want %v", got, want)
+	}
+
+	d.OnInlineQuery(func(context.Context, *bot.Bot, *models.Update, *models.InlineQuery, *utils.HandlerDeps) error {
+		return nil
+	})
+	if got := d.AllowedUpdates(); !slices.Contains(got, models.AllowedUpdateInlineQuery) {
+		t.Fatalf("AllowedUpdates = %v, want inline_query after OnInlineQuery", got)
+	}
+}
+
+func TestDispatcherRoutesByType(t *testing.T) {
+	d := &Dispatcher{routes: make(map[string][]route)}
+	var got []string
+	d.OnInlineQuery(func(ctx context.Context, b *bot.Bot, update *models.Update, q *models.InlineQuery, deps *utils.HandlerDeps) error {
+		got = append(got, "first "+q.Query)
+		return nil
+	})
+	d.OnInlineQuery(func(ctx context.Context, b *bot.Bot, update *models.Update, q *models.InlineQuery, deps *utils.HandlerDeps) error {
+		got = append(got, "second "+q.Query)
+		return nil
+	})
+	d.OnPollAnswer(func(ctx context.Context, b *bot.Bot, update *models.Update, a *models.PollAnswer, deps *utils.HandlerDeps) error {
+		got = append(got, "poll")
+		return nil
+	})
+
+	h := d.Handle(&utils.HandlerDeps{})
+	h(context.Background(), nil, &models.Update{InlineQuery: &models.InlineQuery{Query: "q"}})
+
+	if want := []string{"first q", "second q"}; !slices.Equal(got, want) {
+		t.Fatalf("handled %v, want %v", got, want)
+	}
+}
+
+func TestDispatcherErrors(t *testing.T) {
+	d := &Dispatcher{routes: make(map[string][]route)}
+	errFirst := errors.New("first")
+	var ran bool
+	d.OnInlineQuery(func(ctx context.Context, b *bot.Bot, update *models.Update, q *models.InlineQuery, deps *utils.HandlerDeps) error {
+		return errFirst
+	})
+	d.OnInlineQuery(func(ctx context.Context, b *bot.Bot, update *models.Update, q *models.InlineQuery, deps *utils.HandlerDeps) error {
+		ran = true
+		return nil
+	})
+	var errs []error
+	d.OnError(func(ctx context.Context, b *bot.Bot, update *models.Update, err error) {
+		errs = append(errs, err)
+	})
+
+	h := d.Handle(&utils.HandlerDeps{})
+	h(context.Background(), nil, &models.Update{InlineQuery: &models.InlineQuery{Query: "q"}})
+
+	if len(errs) != 1 || !errors.Is(errs[0], errFirst) {
+		t.Fatalf("errors = %v, want [%v]", errs, errFirst)
+	}
+	if !ran {
+		t.Fatal("an error must not stop the next handlers")
+	}
+}
+
+func TestRecoverMiddleware(t *testing.T) {
+	var got error
+	h := RecoverMiddleware(func(ctx context.Context, b *bot.Bot, update *models.Update, err error) {
+		got = err
+	})(func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		panic("boom")
+	})
+	h(context.Background(), nil, &models.Update{})
+
+	var panicErr *PanicError
+	if !errors.As(got, &panicErr) {
+		t.Fatalf("error = %v, want *PanicError", got)
+	}
+	if panicErr.Value != "boom" || len(panicErr.Stack) == 0 {
+		t.Fatalf("PanicError = %v with %d bytes of stack", panicErr.Value, len(panicErr.Stack))
+	}
+}
+
+func TestUpdateType(t *testing.T) {
+	tests := []struct {
+		u    *models.Update
+		want string
+	}{
+		{&models.Update{Message: &models.Message{}}, models.AllowedUpdateMessage},
+		{&models.Update{EditedChannelPost: &models.Message{}}, models.AllowedUpdateEditedChannelPost},
+		{&models.Update{ChatJoinRequest: &models.ChatJoinRequest{}}, models.AllowedUpdateChatJoinRequest},
+		{&models.Update{}, ""},
+	}
+	for _, tt := range tests {
+		if got := UpdateType(tt.u); got != tt.want {
+			t.Errorf("UpdateType(%+v) = %q, want %q", tt.u, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/frangi01/bbtelgo/internal/utils"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// ErrorHandler receives the errors returned by route handlers and the recovered panics.
+type ErrorHandler func(ctx context.Context, b *bot.Bot, update *models.Update, err error)
+
+// PanicError wraps a recovered panic with the stack of the goroutine that panicked.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// DefaultErrorHandler logs the error and replies with a localized "something went wrong".
+func DefaultErrorHandler(handlerDeps *utils.HandlerDeps) ErrorHandler {
+	return func(ctx context.Context, b *bot.Bot, update *models.Update, err error) {
+		var panicErr *PanicError
+		if errors.As(err, &panicErr) {
+			handlerDeps.Logger.Errorf("update %d: %v\n%s", update.ID, panicErr, panicErr.Stack)
+		} else {
+			handlerDeps.Logger.Errorf("update %d: %v", update.ID, err)
+		}
+
+		// shutting down: nobody to answer
+		if errors.Is(err, context.Canceled) {
+			return
+		}
+		chatID := utils.ChatIDFromUpdate(update)
+		if chatID == 0 {
+			return
+		}
+
+		lang := handlerDeps.Lang(ctx, utils.SenderFromUpdate(update))
+
+		if _, sendErr := handlerDeps.Sender.SendMessage(ctx, b, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   handlerDeps.I18n.T(lang, "error.generic", nil),
+		}); sendErr != nil {
+			handlerDeps.Logger.Errorf("send error reply: %v", sendErr)
+		}
+	}
+}
+
+// RecoverMiddleware turns a panic in the rest of the chain into a *PanicError for onError,
+// so a broken handler cannot crash the process.
+func RecoverMiddleware(onError ErrorHandler) Middleware {
+	return func(next bot.HandlerFunc) bot.HandlerFunc {
+		return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+			defer func() {
+				if v := recover(); v != nil {
+					onError(ctx, b, update, &PanicError{Value: v, Stack: debug.Stack()})
+				}
+			}()
+			next(ctx, b, update)
+		}
+	}
+}
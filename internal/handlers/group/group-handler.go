@@ -0,0 +1,126 @@
+package group
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/frangi01/bbtelgo/internal/commands"
+	"github.com/frangi01/bbtelgo/internal/rbac"
+	"github.com/frangi01/bbtelgo/internal/utils"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+
+// HandleFunc is a route handler: returned errors go to the dispatcher error handler.
+type HandleFunc func(ctx context.Context, b *bot.Bot, u *models.Update, _ []string, deps *utils.HandlerDeps, lang string) error
+
+
+var routes = commands.NewTable(commands.ScopeGroup,
+	commands.Route[HandleFunc]{
+		Command: commands.Command{Name: "start", Description: "command.group_start"},
+		Handler: startHandler,
+	},
+)
+
+// callbackRoute is the callback counterpart of a command route.
+type callbackRoute struct {
+	Handler HandleFunc
+	Access  rbac.Rule // zero = everyone
+}
+
+var callbackRoutes = map[string]callbackRoute{}
+
+
+// HandlerMessage handles messages from groups and supergroups.
+// Commands are answered only when bare ("/start") or addressed to this bot ("/start@ThisBot").
+func HandlerMessage(ctx context.Context, b *bot.Bot, update *models.Update, handlerDeps *utils.HandlerDeps) error {
+	if update.Message.Text == "" {
+		return nil
+	}
+
+	cmd, mention, args := utils.ParseCommand(update.Message.Text)
+	if cmd == "" {
+		return nil
+	}
+	if mention != "" && !strings.EqualFold(mention, handlerDeps.BotUsername(ctx, b)) {
+		handlerDeps.Logger.Debugf("group command %s addressed to @%s, skipped", cmd, mention)
+		return nil
+	}
+
+	lang := handlerDeps.Lang(ctx, update.Message.From)
+
+	// Dispatch
+	r, ok := routes.Lookup(cmd)
+	if !ok {
+		return nil
+	}
+	if r.Scope == commands.ScopeGroupAdmins {
+		admin, err := isAdmin(ctx, b, update)
+		if err != nil || !admin {
+			return err
+		}
+	}
+	allowed, err := handlerDeps.Authorize(ctx, b, update, "command:/"+r.Name, r.Access, lang)
+	if err != nil || !allowed {
+		return err
+	}
+	return r.Handler(ctx, b, update, args, handlerDeps, lang)
+}
+
+// Commands returns the group commands, for the Telegram menu.
+func Commands() []commands.Command {
+	return routes.Commands()
+}
+
+func isAdmin(ctx context.Context, b *bot.Bot, update *models.Update) (bool, error) {
+	if update.Message.From == nil {
+		// anonymous admins post as the group itself
+		return update.Message.SenderChat != nil && update.Message.SenderChat.ID == update.Message.Chat.ID, nil
+	}
+	member, err := b.GetChatMember(ctx, &bot.GetChatMemberParams{
+		ChatID: update.Message.Chat.ID,
+		UserID: update.Message.From.ID,
+	})
+	if err != nil {
+		return false, fmt.Errorf("getChatMember: %w", err)
+	}
+	return member.Type == models.ChatMemberTypeOwner || member.Type == models.ChatMemberTypeAdministrator, nil
+}
+
+func HandlerCallBackQuery(ctx context.Context, b *bot.Bot, update *models.Update, handlerDeps *utils.HandlerDeps) error {
+	cb 		:= update.CallbackQuery
+
+	// Example format: "command:arg1:arg2"
+	parts := strings.Split(cb.Data, ":")
+	cmd := parts[0]
+	args := []string{}
+	if len(parts) > 1 {
+		args = parts[1:]
+	}
+
+	lang := handlerDeps.Lang(ctx, &cb.From)
+	answer := &bot.AnswerCallbackQueryParams{CallbackQueryID: cb.ID}
+
+	var err error
+	if r, ok := callbackRoutes[cmd]; ok {
+		var allowed bool
+		allowed, err = handlerDeps.Authorize(ctx, b, update, "callback:"+cmd, r.Access, lang)
+		switch {
+		case err != nil:
+		case !allowed:
+			answer.Text = handlerDeps.I18n.T(lang, "access.denied", nil)
+			answer.ShowAlert = true
+		default:
+			err = r.Handler(ctx, b, update, args, handlerDeps, lang)
+		}
+	}
+
+	// always answer, or the client keeps the button spinning
+	if _, answerErr := b.AnswerCallbackQuery(ctx, answer); answerErr != nil {
+		err = errors.Join(err, fmt.Errorf("answer callback query: %w", answerErr))
+	}
+	return err
+}
@@ -0,0 +1,22 @@
+package group
+
+import (
+	"context"
+
+	"github.com/frangi01/bbtelgo/internal/utils"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+func startHandler(ctx context.Context, b *bot.Bot, u *models.Update, _ []string, deps *utils.HandlerDeps, lang string) error {
+	_, err := deps.Sender.SendMessage(ctx, b, &bot.SendMessageParams{
+		ChatID:      	u.Message.Chat.ID,
+		Text:       	deps.I18n.T(lang, "group.welcome", map[string]any{
+			"title": u.Message.Chat.Title,
+		}),
+		ReplyParameters: &models.ReplyParameters{
+			MessageID: u.Message.ID,
+		},
+	})
+	return err
+}
@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/frangi01/bbtelgo/internal/config"
+	"github.com/frangi01/bbtelgo/internal/repo"
+	"github.com/frangi01/bbtelgo/internal/utils"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// Middleware wraps a handler with extra behaviour (auth, metrics, persistence...).
+// Returning without calling next stops the update.
+type Middleware func(next bot.HandlerFunc) bot.HandlerFunc
+
+// Chain keeps middlewares in registration order: the first registered is the
+// outermost one, so it sees the update first and the result last.
+type Chain struct {
+	middlewares []Middleware
+}
+
+func NewChain(middlewares ...Middleware) *Chain {
+	c := &Chain{}
+	return c.Use(middlewares...)
+}
+
+// Use appends middlewares at the end of the chain (nil entries are skipped).
+func (c *Chain) Use(middlewares ...Middleware) *Chain {
+	for _, m := range middlewares {
+		if m != nil {
+			c.middlewares = append(c.middlewares, m)
+		}
+	}
+	return c
+}
+
+// Then wraps the final handler with the whole chain.
+func (c *Chain) Then(h bot.HandlerFunc) bot.HandlerFunc {
+	for i := len(c.middlewares) - 1; i >= 0; i-- {
+		h = c.middlewares[i](h)
+	}
+	return h
+}
+
+// ActorMiddleware attributes the repository changes made while handling the update to
+// its sender, for the audit log (repo.WithActor).
+func ActorMiddleware() Middleware {
+	return func(next bot.HandlerFunc) bot.HandlerFunc {
+		return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+			if from := utils.SenderFromUpdate(update); from != nil {
+				ctx = repo.WithActor(ctx, from.ID)
+			}
+			next(ctx, b, update)
+		}
+	}
+}
+
+// RateLimitMiddleware drops updates over the configured per-chat limit (needs Redis).
+// Updates without a chat are limited per sender.
+func RateLimitMiddleware(handlerDeps *utils.HandlerDeps) Middleware {
+	return func(next bot.HandlerFunc) bot.HandlerFunc {
+		return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+			if handlerDeps.Cache == nil || handlerDeps.Cfg.RedisCfg.RateLimitMessages <= 0 {
+				next(ctx, b, update)
+				return
+			}
+
+			// updates without a chat (inline queries, ...) count for their sender; with
+			// neither there is no bucket to charge
+			chatID := utils.ChatIDFromUpdate(update)
+			bucketID := chatID
+			if bucketID == 0 {
+				if from := utils.SenderFromUpdate(update); from != nil {
+					bucketID = from.ID
+				}
+			}
+			if bucketID == 0 {
+				next(ctx, b, update)
+				return
+			}
+			key := utils.RateLimitKey(bucketID)
+
+			limit := handlerDeps.Cfg.RedisCfg.RateLimitMessages
+			window := time.Duration(handlerDeps.Cfg.RedisCfg.RateLimitMs) * time.Millisecond
+
+			if window <= 0 {
+				window = time.Minute
+			}
+
+			allowed := true
+			var err error
+
+			switch handlerDeps.Cfg.RedisCfg.RateLimitType {
+			case config.RLFixedWindow:
+				allowed, _, _, err = handlerDeps.Cache.RateLimitFixedWindow(ctx, key, limit, window)
+			case config.RLSlidingWindow:
+				allowed, _, _, err = handlerDeps.Cache.RateLimitSlidingWindow(ctx, key, limit, window)
+			default:
+				allowed = true
+			}
+
+			if err != nil {
+				handlerDeps.Logger.Errorf("rate-limit error: %v", err)
+				return
+			}
+			if !allowed {
+				if chatID != 0 {
+					_, _ = handlerDeps.Sender.SendMessage(ctx, b, &bot.SendMessageParams{
+						ChatID: chatID,
+						Text:   "You are banned.",
+					})
+				}
+				return
+			}
+
+			next(ctx, b, update)
+		}
+	}
+}
+
+// BanMiddleware drops the updates of banned users (UserEntity.Banned).
+func BanMiddleware(handlerDeps *utils.HandlerDeps) Middleware {
+	if handlerDeps.Access == nil {
+		return nil
+	}
+	return func(next bot.HandlerFunc) bot.HandlerFunc {
+		return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+			if from := utils.SenderFromUpdate(update); from != nil && !from.IsBot {
+				banned, err := handlerDeps.Access.Banned(ctx, from.ID)
+				if err != nil {
+					handlerDeps.Logger.Errorf("ban check %d: %v", from.ID, err)
+				}
+				if banned {
+					handlerDeps.Logger.Debugf("update %d from banned user %d dropped", update.ID, from.ID)
+					return
+				}
+			}
+			next(ctx, b, update)
+		}
+	}
+}
+
+// LanguageMiddleware puts the preferred language of the sender in the context
+// (utils.WithLang), read by HandlerDeps.Lang.
+func LanguageMiddleware(handlerDeps *utils.HandlerDeps) Middleware {
+	if handlerDeps.Access == nil {
+		return nil
+	}
+	return func(next bot.HandlerFunc) bot.HandlerFunc {
+		return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+			if from := utils.SenderFromUpdate(update); from != nil && !from.IsBot {
+				lang, err := handlerDeps.Access.Language(ctx, from.ID)
+				if err != nil {
+					handlerDeps.Logger.Errorf("language %d: %v", from.ID, err)
+				} else {
+					ctx = utils.WithLang(ctx, lang)
+				}
+			}
+			next(ctx, b, update)
+		}
+	}
+}
+
+// TranscriptMiddleware stores incoming messages when APP_PERSIST_MESSAGES is set
+// (outgoing ones are captured by the sender).
+func TranscriptMiddleware(handlerDeps *utils.HandlerDeps) Middleware {
+	if handlerDeps.Transcript == nil {
+		return nil
+	}
+	return handlerDeps.Transcript.Middleware()
+}
+
+// lastSeenInterval limits the last-seen writes to one per user per interval (per replica).
+const lastSeenInterval = time.Minute
+
+// LastSeenMiddleware records the activity of the known users (UserEntity.LastSeenAt).
+func LastSeenMiddleware(handlerDeps *utils.HandlerDeps) Middleware {
+	if handlerDeps.RepositoryList == nil || handlerDeps.RepositoryList.UserRepository == nil {
+		return nil
+	}
+	var (
+		mu   sync.Mutex
+		seen = map[int64]time.Time{}
+	)
+	return func(next bot.HandlerFunc) bot.HandlerFunc {
+		return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+			if from := utils.SenderFromUpdate(update); from != nil && !from.IsBot {
+				now := time.Now()
+				mu.Lock()
+				due := now.Sub(seen[from.ID]) >= lastSeenInterval
+				if due {
+					if len(seen) > 10000 {
+						for id, t := range seen {
+							if now.Sub(t) >= lastSeenInterval {
+								delete(seen, id)
+							}
+						}
+					}
+					seen[from.ID] = now
+				}
+				mu.Unlock()
+
+				if due {
+					err := handlerDeps.RepositoryList.UserRepository.TouchLastSeen(ctx, from.ID, now)
+					if err != nil && !errors.Is(err, repo.UserErrNotFound) {
+						handlerDeps.Logger.Errorf("last seen %d: %v", from.ID, err)
+					}
+				}
+			}
+			next(ctx, b, update)
+		}
+	}
+}
+
+// LogUpdateMiddleware dumps every incoming update as JSON at debug level.
+func LogUpdateMiddleware(handlerDeps *utils.HandlerDeps) Middleware {
+	return func(next bot.HandlerFunc) bot.HandlerFunc {
+		return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+			json, err := utils.JSON(update, false, false)
+			if err != nil {
+				handlerDeps.Logger.Errorf("marshal update: %v", err)
+				return
+			}
+			handlerDeps.Logger.Debugf("update: %s", string(json))
+
+			next(ctx, b, update)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+func TestChainOrder(t *testing.T) {
+	var calls []string
+	record := func(name string) Middleware {
+		return func(next bot.HandlerFunc) bot.HandlerFunc {
+			return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+				calls = append(calls, name+" in")
+				next(ctx, b, update)
+				calls = append(calls, name+" out")
+			}
+		}
+	}
+
+	h := NewChain(record("a"), nil).Use(record("b")).Then(func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		calls = append(calls, "handler")
+	})
+	h(context.Background(), nil, &models.Update{})
+
+	want := []string{"a in", "b in", "handler", "b out", "a out"}
+	if !slices.Equal(calls, want) {
+		t.Fatalf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestChainStop(t *testing.T) {
+	stop := func(next bot.HandlerFunc) bot.HandlerFunc {
+		return func(ctx context.Context, b *bot.Bot, update *models.Update) {}
+	}
+	called := false
+	NewChain(stop).Then(func(ctx context.Context, b *bot.Bot, update *models.Update) { called = true })(context.Background(), nil, &models.Update{})
+	if called {
+		t.Fatal("the handler ran after a middleware stopped the update")
+	}
+}
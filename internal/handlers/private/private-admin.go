@@ -0,0 +1,484 @@
+package private
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/frangi01/bbtelgo/internal/callback"
+	"github.com/frangi01/bbtelgo/internal/conversation"
+	"github.com/frangi01/bbtelgo/internal/entities"
+	"github.com/frangi01/bbtelgo/internal/repo"
+	"github.com/frangi01/bbtelgo/internal/utils"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// Admin panel: /admin opens the menu, every button is an "admin" callback carrying
+// a signed adminPayload; both routes are restricted to admins (see routes/callbackRoutes).
+
+const adminRoute = "admin"
+
+// adminPayload actions
+const (
+	adminHome    = "home"
+	adminFind    = "find"
+	adminStats   = "stats"
+	adminUser    = "user"
+	adminBan     = "ban"
+	adminUnban   = "unban"
+	adminRoles   = "roles"
+	adminMsgs    = "msgs"
+	adminRLReset = "rlreset"
+	adminExport  = "export"
+	adminErase   = "erase"
+	adminEraseOK = "eraseok"
+)
+
+// adminRoleToggles are the role actions (kept short: callback data is 64 bytes at most)
+var adminRoleToggles = map[string]entities.Role{
+	"tadm": entities.RoleAdmin,
+	"tmod": entities.RoleModerator,
+}
+
+const (
+	adminRecentMessages = 10
+	adminSnippetLen     = 80
+	adminTimeFormat     = "2006-01-02 15:04"
+
+	adminLookupQuery conversation.State = "query"
+)
+
+type adminPayload struct {
+	Action string `json:"a"`
+	UserID int64  `json:"u,omitempty"`
+}
+
+func (p adminPayload) Validate() error {
+	if p.Action == "" {
+		return errors.New("admin: empty action")
+	}
+	return nil
+}
+
+type adminButton struct {
+	Label   string
+	Payload adminPayload
+}
+
+func init() {
+	conversations.Register(conversation.Flow[*utils.HandlerDeps]{
+		Name:    "admin_lookup",
+		Initial: adminLookupQuery,
+		Steps: map[conversation.State]conversation.Step[*utils.HandlerDeps]{
+			adminLookupQuery: {
+				Enter:  prompt("admin.ask_user"),
+				Handle: adminLookupStep,
+			},
+		},
+		OnCancel:  prompt("conversation.cancelled"),
+		OnTimeout: prompt("conversation.expired"),
+	})
+}
+
+func adminHandler(ctx context.Context, b *bot.Bot, u *models.Update, _ []string, deps *utils.HandlerDeps, lang string) error {
+	text, kb, err := adminHomeView(ctx, deps, lang)
+	if err != nil {
+		return err
+	}
+	return adminShow(ctx, b, u, deps, text, kb)
+}
+
+func adminCallbackHandler(ctx context.Context, b *bot.Bot, u *models.Update, _ []string, deps *utils.HandlerDeps, lang string) error {
+	cb := u.CallbackQuery
+	payload, err := callback.Decode[adminPayload](ctx, deps.Callbacks, cb.Data)
+	if err != nil {
+		deps.Logger.Warnf("admin callback from %d: %v", cb.From.ID, err)
+		_, err = deps.Sender.SendMessage(ctx, b, &bot.SendMessageParams{
+			ChatID: cb.From.ID,
+			Text:   deps.I18n.T(lang, "callback.invalid", nil),
+		})
+		return err
+	}
+
+	var (
+		text string
+		kb   *models.InlineKeyboardMarkup
+	)
+	switch payload.Action {
+	case adminHome:
+		text, kb, err = adminHomeView(ctx, deps, lang)
+	case adminFind:
+		if err := conversations.Start(ctx, b, u, deps.Conversations, "admin_lookup", deps, lang); err != nil {
+			return fmt.Errorf("start admin lookup: %w", err)
+		}
+		return nil
+	case adminStats:
+		text, kb, err = adminStatsView(ctx, deps, lang)
+	default:
+		text, kb, err = adminUserAction(ctx, b, u, deps, lang, payload)
+	}
+	if err != nil {
+		return err
+	}
+	return adminShow(ctx, b, u, deps, text, kb)
+}
+
+// adminUserAction runs the actions on a user and returns the view to show next.
+func adminUserAction(ctx context.Context, b *bot.Bot, u *models.Update, deps *utils.HandlerDeps, lang string, p adminPayload) (string, *models.InlineKeyboardMarkup, error) {
+	users := deps.RepositoryList.UserRepository
+	user, err := users.FindByTelegramID(ctx, p.UserID)
+	if errors.Is(err, repo.UserErrNotFound) {
+		return adminNotFoundView(ctx, deps, lang, strconv.FormatInt(p.UserID, 10))
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("admin: find user %d: %w", p.UserID, err)
+	}
+	actorID := u.CallbackQuery.From.ID
+
+	notice := ""
+	switch p.Action {
+	case adminUser:
+	case adminRoles:
+		return adminRolesView(ctx, deps, lang, user)
+	case adminMsgs:
+		return adminMessagesView(ctx, deps, lang, user)
+	case adminBan, adminUnban:
+		if p.UserID == actorID {
+			notice = "admin.notice.self_ban"
+			break
+		}
+		banned := p.Action == adminBan
+		if err := users.SetBanned(ctx, p.UserID, banned, ""); err != nil {
+			return "", nil, fmt.Errorf("admin: %s %d: %w", p.Action, p.UserID, err)
+		}
+		deps.Access.Invalidate(ctx, p.UserID)
+		adminAudit(ctx, deps, actorID, "admin."+p.Action, p.UserID, nil)
+		user.Banned = banned
+		notice = "admin.notice." + p.Action
+	case adminRLReset:
+		if err := deps.ResetRateLimit(ctx, p.UserID); err != nil {
+			return "", nil, fmt.Errorf("admin: reset rate limit %d: %w", p.UserID, err)
+		}
+		adminAudit(ctx, deps, actorID, "admin.ratelimit.reset", p.UserID, nil)
+		notice = "admin.notice.rlreset"
+	case adminExport:
+		if err := sendExport(ctx, b, deps, u.CallbackQuery.From.ID, p.UserID, actorID, "admin.export_caption", lang); err != nil {
+			return "", nil, fmt.Errorf("admin: %w", err)
+		}
+		notice = "admin.notice.exported"
+	case adminErase:
+		if p.UserID == actorID {
+			notice = "admin.notice.self"
+			break
+		}
+		return adminEraseView(ctx, deps, lang, user)
+	case adminEraseOK:
+		if p.UserID == actorID {
+			notice = "admin.notice.self"
+			break
+		}
+		report, err := deps.GDPR.Erase(ctx, p.UserID, actorID)
+		if err != nil {
+			return "", nil, err
+		}
+		kb, err := adminKeyboard(ctx, deps, [][]adminButton{{adminBack(deps, lang, 0)}})
+		return deps.I18n.T(lang, "admin.erased", map[string]any{
+			"id":         p.UserID,
+			"messages":   report.Messages,
+			"anonymized": report.Anonymized,
+			"keys":       report.CacheKeys,
+		}), kb, err
+	default:
+		role, ok := adminRoleToggles[p.Action]
+		if !ok {
+			return "", nil, fmt.Errorf("admin: unknown action %q", p.Action)
+		}
+		// an admin can't drop (or grant) its own roles, nor lock itself out
+		if p.UserID == actorID {
+			notice = "admin.notice.self"
+			break
+		}
+		action := "admin.role.add"
+		if user.HasRole(role) {
+			action = "admin.role.remove"
+			err = users.RemoveRole(ctx, p.UserID, role)
+		} else {
+			err = users.AddRole(ctx, p.UserID, role)
+		}
+		if err != nil {
+			return "", nil, fmt.Errorf("admin: %s %s %d: %w", action, role, p.UserID, err)
+		}
+		deps.Access.Invalidate(ctx, p.UserID)
+		adminAudit(ctx, deps, actorID, action, p.UserID, map[string]any{"role": role})
+
+		if user, err = users.FindByTelegramID(ctx, p.UserID); err != nil {
+			return "", nil, fmt.Errorf("admin: reload user %d: %w", p.UserID, err)
+		}
+		return adminRolesView(ctx, deps, lang, user)
+	}
+	return adminUserView(ctx, deps, lang, user, notice)
+}
+
+// adminLookupStep finds the user by Telegram ID or @username; it asks again when nothing matches.
+func adminLookupStep(ctx context.Context, b *bot.Bot, u *models.Update, conv *entities.ConversationEntity, deps *utils.HandlerDeps, lang string) (conversation.State, error) {
+	query := strings.TrimSpace(u.Message.Text)
+	if query == "" {
+		return adminLookupQuery, prompt("admin.ask_user")(ctx, b, u, conv, deps, lang)
+	}
+
+	users := deps.RepositoryList.UserRepository
+	var (
+		user *entities.UserEntity
+		err  error
+	)
+	if id, convErr := strconv.ParseInt(query, 10, 64); convErr == nil {
+		user, err = users.FindByTelegramID(ctx, id)
+	} else {
+		user, err = users.FindByUsername(ctx, query)
+	}
+	if errors.Is(err, repo.UserErrNotFound) {
+		_, err = deps.Sender.SendMessage(ctx, b, &bot.SendMessageParams{
+			ChatID: conv.ChatID,
+			Text:   deps.I18n.T(lang, "admin.user_not_found", map[string]any{"query": query}),
+		})
+		return adminLookupQuery, err
+	}
+	if err != nil {
+		return adminLookupQuery, fmt.Errorf("admin: lookup %q: %w", query, err)
+	}
+
+	text, kb, err := adminUserView(ctx, deps, lang, user, "")
+	if err != nil {
+		return adminLookupQuery, err
+	}
+	return conversation.End, adminShow(ctx, b, u, deps, text, kb)
+}
+
+func adminHomeView(ctx context.Context, deps *utils.HandlerDeps, lang string) (string, *models.InlineKeyboardMarkup, error) {
+	kb, err := adminKeyboard(ctx, deps, [][]adminButton{{
+		{Label: deps.I18n.T(lang, "admin.button.find", nil), Payload: adminPayload{Action: adminFind}},
+		{Label: deps.I18n.T(lang, "admin.button.stats", nil), Payload: adminPayload{Action: adminStats}},
+	}})
+	return deps.I18n.T(lang, "admin.menu", nil), kb, err
+}
+
+func adminNotFoundView(ctx context.Context, deps *utils.HandlerDeps, lang string, query string) (string, *models.InlineKeyboardMarkup, error) {
+	kb, err := adminKeyboard(ctx, deps, [][]adminButton{{adminBack(deps, lang, 0)}})
+	return deps.I18n.T(lang, "admin.user_not_found", map[string]any{"query": query}), kb, err
+}
+
+func adminUserView(ctx context.Context, deps *utils.HandlerDeps, lang string, user *entities.UserEntity, notice string) (string, *models.InlineKeyboardMarkup, error) {
+	roles := make([]string, 0, len(user.Roles))
+	for _, r := range user.Roles {
+		roles = append(roles, string(r))
+	}
+	if len(roles) == 0 {
+		roles = append(roles, string(entities.RoleUser))
+	}
+	banned := deps.I18n.T(lang, "common.no", nil)
+	if user.Banned {
+		banned = deps.I18n.T(lang, "common.yes", nil)
+	}
+	lastSeen := deps.I18n.T(lang, "admin.never", nil)
+	if user.LastSeenAt != nil {
+		lastSeen = user.LastSeenAt.UTC().Format(adminTimeFormat)
+	}
+	username := "-"
+	if user.Username != "" {
+		username = "@" + user.Username
+	}
+
+	text := deps.I18n.T(lang, "admin.user_card", map[string]any{
+		"name":      adminDisplayName(user),
+		"username":  username,
+		"id":        user.ID,
+		"lang":      user.Lang(),
+		"roles":     strings.Join(roles, ", "),
+		"banned":    banned,
+		"last_seen": lastSeen,
+		"created":   user.CreatedAt.UTC().Format(adminTimeFormat),
+	})
+	if notice != "" {
+		text = deps.I18n.T(lang, notice, nil) + "\n\n" + text
+	}
+
+	ban := adminButton{Label: deps.I18n.T(lang, "admin.button.ban", nil), Payload: adminPayload{Action: adminBan, UserID: user.ID}}
+	if user.Banned {
+		ban = adminButton{Label: deps.I18n.T(lang, "admin.button.unban", nil), Payload: adminPayload{Action: adminUnban, UserID: user.ID}}
+	}
+	kb, err := adminKeyboard(ctx, deps, [][]adminButton{
+		{
+			ban,
+			{Label: deps.I18n.T(lang, "admin.button.roles", nil), Payload: adminPayload{Action: adminRoles, UserID: user.ID}},
+		},
+		{
+			{Label: deps.I18n.T(lang, "admin.button.messages", nil), Payload: adminPayload{Action: adminMsgs, UserID: user.ID}},
+			{Label: deps.I18n.T(lang, "admin.button.rlreset", nil), Payload: adminPayload{Action: adminRLReset, UserID: user.ID}},
+		},
+		{
+			{Label: deps.I18n.T(lang, "admin.button.export", nil), Payload: adminPayload{Action: adminExport, UserID: user.ID}},
+			{Label: deps.I18n.T(lang, "admin.button.erase", nil), Payload: adminPayload{Action: adminErase, UserID: user.ID}},
+		},
+		{adminBack(deps, lang, 0)},
+	})
+	return text, kb, err
+}
+
+func adminEraseView(ctx context.Context, deps *utils.HandlerDeps, lang string, user *entities.UserEntity) (string, *models.InlineKeyboardMarkup, error) {
+	kb, err := adminKeyboard(ctx, deps, [][]adminButton{{
+		{Label: deps.I18n.T(lang, "admin.button.erase_confirm", nil), Payload: adminPayload{Action: adminEraseOK, UserID: user.ID}},
+		adminBack(deps, lang, user.ID),
+	}})
+	return deps.I18n.T(lang, "admin.erase_confirm", map[string]any{"name": adminDisplayName(user)}), kb, err
+}
+
+func adminRolesView(ctx context.Context, deps *utils.HandlerDeps, lang string, user *entities.UserEntity) (string, *models.InlineKeyboardMarkup, error) {
+	var row []adminButton
+	for _, action := range []string{"tadm", "tmod"} {
+		role := adminRoleToggles[action]
+		mark := "▫️ "
+		if user.HasRole(role) {
+			mark = "✅ "
+		}
+		row = append(row, adminButton{Label: mark + string(role), Payload: adminPayload{Action: action, UserID: user.ID}})
+	}
+	kb, err := adminKeyboard(ctx, deps, [][]adminButton{row, {adminBack(deps, lang, user.ID)}})
+	return deps.I18n.T(lang, "admin.roles", map[string]any{"name": adminDisplayName(user)}), kb, err
+}
+
+func adminMessagesView(ctx context.Context, deps *utils.HandlerDeps, lang string, user *entities.UserEntity) (string, *models.InlineKeyboardMarkup, error) {
+	fromID := user.ID
+	page, err := deps.RepositoryList.MessageRepository.List(ctx, repo.MessageListOptions{
+		MessageFilter: repo.MessageFilter{FromID: &fromID},
+		PerPage:       adminRecentMessages,
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("admin: messages of %d: %w", user.ID, err)
+	}
+
+	var sb strings.Builder
+	if len(page.Items) == 0 {
+		sb.WriteString(deps.I18n.T(lang, "admin.messages.empty", map[string]any{"name": adminDisplayName(user)}))
+	} else {
+		sb.WriteString(deps.I18n.T(lang, "admin.messages.title", map[string]any{"name": adminDisplayName(user), "count": len(page.Items)}))
+		for _, m := range page.Items {
+			text := m.Text
+			if text == "" {
+				text = m.Caption
+			}
+			if text == "" {
+				text = deps.I18n.T(lang, "admin.messages.media", nil)
+			}
+			fmt.Fprintf(&sb, "\n\n[%s] %d\n%s",
+				time.Unix(int64(m.Date), 0).UTC().Format(adminTimeFormat), m.Chat.ID, adminTruncate(text, adminSnippetLen))
+		}
+	}
+	kb, err := adminKeyboard(ctx, deps, [][]adminButton{{adminBack(deps, lang, user.ID)}})
+	return sb.String(), kb, err
+}
+
+func adminStatsView(ctx context.Context, deps *utils.HandlerDeps, lang string) (string, *models.InlineKeyboardMarkup, error) {
+	users, err := deps.RepositoryList.UserRepository.List(ctx, repo.ListOptions{PerPage: 1, CountTotal: true})
+	if err != nil {
+		return "", nil, fmt.Errorf("admin: count users: %w", err)
+	}
+	messages, err := deps.RepositoryList.MessageRepository.List(ctx, repo.MessageListOptions{PerPage: 1, CountTotal: true})
+	if err != nil {
+		return "", nil, fmt.Errorf("admin: count messages: %w", err)
+	}
+	since := time.Now().Add(-24 * time.Hour).Unix()
+	recent, err := deps.RepositoryList.MessageRepository.List(ctx, repo.MessageListOptions{
+		MessageFilter: repo.MessageFilter{DateFrom: &since},
+		PerPage:       1,
+		CountTotal:    true,
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("admin: count recent messages: %w", err)
+	}
+
+	kb, err := adminKeyboard(ctx, deps, [][]adminButton{{adminBack(deps, lang, 0)}})
+	return deps.I18n.T(lang, "admin.stats", map[string]any{
+		"users":        users.Total,
+		"messages":     messages.Total,
+		"messages_day": recent.Total,
+	}), kb, err
+}
+
+// adminBack goes back to the user card, or to the menu when userID is 0
+func adminBack(deps *utils.HandlerDeps, lang string, userID int64) adminButton {
+	p := adminPayload{Action: adminHome}
+	if userID != 0 {
+		p = adminPayload{Action: adminUser, UserID: userID}
+	}
+	return adminButton{Label: deps.I18n.T(lang, "admin.button.back", nil), Payload: p}
+}
+
+func adminKeyboard(ctx context.Context, deps *utils.HandlerDeps, rows [][]adminButton) (*models.InlineKeyboardMarkup, error) {
+	kb := &models.InlineKeyboardMarkup{InlineKeyboard: make([][]models.InlineKeyboardButton, 0, len(rows))}
+	for _, row := range rows {
+		buttons := make([]models.InlineKeyboardButton, 0, len(row))
+		for _, btn := range row {
+			data, err := deps.Callbacks.Encode(ctx, adminRoute, btn.Payload)
+			if err != nil {
+				return nil, fmt.Errorf("admin: encode %s: %w", btn.Payload.Action, err)
+			}
+			buttons = append(buttons, models.InlineKeyboardButton{Text: btn.Label, CallbackData: data})
+		}
+		kb.InlineKeyboard = append(kb.InlineKeyboard, buttons)
+	}
+	return kb, nil
+}
+
+// adminShow edits the panel message on button clicks and sends a new one otherwise.
+func adminShow(ctx context.Context, b *bot.Bot, u *models.Update, deps *utils.HandlerDeps, text string, kb *models.InlineKeyboardMarkup) error {
+	if cb := u.CallbackQuery; cb != nil && cb.Message.Message != nil {
+		_, err := deps.Sender.EditMessageText(ctx, b, &bot.EditMessageTextParams{
+			ChatID:      cb.Message.Message.Chat.ID,
+			MessageID:   cb.Message.Message.ID,
+			Text:        text,
+			ReplyMarkup: kb,
+		})
+		// same view clicked twice
+		if err != nil && strings.Contains(err.Error(), "message is not modified") {
+			return nil
+		}
+		return err
+	}
+	_, err := deps.Sender.SendMessage(ctx, b, &bot.SendMessageParams{
+		ChatID:      utils.ChatIDFromUpdate(u),
+		Text:        text,
+		ReplyMarkup: kb,
+	})
+	return err
+}
+
+func adminAudit(ctx context.Context, deps *utils.HandlerDeps, actorID int64, action string, targetID int64, details map[string]any) {
+	deps.Access.Record(ctx, &entities.AuditEntity{
+		Action:   action,
+		ActorID:  actorID,
+		TargetID: targetID,
+		ChatID:   actorID,
+		Outcome:  entities.AuditAllowed,
+		Details:  details,
+	})
+}
+
+func adminDisplayName(user *entities.UserEntity) string {
+	if name := strings.TrimSpace(user.FirstName + " " + user.LastName); name != "" {
+		return name
+	}
+	return strconv.FormatInt(user.ID, 10)
+}
+
+func adminTruncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	r := []rune(s)
+	return string(r[:n]) + "…"
+}
@@ -2,7 +2,9 @@ package private
 
 import (
 	"context"
+	"errors"
 
+	"github.com/frangi01/bbtelgo/internal/callback"
 	"github.com/frangi01/bbtelgo/internal/utils"
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
@@ -10,46 +12,77 @@ import (
 
 
 
-func button1Handler(ctx context.Context, b *bot.Bot, u *models.Update, _ []string, deps *utils.HandlerDeps, lang string) {
+func button1Handler(ctx context.Context, b *bot.Bot, u *models.Update, _ []string, deps *utils.HandlerDeps, lang string) error {
 
-	b.SendChatAction(ctx, &bot.SendChatActionParams{
+	if _, err := b.SendChatAction(ctx, &bot.SendChatActionParams{
 		ChatID: u.CallbackQuery.Message.Message.Chat.ID,
 		Action: models.ChatActionTyping,
-	})
+	}); err != nil {
+		return err
+	}
 
 	
-	b.SendMessage(ctx, &bot.SendMessageParams{
+	_, err := deps.Sender.SendMessage(ctx, b, &bot.SendMessageParams{
 		ChatID:      u.CallbackQuery.Message.Message.Chat.ID,
 		Text:        "Button 1 clicked",
 	})
+	return err
+}
+
+
+// button2Payload is carried by the button_2 callback data (see startHandler)
+type button2Payload struct {
+	Arg string `json:"a"`
 }
 
+func (p button2Payload) Validate() error {
+	if p.Arg == "" {
+		return errors.New("button_2: empty arg")
+	}
+	return nil
+}
 
-func button2Handler(ctx context.Context, b *bot.Bot, u *models.Update, args []string, deps *utils.HandlerDeps, lang string) {
+func button2Handler(ctx context.Context, b *bot.Bot, u *models.Update, _ []string, deps *utils.HandlerDeps, lang string) error {
+	payload, err := callback.Decode[button2Payload](ctx, deps.Callbacks, u.CallbackQuery.Data)
+	if err != nil {
+		deps.Logger.Warnf("button_2 callback from %d: %v", u.CallbackQuery.From.ID, err)
+		// the message of the button may be inaccessible: answer in the private chat of the user
+		_, err = deps.Sender.SendMessage(ctx, b, &bot.SendMessageParams{
+			ChatID:      u.CallbackQuery.From.ID,
+			Text:        deps.I18n.T(lang, "callback.invalid", nil),
+		})
+		return err
+	}
 
-	b.SendChatAction(ctx, &bot.SendChatActionParams{
+	if _, err := b.SendChatAction(ctx, &bot.SendChatActionParams{
 		ChatID: u.CallbackQuery.Message.Message.Chat.ID,
 		Action: models.ChatActionTyping,
-	})
+	}); err != nil {
+		return err
+	}
 
 	
-	b.SendMessage(ctx, &bot.SendMessageParams{
+	_, err = deps.Sender.SendMessage(ctx, b, &bot.SendMessageParams{
 		ChatID:      u.CallbackQuery.Message.Message.Chat.ID,
-		Text:        "Button 2 clicked with args " + args[0],
+		Text:        "Button 2 clicked with args " + payload.Arg,
 	})
+	return err
 }
 
-func button3Handler(ctx context.Context, b *bot.Bot, u *models.Update, args []string, deps *utils.HandlerDeps, lang string) {
+func button3Handler(ctx context.Context, b *bot.Bot, u *models.Update, args []string, deps *utils.HandlerDeps, lang string) error {
 
-	b.SendChatAction(ctx, &bot.SendChatActionParams{
+	if _, err := b.SendChatAction(ctx, &bot.SendChatActionParams{
 		ChatID: u.CallbackQuery.Message.Message.Chat.ID,
 		Action: models.ChatActionTyping,
-	})
+	}); err != nil {
+		return err
+	}
 
 	
-	b.EditMessageText(ctx, &bot.EditMessageTextParams{
+	_, err := deps.Sender.EditMessageText(ctx, b, &bot.EditMessageTextParams{
 		MessageID: u.CallbackQuery.Message.Message.ID,
 		ChatID:      u.CallbackQuery.Message.Message.Chat.ID,
 		Text:        "Button 3 clicked",
 	})
-}
\ No newline at end of file
+	return err
+}
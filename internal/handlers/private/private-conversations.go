@@ -0,0 +1,115 @@
+package private
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"strings"
+
+	"github.com/frangi01/bbtelgo/internal/conversation"
+	"github.com/frangi01/bbtelgo/internal/entities"
+	"github.com/frangi01/bbtelgo/internal/utils"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// conversations holds the multi-step dialogs of private chats; "/cancel" aborts any of them.
+var conversations = conversation.NewManager[*utils.HandlerDeps]("/cancel")
+
+const (
+	registerName    conversation.State = "name"
+	registerEmail   conversation.State = "email"
+	registerConfirm conversation.State = "confirm"
+)
+
+// Example wizard: name -> email -> confirm
+func init() {
+	conversations.Register(conversation.Flow[*utils.HandlerDeps]{
+		Name:    "register",
+		Initial: registerName,
+		Steps: map[conversation.State]conversation.Step[*utils.HandlerDeps]{
+			registerName: {
+				Enter:  prompt("register.ask_name"),
+				Handle: registerNameStep,
+				Next:   []conversation.State{registerEmail},
+			},
+			registerEmail: {
+				Enter:  prompt("register.ask_email"),
+				Handle: registerEmailStep,
+				Next:   []conversation.State{registerConfirm},
+			},
+			registerConfirm: {
+				Enter:  registerConfirmPrompt,
+				Handle: registerConfirmStep,
+			},
+		},
+		OnCancel:  prompt("conversation.cancelled"),
+		OnTimeout: prompt("conversation.expired"),
+	})
+}
+
+func registerHandler(ctx context.Context, b *bot.Bot, u *models.Update, _ []string, deps *utils.HandlerDeps, lang string) error {
+	if err := conversations.Start(ctx, b, u, deps.Conversations, "register", deps, lang); err != nil {
+		return fmt.Errorf("start register conversation: %w", err)
+	}
+	return nil
+}
+
+// cancelHandler runs only without an active conversation: the manager catches "/cancel" first.
+func cancelHandler(ctx context.Context, b *bot.Bot, u *models.Update, _ []string, deps *utils.HandlerDeps, lang string) error {
+	_, err := deps.Sender.SendMessage(ctx, b, &bot.SendMessageParams{
+		ChatID: u.Message.Chat.ID,
+		Text:   deps.I18n.T(lang, "conversation.nothing_to_cancel", nil),
+	})
+	return err
+}
+
+func registerNameStep(ctx context.Context, b *bot.Bot, u *models.Update, conv *entities.ConversationEntity, deps *utils.HandlerDeps, lang string) (conversation.State, error) {
+	name := strings.TrimSpace(u.Message.Text)
+	if name == "" {
+		return registerName, prompt("register.ask_name")(ctx, b, u, conv, deps, lang)
+	}
+	conv.Data["name"] = name
+	return registerEmail, nil
+}
+
+func registerEmailStep(ctx context.Context, b *bot.Bot, u *models.Update, conv *entities.ConversationEntity, deps *utils.HandlerDeps, lang string) (conversation.State, error) {
+	email := strings.TrimSpace(u.Message.Text)
+	if _, err := mail.ParseAddress(email); err != nil {
+		return registerEmail, prompt("register.invalid_email")(ctx, b, u, conv, deps, lang)
+	}
+	conv.Data["email"] = email
+	return registerConfirm, nil
+}
+
+func registerConfirmPrompt(ctx context.Context, b *bot.Bot, u *models.Update, conv *entities.ConversationEntity, deps *utils.HandlerDeps, lang string) error {
+	_, err := deps.Sender.SendMessage(ctx, b, &bot.SendMessageParams{
+		ChatID: conv.ChatID,
+		Text: deps.I18n.T(lang, "register.confirm", map[string]any{
+			"name":  conv.Data["name"],
+			"email": conv.Data["email"],
+		}),
+	})
+	return err
+}
+
+func registerConfirmStep(ctx context.Context, b *bot.Bot, u *models.Update, conv *entities.ConversationEntity, deps *utils.HandlerDeps, lang string) (conversation.State, error) {
+	switch strings.ToLower(strings.TrimSpace(u.Message.Text)) {
+	case strings.ToLower(deps.I18n.T(lang, "common.yes", nil)):
+		return conversation.End, prompt("register.done")(ctx, b, u, conv, deps, lang)
+	case strings.ToLower(deps.I18n.T(lang, "common.no", nil)):
+		return registerName, nil
+	}
+	return registerConfirm, registerConfirmPrompt(ctx, b, u, conv, deps, lang)
+}
+
+// prompt returns a hook that sends the localized text of key
+func prompt(key string) conversation.Hook[*utils.HandlerDeps] {
+	return func(ctx context.Context, b *bot.Bot, u *models.Update, conv *entities.ConversationEntity, deps *utils.HandlerDeps, lang string) error {
+		_, err := deps.Sender.SendMessage(ctx, b, &bot.SendMessageParams{
+			ChatID: conv.ChatID,
+			Text:   deps.I18n.T(lang, key, nil),
+		})
+		return err
+	}
+}
@@ -0,0 +1,133 @@
+package private
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/frangi01/bbtelgo/internal/callback"
+	"github.com/frangi01/bbtelgo/internal/gdpr"
+	"github.com/frangi01/bbtelgo/internal/utils"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// /mydata sends the export of the user, /forgetme erases it after a confirmation
+// (the "forgetme" callback). Admins do the same from the /admin panel.
+
+const forgetmeRoute = "forgetme"
+
+// forgetmePayload is carried by the confirmation buttons of /forgetme
+type forgetmePayload struct {
+	UserID  int64 `json:"u"`
+	Confirm bool  `json:"c,omitempty"`
+}
+
+func mydataHandler(ctx context.Context, b *bot.Bot, u *models.Update, _ []string, deps *utils.HandlerDeps, lang string) error {
+	if u.Message.From == nil {
+		return nil
+	}
+	return sendExport(ctx, b, deps, u.Message.Chat.ID, u.Message.From.ID, u.Message.From.ID, "gdpr.export_caption", lang)
+}
+
+func forgetmeHandler(ctx context.Context, b *bot.Bot, u *models.Update, _ []string, deps *utils.HandlerDeps, lang string) error {
+	if u.Message.From == nil {
+		return nil
+	}
+	userID := u.Message.From.ID
+	confirm, err := deps.Callbacks.Encode(ctx, forgetmeRoute, forgetmePayload{UserID: userID, Confirm: true})
+	if err != nil {
+		return fmt.Errorf("encode forgetme: %w", err)
+	}
+	cancel, err := deps.Callbacks.Encode(ctx, forgetmeRoute, forgetmePayload{UserID: userID})
+	if err != nil {
+		return fmt.Errorf("encode forgetme: %w", err)
+	}
+
+	_, err = deps.Sender.SendMessage(ctx, b, &bot.SendMessageParams{
+		ChatID: u.Message.Chat.ID,
+		Text:   deps.I18n.T(lang, "gdpr.erase_confirm", nil),
+		ReplyMarkup: &models.InlineKeyboardMarkup{
+			InlineKeyboard: [][]models.InlineKeyboardButton{{
+				{Text: deps.I18n.T(lang, "gdpr.button.confirm", nil), CallbackData: confirm},
+				{Text: deps.I18n.T(lang, "gdpr.button.cancel", nil), CallbackData: cancel},
+			}},
+		},
+	})
+	return err
+}
+
+func forgetmeCallbackHandler(ctx context.Context, b *bot.Bot, u *models.Update, _ []string, deps *utils.HandlerDeps, lang string) error {
+	cb := u.CallbackQuery
+	payload, err := callback.Decode[forgetmePayload](ctx, deps.Callbacks, cb.Data)
+	if err == nil && payload.UserID != cb.From.ID {
+		err = fmt.Errorf("forgetme: button of %d clicked by %d", payload.UserID, cb.From.ID)
+	}
+	if err != nil || cb.Message.Message == nil {
+		deps.Logger.Warnf("forgetme callback from %d: %v", cb.From.ID, err)
+		_, err = deps.Sender.SendMessage(ctx, b, &bot.SendMessageParams{
+			ChatID: cb.From.ID,
+			Text:   deps.I18n.T(lang, "callback.invalid", nil),
+		})
+		return err
+	}
+
+	key := "gdpr.erase_cancelled"
+	if payload.Confirm {
+		if _, err := deps.GDPR.Erase(ctx, cb.From.ID, cb.From.ID); err != nil {
+			return err
+		}
+		key = "gdpr.erased"
+	}
+	// not through deps.Sender: its transcript hook would store the notice again
+	_, err = b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:    cb.Message.Message.Chat.ID,
+		MessageID: cb.Message.Message.ID,
+		Text:      deps.I18n.T(lang, key, nil),
+	})
+	return err
+}
+
+// exportMaxSize is the upload limit of the Bot API for documents.
+const exportMaxSize = 50 << 20
+
+// sendExport sends the ZIP export of userID to chatID; actorID is who asked for it.
+// The export is built in a temp file (it can be large); past exportMaxSize the
+// gdpr.export_too_large notice is sent instead.
+func sendExport(ctx context.Context, b *bot.Bot, deps *utils.HandlerDeps, chatID, userID, actorID int64, caption, lang string) error {
+	f, err := os.CreateTemp("", fmt.Sprintf("export-%d-*.zip", userID))
+	if err != nil {
+		return fmt.Errorf("export %d: %w", userID, err)
+	}
+	defer func() {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+	}()
+
+	if err := deps.GDPR.Export(ctx, f, userID, actorID, gdpr.FormatZIP); err != nil {
+		return fmt.Errorf("export %d: %w", userID, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("export %d: %w", userID, err)
+	}
+	if info.Size() > exportMaxSize {
+		deps.Logger.Warnf("export %d: %d bytes, over the upload limit", userID, info.Size())
+		_, err := deps.Sender.SendMessage(ctx, b, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   deps.I18n.T(lang, "gdpr.export_too_large", map[string]any{"size_mb": info.Size() >> 20, "max_mb": exportMaxSize >> 20}),
+		})
+		return err
+	}
+
+	_, err = deps.Sender.SendDocument(ctx, b, &bot.SendDocumentParams{
+		ChatID: chatID,
+		Document: &models.InputFileUpload{
+			Filename: fmt.Sprintf("data-%d-%s.zip", userID, time.Now().UTC().Format("20060102")),
+			Data:     f, // rewound by the sender
+		},
+		Caption: deps.I18n.T(lang, caption, nil),
+	})
+	return err
+}
@@ -2,8 +2,12 @@ package private
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"strings"
 
+	"github.com/frangi01/bbtelgo/internal/commands"
+	"github.com/frangi01/bbtelgo/internal/rbac"
 	"github.com/frangi01/bbtelgo/internal/utils"
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
@@ -12,36 +16,86 @@ import (
 
 
 
-type HandleFunc func(ctx context.Context, b *bot.Bot, u *models.Update, _ []string, deps *utils.HandlerDeps, lang string)
+// HandleFunc is a route handler: returned errors go to the dispatcher error handler.
+type HandleFunc func(ctx context.Context, b *bot.Bot, u *models.Update, _ []string, deps *utils.HandlerDeps, lang string) error
+
+
+var routes = commands.NewTable(commands.ScopePrivate,
+	commands.Route[HandleFunc]{
+		Command: commands.Command{Name: "start", Description: "command.start"},
+		Handler: startHandler,
+	},
+	commands.Route[HandleFunc]{
+		Command: commands.Command{Name: "register", Description: "command.register"},
+		Handler: registerHandler,
+	},
+	commands.Route[HandleFunc]{
+		Command: commands.Command{Name: "cancel", Description: "command.cancel"},
+		Handler: cancelHandler,
+	},
+	commands.Route[HandleFunc]{
+		Command: commands.Command{Name: "mydata", Description: "command.mydata"},
+		Handler: mydataHandler,
+	},
+	commands.Route[HandleFunc]{
+		Command: commands.Command{Name: "forgetme", Description: "command.forgetme"},
+		Handler: forgetmeHandler,
+	},
+	commands.Route[HandleFunc]{
+		Command: commands.Command{Name: "admin", Description: "command.admin", Access: rbac.Admins},
+		Handler: adminHandler,
+	},
+	commands.Route[HandleFunc]{
+		Command: commands.Command{Name: "stats", Description: "command.stats", Access: statsAccess},
+		Handler: statsHandler,
+	},
+)
 
+// callbackRoute is the callback counterpart of a command route.
+type callbackRoute struct {
+	Handler HandleFunc
+	Access  rbac.Rule // zero = everyone
+}
 
-var routes = map[string]HandleFunc{
-	"/start": 	startHandler,
+var callbackRoutes = map[string]callbackRoute{
+	"button_1": {Handler: button1Handler},
+	"button_2": {Handler: button2Handler},
+	"button_3": {Handler: button3Handler},
+	forgetmeRoute: {Handler: forgetmeCallbackHandler},
+	adminRoute: {Handler: adminCallbackHandler, Access: rbac.Admins},
 }
 
-var callbackRoutes = map[string]HandleFunc{
-	"button_1": button1Handler,
-	"button_2": button2Handler,
-	"button_3": button3Handler,
+
+
+// Commands returns the private commands, for the Telegram menu.
+func Commands() []commands.Command {
+	return routes.Commands()
 }
 
+func HandlerMessage(ctx context.Context, b *bot.Bot, update *models.Update, handlerDeps *utils.HandlerDeps) error {
 
+	lang := handlerDeps.Lang(ctx, update.Message.From) // preferred language, else "en", "it", "en-US"... of the client
+	handlerDeps.Logger.Debugf("user lang: %v", lang)
 
-func HandlerMessage(ctx context.Context, b *bot.Bot, update *models.Update, handlerDeps *utils.HandlerDeps) {
+	// An active conversation (wizard) takes the message before the routes
+	if handlerDeps.Conversations != nil {
+		handled, err := conversations.Handle(ctx, b, update, handlerDeps.Conversations, handlerDeps, lang)
+		if err != nil {
+			return fmt.Errorf("conversation: %w", err)
+		}
+		if handled {
+			return nil
+		}
+	}
 	
 	if update.Message.Text != "" {
-		
-		lang := ""
-		if update.Message.From != nil {
-			lang = update.Message.From.LanguageCode // "en", "it", "de", "ru", "en-US"...
-		}
-		lang = handlerDeps.I18n.BestLang(lang)
-		handlerDeps.Logger.Debugf("user lang: %v", lang)
-
 		msg := strings.TrimSpace(update.Message.Text)
 
 		// Extract command and args (ex: "/start foo bar")
 		fields := strings.Fields(msg)
+		if len(fields) == 0 {
+			return nil
+		}
 		cmd := fields[0]
 		args := []string{}
 		if len(fields) > 1 {
@@ -54,36 +108,32 @@ func HandlerMessage(ctx context.Context, b *bot.Bot, update *models.Update, hand
 		}
 
 		// Dispatch
-		if h, ok := routes[cmd]; ok {
-			h(ctx, b, update, args, handlerDeps, lang)
-			return
+		if r, ok := routes.Lookup(cmd); ok {
+			allowed, err := handlerDeps.Authorize(ctx, b, update, "command:/"+r.Name, r.Access, lang)
+			if err != nil || !allowed {
+				return err
+			}
+			return r.Handler(ctx, b, update, args, handlerDeps, lang)
 		}
 	}
 	
 	if update.Message.Photo != nil {
-
-		lang := ""
-		if update.Message.From != nil {
-			lang = update.Message.From.LanguageCode // "en", "it", "de", "ru", "en-US"...
-		}
-		lang = handlerDeps.I18n.BestLang(lang)
-		handlerDeps.Logger.Debugf("user lang: %v", lang)
-
-
-		photoHandler(ctx, b, update, nil, handlerDeps, lang)
+		return photoHandler(ctx, b, update, nil, handlerDeps, lang)
 	}
 
 
 
 	// enable for send msg when user send a command not in routes
-	//defaultHandler(ctx, b, update, args)
+	//return defaultHandler(ctx, b, update, args)
+	return nil
 }
 
-func HandlerCallBackQuery(ctx context.Context, b *bot.Bot, update *models.Update, handlerDeps *utils.HandlerDeps) {
+func HandlerCallBackQuery(ctx context.Context, b *bot.Bot, update *models.Update, handlerDeps *utils.HandlerDeps) error {
 	cb 		:= update.CallbackQuery
 	data 	:= cb.Data
 
-	// Example format: "command:arg1:arg2"
+	// Example format: "command:arg1:arg2"; data built with callback.Codec is
+	// "command:<signed payload>" and is decoded by the handler itself
 	parts := strings.Split(data, ":")
 	cmd := parts[0]
 	args := []string{}
@@ -91,28 +141,46 @@ func HandlerCallBackQuery(ctx context.Context, b *bot.Bot, update *models.Update
 		args = parts[1:]
 	}
 
-	if h, ok := callbackRoutes[cmd]; ok {
-		h(ctx, b, update, args, handlerDeps, "")
+	lang := handlerDeps.Lang(ctx, &cb.From)
+	answer := &bot.AnswerCallbackQueryParams{CallbackQueryID: cb.ID}
+
+	var err error
+	if r, ok := callbackRoutes[cmd]; ok {
+		var allowed bool
+		allowed, err = handlerDeps.Authorize(ctx, b, update, "callback:"+cmd, r.Access, lang)
+		switch {
+		case err != nil:
+		case !allowed:
+			answer.Text = handlerDeps.I18n.T(lang, "access.denied", nil)
+			answer.ShowAlert = true
+		default:
+			err = r.Handler(ctx, b, update, args, handlerDeps, lang)
+		}
 	}
 
-	b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
-		CallbackQueryID: cb.ID,
-	})
+	// always answer, or the client keeps the button spinning
+	if _, answerErr := b.AnswerCallbackQuery(ctx, answer); answerErr != nil {
+		err = errors.Join(err, fmt.Errorf("answer callback query: %w", answerErr))
+	}
+	return err
 }
 
 
-func defaultHandler(ctx context.Context, b *bot.Bot, u *models.Update, _ []string) {
+func defaultHandler(ctx context.Context, b *bot.Bot, u *models.Update, _ []string) error {
 	if u.Message == nil {
-		return
+		return nil
 	}
 
-	b.SendChatAction(ctx, &bot.SendChatActionParams{
+	if _, err := b.SendChatAction(ctx, &bot.SendChatActionParams{
 		ChatID: u.Message.Chat.ID,
 		Action: models.ChatActionTyping,
-	})
+	}); err != nil {
+		return err
+	}
 
-	b.SendMessage(ctx, &bot.SendMessageParams{
+	_, err := b.SendMessage(ctx, &bot.SendMessageParams{
 		ChatID: u.Message.Chat.ID,
 		Text:   "Command not found.",
 	})
+	return err
 }
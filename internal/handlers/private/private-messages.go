@@ -2,38 +2,57 @@ package private
 
 import (
 	"context"
+	"errors"
+	"fmt"
 
 	"github.com/frangi01/bbtelgo/internal/entities"
+	"github.com/frangi01/bbtelgo/internal/repo"
 	"github.com/frangi01/bbtelgo/internal/utils"
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
 )
 
-func startHandler(ctx context.Context, b *bot.Bot, u *models.Update, _ []string, deps *utils.HandlerDeps, lang string) {
-	if u.Message == nil {
-		return
+func startHandler(ctx context.Context, b *bot.Bot, u *models.Update, args []string, deps *utils.HandlerDeps, lang string) error {
+	if u.Message == nil || u.Message.From == nil {
+		return nil
 	}
 	
 	user := &entities.UserEntity{
 		User: *u.Message.From,
 	}
+	// deep link t.me/<bot>?start=<source>: kept only when the user is created
+	if len(args) > 0 {
+		user.ReferralSource = args[0]
+	}
 	_, id, err := deps.RepositoryList.UserRepository.UpsertByTelegramID(ctx, user)
-	if err != nil {
-		deps.Logger.Errorf("upsert user: %v", err)
+	switch {
+	case errors.Is(err, repo.UserErrDeleted):
+		// soft-deleted by an admin: answered, but not stored again
+		deps.Logger.Debugf("upsert user id: %v is deleted", id.Hex())
+	case err != nil:
+		return fmt.Errorf("upsert user: %w", err)
+	default:
+		deps.Logger.Debugf("upsert user id: %v", id.Hex())
 	}
-	deps.Logger.Debugf("upsert user id: %v", id.Hex())
 	
 
-	b.SendChatAction(ctx, &bot.SendChatActionParams{
+	if _, err := b.SendChatAction(ctx, &bot.SendChatActionParams{
 		ChatID: u.Message.Chat.ID,
 		Action: models.ChatActionTyping,
-	})
+	}); err != nil {
+		return err
+	}
+
+	button2Data, err := deps.Callbacks.Encode(ctx, "button_2", button2Payload{Arg: "arg_1"})
+	if err != nil {
+		return fmt.Errorf("encode button_2: %w", err)
+	}
 
 	kb := &models.InlineKeyboardMarkup{
 		InlineKeyboard: [][]models.InlineKeyboardButton{
 			{
 				{Text: deps.I18n.T(lang, "button.1", nil), CallbackData: "button_1"},
-				{Text: deps.I18n.T(lang, "button.2", nil), CallbackData: "button_2:arg_1"},
+				{Text: deps.I18n.T(lang, "button.2", nil), CallbackData: button2Data},
 			},
 			{
 				{Text: deps.I18n.T(lang, "button.3", nil), CallbackData: "button_3"},
@@ -41,20 +60,22 @@ func startHandler(ctx context.Context, b *bot.Bot, u *models.Update, _ []string,
 		},
 	}
 
-	b.SendMessage(ctx, &bot.SendMessageParams{
+	_, err = deps.Sender.SendMessage(ctx, b, &bot.SendMessageParams{
 		ChatID:      	u.Message.Chat.ID,
 		Text:       	deps.I18n.T(lang, "button.1", nil),
 		ReplyMarkup: 	kb,
 	})
+	return err
 }
 
-func photoHandler(ctx context.Context, b *bot.Bot, u *models.Update, _ []string, deps *utils.HandlerDeps, lang string) {
+func photoHandler(ctx context.Context, b *bot.Bot, u *models.Update, _ []string, deps *utils.HandlerDeps, lang string) error {
 	lang = "de"
-	b.SendMessage(ctx, &bot.SendMessageParams{
+	_, err := deps.Sender.SendMessage(ctx, b, &bot.SendMessageParams{
 		ChatID:      u.Message.Chat.ID,
 		Text:        deps.I18n.T(
 			lang, "photo.received", map[string]any{
 			"caption": u.Message.Caption,
 		}),
 	})
-}
\ No newline at end of file
+	return err
+}
@@ -0,0 +1,130 @@
+package private
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/frangi01/bbtelgo/internal/analytics"
+	"github.com/frangi01/bbtelgo/internal/rbac"
+	"github.com/frangi01/bbtelgo/internal/utils"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// /stats [days] shows the usage statistics of the last days, /stats csv [days] sends
+// them as a CSV file (analytics.WriteCSV).
+
+var statsAccess = rbac.Rule{Permissions: []rbac.Permission{rbac.PermStatsView}}
+
+// The message shows a fixed amount of data whatever the period (up to analytics.MaxDays),
+// so it stays well below the 4096 characters of a Telegram message; the CSV has it all.
+const (
+	statsDefaultDays = 30
+	statsTop         = 10 // commands and languages shown in the message
+	statsCohorts     = 6  // latest cohorts shown in the message
+	statsWeeks       = 8  // weeks of retention shown per cohort
+)
+
+func statsHandler(ctx context.Context, b *bot.Bot, u *models.Update, args []string, deps *utils.HandlerDeps, lang string) error {
+	chatID := u.Message.Chat.ID
+	reply := func(key string, data map[string]any) error {
+		_, err := deps.Sender.SendMessage(ctx, b, &bot.SendMessageParams{ChatID: chatID, Text: deps.I18n.T(lang, key, data)})
+		return err
+	}
+	if deps.RepositoryList == nil || deps.RepositoryList.Analytics == nil {
+		return reply("stats.unavailable", nil)
+	}
+
+	csv := len(args) > 0 && strings.EqualFold(args[0], "csv")
+	if csv {
+		args = args[1:]
+	}
+	days := statsDefaultDays
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 || n > analytics.MaxDays {
+			return reply("stats.usage", map[string]any{"max": analytics.MaxDays})
+		}
+		days = n
+	}
+
+	report, err := deps.RepositoryList.Analytics.Report(ctx, days)
+	if err != nil {
+		return fmt.Errorf("stats: %w", err)
+	}
+	if !csv {
+		return reply("stats.report", statsData(deps, lang, report, days))
+	}
+
+	var buf bytes.Buffer
+	if err := analytics.WriteCSV(&buf, report); err != nil {
+		return fmt.Errorf("stats csv: %w", err)
+	}
+	_, err = deps.Sender.SendDocument(ctx, b, &bot.SendDocumentParams{
+		ChatID: chatID,
+		Document: &models.InputFileUpload{
+			Filename: fmt.Sprintf("stats-%s-%dd.csv", report.GeneratedAt.Format("20060102"), days),
+			Data:     bytes.NewReader(buf.Bytes()), // seekable: rewound on retries
+		},
+		Caption: deps.I18n.T(lang, "stats.csv_caption", map[string]any{"days": days}),
+	})
+	return err
+}
+
+// statsData are the placeholders of stats.report
+func statsData(deps *utils.HandlerDeps, lang string, r *analytics.Report, days int) map[string]any {
+	none := deps.I18n.T(lang, "stats.none", nil)
+
+	var newUsers int64
+	for _, d := range r.NewUsers {
+		newUsers += d.Count
+	}
+
+	top := func(rows []analytics.KeyCount, unknown string) string {
+		var lines []string
+		for _, row := range rows[:min(len(rows), statsTop)] {
+			key := row.Key
+			if key == "" {
+				key = unknown
+			}
+			lines = append(lines, fmt.Sprintf("%s — %d", key, row.Count))
+		}
+		if len(lines) == 0 {
+			return none
+		}
+		return strings.Join(lines, "\n")
+	}
+
+	var cohorts []string
+	for _, c := range r.Cohorts {
+		if c.Size == 0 {
+			continue
+		}
+		active := c.Active[:min(len(c.Active), statsWeeks)]
+		rates := make([]string, len(active))
+		for k, n := range active {
+			rates[k] = fmt.Sprintf("%d%%", n*100/c.Size)
+		}
+		cohorts = append(cohorts, fmt.Sprintf("%s (%d): %s", c.Week.Format(time.DateOnly), c.Size, strings.Join(rates, " ")))
+	}
+	cohorts = cohorts[max(len(cohorts)-statsCohorts, 0):]
+	cohortText := none
+	if len(cohorts) > 0 {
+		cohortText = strings.Join(cohorts, "\n")
+	}
+
+	return map[string]any{
+		"days":      days,
+		"dau":       r.Active.DAU,
+		"wau":       r.Active.WAU,
+		"mau":       r.Active.MAU,
+		"new_users": newUsers,
+		"commands":  top(r.Commands, none),
+		"languages": top(r.Languages, deps.I18n.T(lang, "stats.unknown_language", nil)),
+		"cohorts":   cohortText,
+	}
+}
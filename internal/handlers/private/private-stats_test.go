@@ -0,0 +1,65 @@
+package private
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/frangi01/bbtelgo/internal/analytics"
+	"github.com/frangi01/bbtelgo/internal/i18n"
+	"github.com/frangi01/bbtelgo/internal/utils"
+)
+
+// maxReport fills every section of a report over analytics.MaxDays.
+func maxReport() *analytics.Report {
+	to := time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC)
+	r := &analytics.Report{From: to.AddDate(0, 0, -analytics.MaxDays), To: to}
+	r.Active = analytics.Active{DAU: 1_000_000, WAU: 1_000_000, MAU: 1_000_000}
+	weeks := analytics.MaxDays/7 + 1
+	for i := 0; i < weeks; i++ {
+		c := analytics.Cohort{Week: r.From.AddDate(0, 0, 7*i), Size: 1_000_000, Active: make([]int64, weeks-i)}
+		for k := range c.Active {
+			c.Active[k] = 1_000_000
+		}
+		r.Cohorts = append(r.Cohorts, c)
+	}
+	for i := 0; i < 100; i++ {
+		r.Commands = append(r.Commands, analytics.KeyCount{Key: "/" + strings.Repeat("c", 31), Count: 1_000_000})
+		r.Languages = append(r.Languages, analytics.KeyCount{Key: fmt.Sprintf("l%d", i), Count: 1_000_000})
+	}
+	return r
+}
+
+func TestStatsMessageSize(t *testing.T) {
+	bundle, err := i18n.Load("../../i18n/locales", "en")
+	if err != nil {
+		t.Fatalf("load locales: %v", err)
+	}
+	deps := &utils.HandlerDeps{I18n: bundle}
+	r := maxReport()
+
+	for _, lang := range bundle.Langs() {
+		data := statsData(deps, lang, r, analytics.MaxDays)
+		text := bundle.T(lang, "stats.report", data)
+		if n := utf8.RuneCountInString(text); n > 4096 {
+			t.Errorf("%s: /stats %d is %d characters, over the 4096 of a message", lang, analytics.MaxDays, n)
+		}
+
+		cohorts := strings.Split(data["cohorts"].(string), "\n")
+		if len(cohorts) != statsCohorts {
+			t.Fatalf("%s: %d cohorts shown, want %d", lang, len(cohorts), statsCohorts)
+		}
+		// the latest cohort comes last, each with at most statsWeeks rates
+		last := r.Cohorts[len(r.Cohorts)-1].Week.Format(time.DateOnly)
+		if !strings.HasPrefix(cohorts[len(cohorts)-1], last) {
+			t.Errorf("%s: last cohort line %q, want the week of %s", lang, cohorts[len(cohorts)-1], last)
+		}
+		for _, line := range cohorts {
+			if n := strings.Count(line, "%"); n > statsWeeks {
+				t.Errorf("%s: cohort line %q has %d weeks, want at most %d", lang, line, n, statsWeeks)
+			}
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
 )
@@ -81,6 +82,23 @@ func (b *Bundle) BestLang(requested string) string {
 	return b.defaultLaguage
 }
 
+// Langs returns the loaded languages, sorted.
+func (b *Bundle) Langs() []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	out := make([]string, 0, len(b.langs))
+	for k := range b.langs {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func (b *Bundle) DefaultLang() string {
+	return b.defaultLaguage
+}
+
 func (b *Bundle) T(lang, key string, data map[string]any) string {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
@@ -0,0 +1,69 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/frangi01/bbtelgo/internal/repo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// messageKeys repairs the messages stored while upserts filtered on "messageid":
+// the stray field is removed, duplicates of (chat.id, id) are collapsed onto the
+// most recently updated copy and the unique index is rebuilt.
+// The rewrite cannot be undone (no Down).
+var messageKeys = Migration{
+	Version: 1,
+	Name:    "messages: key on (chat.id, id)",
+	Up: func(ctx context.Context, db *mongo.Database) error {
+		col := db.Collection(repo.MessageCollection)
+
+		if _, err := col.UpdateMany(ctx, bson.M{"messageid": bson.M{"$exists": true}}, bson.M{"$unset": bson.M{"messageid": ""}}); err != nil {
+			return err
+		}
+
+		pipeline := mongo.Pipeline{
+			{{Key: "$sort", Value: bson.D{{Key: "updatedAt", Value: -1}, {Key: "_id", Value: -1}}}},
+			{{Key: "$group", Value: bson.M{
+				"_id": bson.M{"chat": "$" + repo.MessageFieldChatID, "id": "$" + repo.MessageFieldID},
+				"ids": bson.M{"$push": "$_id"},
+				"n":   bson.M{"$sum": 1},
+			}}},
+			{{Key: "$match", Value: bson.M{"n": bson.M{"$gt": 1}}}},
+		}
+		cur, err := col.Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+		if err != nil {
+			return err
+		}
+		defer cur.Close(ctx)
+
+		for cur.Next(ctx) {
+			var dup struct {
+				IDs []any `bson:"ids"`
+			}
+			if err := cur.Decode(&dup); err != nil {
+				return err
+			}
+			// keep the first (newest) copy
+			if _, err := col.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": dup.IDs[1:]}}); err != nil {
+				return err
+			}
+		}
+		if err := cur.Err(); err != nil {
+			return err
+		}
+
+		if err := dropIndex(ctx, col, "uniq_chatId_messageId"); err != nil {
+			return err
+		}
+		_, err = col.Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys: bson.D{
+				{Key: repo.MessageFieldChatID, Value: 1},
+				{Key: repo.MessageFieldID, Value: 1},
+			},
+			Options: options.Index().SetUnique(true).SetName("uniq_chatId_messageId"),
+		})
+		return err
+	},
+}
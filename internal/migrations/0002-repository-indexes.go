@@ -0,0 +1,93 @@
+package migrations
+
+import (
+	"github.com/frangi01/bbtelgo/internal/repo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// The indexes the repositories used to create in their constructors.
+// Names are unchanged, so on existing databases these migrations are no-ops.
+
+var userIndexes = Migration{
+	Version: 2,
+	Name:    "users: indexes",
+	Up: createIndexes(repo.UserCollection,
+		// unique Telegram ID (field "id" in the BSON doc)
+		mongo.IndexModel{
+			Keys:    bson.D{{Key: "id", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("uniq_telegram_id"),
+		},
+		// username is not unique: it can change
+		mongo.IndexModel{
+			Keys:    bson.D{{Key: "username", Value: 1}},
+			Options: options.Index().SetName("idx_username").SetSparse(true),
+		},
+	),
+	Down: dropIndexes(repo.UserCollection, "uniq_telegram_id", "idx_username"),
+}
+
+var messageIndexes = Migration{
+	Version: 3,
+	Name:    "messages: timeline and sender indexes",
+	Up: createIndexes(repo.MessageCollection,
+		mongo.IndexModel{
+			Keys:    bson.D{{Key: "date", Value: -1}}, // models.Message.Date (unix)
+			Options: options.Index().SetName("idx_date"),
+		},
+		mongo.IndexModel{
+			Keys:    bson.D{{Key: "from.id", Value: 1}}, // sender Telegram
+			Options: options.Index().SetName("idx_fromId"),
+		},
+	),
+	Down: dropIndexes(repo.MessageCollection, "idx_date", "idx_fromId"),
+}
+
+var conversationIndexes = Migration{
+	Version: 4,
+	Name:    "conversations: indexes",
+	Up: createIndexes(repo.ConversationCollection,
+		// one active conversation per user per chat
+		mongo.IndexModel{
+			Keys:    bson.D{{Key: "chatId", Value: 1}, {Key: "userId", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("uniq_chatId_userId"),
+		},
+		// TTL on expiresAt (+ purge delay)
+		mongo.IndexModel{
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetName("ttl_expiresAt").SetExpireAfterSeconds(int32(repo.ConversationPurgeAfter.Seconds())),
+		},
+	),
+	Down: dropIndexes(repo.ConversationCollection, "uniq_chatId_userId", "ttl_expiresAt"),
+}
+
+var campaignIndexes = Migration{
+	Version: 5,
+	Name:    "campaigns: indexes",
+	Up: chain(
+		createIndexes(repo.CampaignCollection,
+			// the worker polls running campaigns, oldest first
+			mongo.IndexModel{
+				Keys:    bson.D{{Key: "status", Value: 1}, {Key: "createdAt", Value: 1}},
+				Options: options.Index().SetName("idx_status_createdAt"),
+			},
+		),
+		createIndexes(repo.DeliveryCollection,
+			// a user gets a campaign at most once
+			mongo.IndexModel{
+				Keys:    bson.D{{Key: "campaignId", Value: 1}, {Key: "userId", Value: 1}},
+				Options: options.Index().SetUnique(true).SetName("uniq_campaignId_userId"),
+			},
+			// worker queue and counters
+			mongo.IndexModel{
+				Keys:    bson.D{{Key: "campaignId", Value: 1}, {Key: "status", Value: 1}},
+				Options: options.Index().SetName("idx_campaignId_status"),
+			},
+		),
+	),
+	Down: chain(
+		dropIndexes(repo.CampaignCollection, "idx_status_createdAt"),
+		dropIndexes(repo.DeliveryCollection, "uniq_campaignId_userId", "idx_campaignId_status"),
+	),
+}
@@ -0,0 +1,37 @@
+package migrations
+
+import (
+	"github.com/frangi01/bbtelgo/internal/repo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// keysetIndexes backs the cursor pagination of the List methods:
+// users by (createdAt, _id), messages by (date, _id) globally and per chat.
+var keysetIndexes = Migration{
+	Version: 6,
+	Name:    "users, messages: keyset pagination indexes",
+	Up: chain(
+		createIndexes(repo.UserCollection,
+			mongo.IndexModel{
+				Keys:    bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}},
+				Options: options.Index().SetName("idx_createdAt_id"),
+			},
+		),
+		createIndexes(repo.MessageCollection,
+			mongo.IndexModel{
+				Keys:    bson.D{{Key: "date", Value: -1}, {Key: "_id", Value: -1}},
+				Options: options.Index().SetName("idx_date_id"),
+			},
+			mongo.IndexModel{
+				Keys:    bson.D{{Key: repo.MessageFieldChatID, Value: 1}, {Key: "date", Value: -1}, {Key: "_id", Value: -1}},
+				Options: options.Index().SetName("idx_chatId_date_id"),
+			},
+		),
+	),
+	Down: chain(
+		dropIndexes(repo.UserCollection, "idx_createdAt_id"),
+		dropIndexes(repo.MessageCollection, "idx_date_id", "idx_chatId_date_id"),
+	),
+}
@@ -0,0 +1,39 @@
+package migrations
+
+import (
+	"github.com/frangi01/bbtelgo/internal/repo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// searchIndexes backs MessageRepository.Search and the case-insensitive FindByUsername.
+// The text index has no language: the bot is multilingual, so words are not stemmed.
+var searchIndexes = Migration{
+	Version: 7,
+	Name:    "messages: text index; users: case-insensitive username",
+	Up: chain(
+		createIndexes(repo.MessageCollection,
+			mongo.IndexModel{
+				Keys: bson.D{{Key: "text", Value: "text"}, {Key: "caption", Value: "text"}},
+				Options: options.Index().
+					SetName("txt_text_caption").
+					SetDefaultLanguage("none").
+					SetWeights(bson.D{{Key: "text", Value: 2}, {Key: "caption", Value: 1}}),
+			},
+		),
+		createIndexes(repo.UserCollection,
+			mongo.IndexModel{
+				Keys: bson.D{{Key: "username", Value: 1}},
+				Options: options.Index().
+					SetName("idx_username_ci").
+					SetSparse(true).
+					SetCollation(&options.Collation{Locale: "en", Strength: 2}),
+			},
+		),
+	),
+	Down: chain(
+		dropIndexes(repo.MessageCollection, "txt_text_caption"),
+		dropIndexes(repo.UserCollection, "idx_username_ci"),
+	),
+}
@@ -0,0 +1,28 @@
+package migrations
+
+import (
+	"github.com/frangi01/bbtelgo/internal/repo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var auditIndexes = Migration{
+	Version: 8,
+	Name:    "audit_log: indexes",
+	Up: createIndexes(repo.AuditCollection,
+		mongo.IndexModel{
+			Keys:    bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}},
+			Options: options.Index().SetName("idx_createdAt_id"),
+		},
+		mongo.IndexModel{
+			Keys:    bson.D{{Key: "actorId", Value: 1}, {Key: "createdAt", Value: -1}},
+			Options: options.Index().SetName("idx_actorId_createdAt"),
+		},
+		mongo.IndexModel{
+			Keys:    bson.D{{Key: "targetId", Value: 1}, {Key: "createdAt", Value: -1}},
+			Options: options.Index().SetName("idx_targetId_createdAt").SetSparse(true),
+		},
+	),
+	Down: dropIndexes(repo.AuditCollection, "idx_createdAt_id", "idx_actorId_createdAt", "idx_targetId_createdAt"),
+}
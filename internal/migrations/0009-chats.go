@@ -0,0 +1,24 @@
+package migrations
+
+import (
+	"github.com/frangi01/bbtelgo/internal/repo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var chatIndexes = Migration{
+	Version: 9,
+	Name:    "chats: indexes",
+	Up: createIndexes(repo.ChatCollection,
+		mongo.IndexModel{
+			Keys:    bson.D{{Key: "chatId", Value: 1}},
+			Options: options.Index().SetName("uniq_chatId").SetUnique(true),
+		},
+		mongo.IndexModel{
+			Keys:    bson.D{{Key: "status", Value: 1}, {Key: "createdAt", Value: 1}},
+			Options: options.Index().SetName("idx_status_createdAt"),
+		},
+	),
+	Down: dropIndexes(repo.ChatCollection, "uniq_chatId", "idx_status_createdAt"),
+}
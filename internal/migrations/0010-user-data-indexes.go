@@ -0,0 +1,28 @@
+package migrations
+
+import (
+	"github.com/frangi01/bbtelgo/internal/repo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// userDataIndexes back the per-user deletes of the GDPR erasure.
+var userDataIndexes = Migration{
+	Version: 10,
+	Name:    "conversations, campaign_deliveries: userId indexes",
+	Up: chain(
+		createIndexes(repo.ConversationCollection, mongo.IndexModel{
+			Keys:    bson.D{{Key: "userId", Value: 1}},
+			Options: options.Index().SetName("idx_userId"),
+		}),
+		createIndexes(repo.DeliveryCollection, mongo.IndexModel{
+			Keys:    bson.D{{Key: "userId", Value: 1}},
+			Options: options.Index().SetName("idx_userId"),
+		}),
+	),
+	Down: chain(
+		dropIndexes(repo.ConversationCollection, "idx_userId"),
+		dropIndexes(repo.DeliveryCollection, "idx_userId"),
+	),
+}
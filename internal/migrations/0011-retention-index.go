@@ -0,0 +1,19 @@
+package migrations
+
+import (
+	"github.com/frangi01/bbtelgo/internal/repo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// retentionIndex backs the retention sweeper (chat type + date range).
+var retentionIndex = Migration{
+	Version: 11,
+	Name:    "messages: chat type + date index",
+	Up: createIndexes(repo.MessageCollection, mongo.IndexModel{
+		Keys:    bson.D{{Key: "chat.type", Value: 1}, {Key: "date", Value: 1}},
+		Options: options.Index().SetName("idx_chatType_date"),
+	}),
+	Down: dropIndexes(repo.MessageCollection, "idx_chatType_date"),
+}
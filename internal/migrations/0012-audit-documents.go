@@ -0,0 +1,19 @@
+package migrations
+
+import (
+	"github.com/frangi01/bbtelgo/internal/repo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// auditDocumentIndex backs the history of one document (AuditListOptions.DocumentID).
+var auditDocumentIndex = Migration{
+	Version: 12,
+	Name:    "audit_log: documentId index",
+	Up: createIndexes(repo.AuditCollection, mongo.IndexModel{
+		Keys:    bson.D{{Key: "documentId", Value: 1}, {Key: "createdAt", Value: -1}},
+		Options: options.Index().SetName("idx_documentId_createdAt").SetSparse(true),
+	}),
+	Down: dropIndexes(repo.AuditCollection, "idx_documentId_createdAt"),
+}
@@ -0,0 +1,19 @@
+package migrations
+
+// All lists the migrations of the bot; append new ones with the next version.
+func All() []Migration {
+	return []Migration{
+		messageKeys,
+		userIndexes,
+		messageIndexes,
+		conversationIndexes,
+		campaignIndexes,
+		keysetIndexes,
+		searchIndexes,
+		auditIndexes,
+		chatIndexes,
+		userDataIndexes,
+		retentionIndex,
+		auditDocumentIndex,
+	}
+}
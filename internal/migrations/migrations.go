@@ -0,0 +1,243 @@
+package migrations
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/frangi01/bbtelgo/internal/db"
+	"github.com/frangi01/bbtelgo/internal/entities"
+	"github.com/frangi01/bbtelgo/internal/logx"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	Collection = "schema_migrations"
+
+	lockKey     = "migrations:lock"
+	lockTTL     = 10 * time.Minute
+	lockPolling = time.Second
+)
+
+var ErrIrreversible = errors.New("migration cannot be reverted")
+
+// Step changes the schema (indexes, document rewrites) in one direction.
+type Step func(ctx context.Context, db *mongo.Database) error
+
+// Migration is a versioned change of the Mongo schema.
+// Up and Down must be idempotent: an interrupted migration is simply run again.
+// Down may be nil for changes that cannot be undone.
+type Migration struct {
+	Version int
+	Name    string
+	Up      Step
+	Down    Step
+}
+
+// Status of a declared migration.
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Runner applies the migrations in version order and records them in schema_migrations.
+type Runner struct {
+	db         *mongo.Database
+	col        *mongo.Collection
+	cache      *db.CacheClient
+	logger     *logx.Logger
+	migrations []Migration
+}
+
+// NewRunner: with cache set only one replica migrates at a time (the others wait for it).
+// It panics on duplicated or invalid versions, as migrations are declared in code.
+func NewRunner(database *mongo.Database, cache *db.CacheClient, logger *logx.Logger, migrations ...Migration) *Runner {
+	sorted := append([]Migration(nil), migrations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	for i, m := range sorted {
+		if m.Version <= 0 || m.Up == nil {
+			panic(fmt.Sprintf("migrations: invalid migration %d %q", m.Version, m.Name))
+		}
+		if i > 0 && sorted[i-1].Version == m.Version {
+			panic(fmt.Sprintf("migrations: duplicated version %d", m.Version))
+		}
+	}
+	return &Runner{db: database, col: database.Collection(Collection), cache: cache, logger: logger, migrations: sorted}
+}
+
+// Applied returns the recorded migrations by version.
+func (r *Runner) Applied(ctx context.Context) (map[int]entities.SchemaMigrationEntity, error) {
+	cur, err := r.col.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var rows []entities.SchemaMigrationEntity
+	if err := cur.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	out := make(map[int]entities.SchemaMigrationEntity, len(rows))
+	for _, row := range rows {
+		out[row.Version] = row
+	}
+	return out, nil
+}
+
+// Status lists the declared migrations in version order.
+func (r *Runner) Status(ctx context.Context) ([]Status, error) {
+	done, err := r.Applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Status, 0, len(r.migrations))
+	for _, m := range r.migrations {
+		row, ok := done[m.Version]
+		out = append(out, Status{Migration: m, Applied: ok, AppliedAt: row.AppliedAt})
+	}
+	return out, nil
+}
+
+// Up applies every pending migration, stopping at the first failure.
+func (r *Runner) Up(ctx context.Context) (applied int, err error) {
+	unlock, err := r.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	done, err := r.Applied(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for _, m := range r.migrations {
+		if _, ok := done[m.Version]; ok {
+			continue
+		}
+		r.logger.Infof("migration %d %s: up", m.Version, m.Name)
+		if err := m.Up(ctx, r.db); err != nil {
+			return applied, fmt.Errorf("migration %d %s: %w", m.Version, m.Name, err)
+		}
+		row := entities.SchemaMigrationEntity{Version: m.Version, Name: m.Name, AppliedAt: time.Now().UTC()}
+		if _, err := r.col.InsertOne(ctx, row); err != nil && !mongo.IsDuplicateKeyError(err) {
+			return applied, fmt.Errorf("migration %d %s: record: %w", m.Version, m.Name, err)
+		}
+		applied++
+	}
+	return applied, nil
+}
+
+// Down reverts the last steps applied migrations, newest first.
+func (r *Runner) Down(ctx context.Context, steps int) (reverted int, err error) {
+	unlock, err := r.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	done, err := r.Applied(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for i := len(r.migrations) - 1; i >= 0 && reverted < steps; i-- {
+		m := r.migrations[i]
+		if _, ok := done[m.Version]; !ok {
+			continue
+		}
+		if m.Down == nil {
+			return reverted, fmt.Errorf("migration %d %s: %w", m.Version, m.Name, ErrIrreversible)
+		}
+		r.logger.Infof("migration %d %s: down", m.Version, m.Name)
+		if err := m.Down(ctx, r.db); err != nil {
+			return reverted, fmt.Errorf("migration %d %s: %w", m.Version, m.Name, err)
+		}
+		if _, err := r.col.DeleteOne(ctx, bson.M{"_id": m.Version}); err != nil {
+			return reverted, fmt.Errorf("migration %d %s: unrecord: %w", m.Version, m.Name, err)
+		}
+		reverted++
+	}
+	return reverted, nil
+}
+
+// lock waits for the cluster-wide migration lock (no-op without Redis).
+func (r *Runner) lock(ctx context.Context) (unlock func(), err error) {
+	if r.cache == nil {
+		return func() {}, nil
+	}
+	buf := make([]byte, 8)
+	_, _ = rand.Read(buf)
+	token := hex.EncodeToString(buf)
+
+	for waited := false; ; waited = true {
+		ok, err := r.cache.AcquireLock(ctx, lockKey, token, lockTTL)
+		if err != nil {
+			return nil, fmt.Errorf("migrations: lock: %w", err)
+		}
+		if ok {
+			break
+		}
+		if !waited {
+			r.logger.Infof("migrations: another instance is migrating, waiting")
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockPolling):
+		}
+	}
+
+	return func() {
+		if _, err := r.cache.ReleaseLock(context.Background(), lockKey, token); err != nil {
+			r.logger.Warnf("migrations: unlock: %v", err)
+		}
+	}, nil
+}
+
+// createIndexes is the Up step of index-only migrations: creating an existing index is a no-op.
+func createIndexes(collection string, indexes ...mongo.IndexModel) Step {
+	return func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection(collection).Indexes().CreateMany(ctx, indexes)
+		return err
+	}
+}
+
+// dropIndexes is the matching Down step.
+func dropIndexes(collection string, names ...string) Step {
+	return func(ctx context.Context, db *mongo.Database) error {
+		for _, name := range names {
+			if err := dropIndex(ctx, db.Collection(collection), name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// chain runs the steps in order.
+func chain(steps ...Step) Step {
+	return func(ctx context.Context, db *mongo.Database) error {
+		for _, step := range steps {
+			if err := step(ctx, db); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// dropIndex ignores missing collections and indexes, so migrations stay idempotent.
+func dropIndex(ctx context.Context, col *mongo.Collection, name string) error {
+	_, err := col.Indexes().DropOne(ctx, name)
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && (cmdErr.Code == 26 || cmdErr.Code == 27) { // NamespaceNotFound, IndexNotFound
+		return nil
+	}
+	return err
+}
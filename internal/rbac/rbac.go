@@ -0,0 +1,230 @@
+package rbac
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/frangi01/bbtelgo/internal/db"
+	"github.com/frangi01/bbtelgo/internal/entities"
+	"github.com/frangi01/bbtelgo/internal/logx"
+	"github.com/frangi01/bbtelgo/internal/repo"
+)
+
+// Permission is a fine grained capability granted to roles by a Policy.
+type Permission string
+
+const (
+	PermUsersView    Permission = "users.view"
+	PermUsersManage  Permission = "users.manage" // ban/unban, rate-limit reset
+	PermRolesManage  Permission = "roles.manage"
+	PermMessagesView Permission = "messages.view"
+	PermBroadcast    Permission = "broadcast.send"
+	PermStatsView    Permission = "stats.view"
+)
+
+// Policy maps roles to their permissions. RoleAdmin holds every permission anyway.
+type Policy map[entities.Role][]Permission
+
+var DefaultPolicy = Policy{
+	entities.RoleModerator: {PermUsersView, PermUsersManage, PermMessagesView, PermStatsView},
+}
+
+// Rule is the access requirement of a route: any of Roles and all of Permissions.
+// The zero Rule lets everyone in.
+type Rule struct {
+	Roles       []entities.Role
+	Permissions []Permission
+}
+
+func (r Rule) Public() bool {
+	return len(r.Roles) == 0 && len(r.Permissions) == 0
+}
+
+// Admins is the rule of the admin-only routes.
+var Admins = Rule{Roles: []entities.Role{entities.RoleAdmin}}
+
+const (
+	DefaultCacheTTL = 5 * time.Minute
+
+	cacheKeyPrefix = "rbac:user:"
+)
+
+// Access resolves the roles of the users and checks them against the route rules.
+type Access struct {
+	users    repo.UserStore
+	cache    *db.CacheClient
+	audit    *repo.AuditRepository
+	logger   *logx.Logger
+	adminIDs []int64
+	policy   Policy
+	ttl      time.Duration
+}
+
+// New: cache and audit are optional; adminIDs are always admins (bootstrap, see APP_ADMIN_IDS);
+// nil policy = DefaultPolicy.
+func New(users repo.UserStore, cache *db.CacheClient, audit *repo.AuditRepository, logger *logx.Logger, adminIDs []int64, policy Policy) *Access {
+	if policy == nil {
+		policy = DefaultPolicy
+	}
+	return &Access{
+		users:    users,
+		cache:    cache,
+		audit:    audit,
+		logger:   logger,
+		adminIDs: adminIDs,
+		policy:   policy,
+		ttl:      DefaultCacheTTL,
+	}
+}
+
+func cacheKey(userID int64) string {
+	return fmt.Sprintf("%s%d", cacheKeyPrefix, userID)
+}
+
+// subject is what is cached per user: the stored roles, the ban flag and the
+// preferred language.
+type subject struct {
+	Roles    []entities.Role `json:"r"`
+	Banned   bool            `json:"b,omitempty"`
+	Language string          `json:"l,omitempty"`
+}
+
+func (a *Access) subject(ctx context.Context, userID int64) (subject, error) {
+	var sub subject
+	if a.cache != nil {
+		cached, err := a.cache.GetJSON(ctx, cacheKey(userID), &sub)
+		if err != nil {
+			a.logger.Errorf("rbac: cache get %d: %v", userID, err)
+		}
+		if cached && err == nil {
+			return sub, nil
+		}
+	}
+	if a.users == nil {
+		return sub, nil
+	}
+
+	user, err := a.users.FindByTelegramID(ctx, userID)
+	switch {
+	case errors.Is(err, repo.UserErrNotFound):
+	case err != nil:
+		return sub, fmt.Errorf("rbac: user %d: %w", userID, err)
+	default:
+		sub = subject{Roles: user.Roles, Banned: user.Banned, Language: user.Language}
+	}
+	if a.cache != nil {
+		if err := a.cache.SetJSON(ctx, cacheKey(userID), sub, a.ttl); err != nil {
+			a.logger.Errorf("rbac: cache set %d: %v", userID, err)
+		}
+	}
+	return sub, nil
+}
+
+// Roles returns the roles of userID (RoleUser included), cached in Redis.
+// Unknown users are plain users.
+func (a *Access) Roles(ctx context.Context, userID int64) ([]entities.Role, error) {
+	roles := []entities.Role{entities.RoleUser}
+	if slices.Contains(a.adminIDs, userID) {
+		roles = append(roles, entities.RoleAdmin)
+	}
+	sub, err := a.subject(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range sub.Roles {
+		if !slices.Contains(roles, r) {
+			roles = append(roles, r)
+		}
+	}
+	return roles, nil
+}
+
+// Banned reports whether userID is banned (cached like the roles); bootstrap admins never are.
+func (a *Access) Banned(ctx context.Context, userID int64) (bool, error) {
+	if slices.Contains(a.adminIDs, userID) {
+		return false, nil
+	}
+	sub, err := a.subject(ctx, userID)
+	return sub.Banned, err
+}
+
+// Language returns the preferred language stored for userID (UserEntity.Language, cached
+// like the roles), "" when the user has none.
+func (a *Access) Language(ctx context.Context, userID int64) (string, error) {
+	sub, err := a.subject(ctx, userID)
+	return sub.Language, err
+}
+
+// Invalidate drops the cached roles, ban and language of userID; call it after changing them.
+func (a *Access) Invalidate(ctx context.Context, userID int64) {
+	if a.cache == nil {
+		return
+	}
+	if _, err := a.cache.Delete(ctx, cacheKey(userID)); err != nil {
+		a.logger.Errorf("rbac: cache delete %d: %v", userID, err)
+	}
+}
+
+// Can reports whether roles grant p.
+func (a *Access) Can(roles []entities.Role, p Permission) bool {
+	for _, r := range roles {
+		if r == entities.RoleAdmin || slices.Contains(a.policy[r], p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Allowed checks userID against rule.
+func (a *Access) Allowed(ctx context.Context, userID int64, rule Rule) (bool, error) {
+	if rule.Public() {
+		return true, nil
+	}
+	if userID == 0 {
+		return false, nil
+	}
+	roles, err := a.Roles(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	if len(rule.Roles) > 0 && !slices.ContainsFunc(rule.Roles, func(r entities.Role) bool { return slices.Contains(roles, r) }) {
+		return false, nil
+	}
+	for _, p := range rule.Permissions {
+		if !a.Can(roles, p) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Authorize is Allowed plus an audit entry on denial. action names the route
+// (e.g. "command:/admin", "callback:admin").
+// Errors resolving the roles deny the access.
+func (a *Access) Authorize(ctx context.Context, userID, chatID int64, action string, rule Rule) (bool, error) {
+	ok, err := a.Allowed(ctx, userID, rule)
+	if ok || err != nil {
+		return ok, err
+	}
+	a.logger.Infof("rbac: %s denied to %d in chat %d", action, userID, chatID)
+	a.Record(ctx, &entities.AuditEntity{
+		Action:  action,
+		ActorID: userID,
+		ChatID:  chatID,
+		Outcome: entities.AuditDenied,
+	})
+	return false, nil
+}
+
+// Record appends an audit entry; failures are logged only.
+func (a *Access) Record(ctx context.Context, entry *entities.AuditEntity) {
+	if a.audit == nil {
+		return
+	}
+	if err := a.audit.Append(ctx, entry); err != nil {
+		a.logger.Errorf("rbac: audit %s: %v", entry.Action, err)
+	}
+}
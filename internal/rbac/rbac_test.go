@@ -0,0 +1,127 @@
+package rbac
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/frangi01/bbtelgo/internal/entities"
+	"github.com/frangi01/bbtelgo/internal/logx"
+	"github.com/frangi01/bbtelgo/internal/repo"
+	"github.com/go-telegram/bot/models"
+)
+
+const (
+	adminID     = 1 // from APP_ADMIN_IDS
+	moderatorID = 2
+	plainID     = 3
+	unknownID   = 404
+)
+
+func newTestAccess(t *testing.T) *Access {
+	t.Helper()
+	logger, err := logx.New(filepath.Join(t.TempDir(), "test.log"), logx.Options{})
+	if err != nil {
+		t.Fatalf("logger: %v", err)
+	}
+	t.Cleanup(func() { _ = logger.Close() })
+
+	users := repo.NewMemoryUserRepository()
+	ctx := context.Background()
+	for _, u := range []*entities.UserEntity{
+		{User: models.User{ID: moderatorID}, Roles: []entities.Role{entities.RoleModerator}},
+		{User: models.User{ID: plainID}, Banned: true, Language: "it"},
+	} {
+		if _, err := users.Create(ctx, u); err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+	}
+	return New(users, nil, nil, logger, []int64{adminID}, nil)
+}
+
+func TestRoles(t *testing.T) {
+	a := newTestAccess(t)
+	tests := []struct {
+		userID int64
+		want   []entities.Role
+	}{
+		{adminID, []entities.Role{entities.RoleUser, entities.RoleAdmin}},
+		{moderatorID, []entities.Role{entities.RoleUser, entities.RoleModerator}},
+		{plainID, []entities.Role{entities.RoleUser}},
+		{unknownID, []entities.Role{entities.RoleUser}},
+	}
+	for _, tt := range tests {
+		got, err := a.Roles(context.Background(), tt.userID)
+		if err != nil || !slices.Equal(got, tt.want) {
+			t.Errorf("Roles(%d) = %v, %v, want %v", tt.userID, got, err, tt.want)
+		}
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	a := newTestAccess(t)
+	viewUsers := Rule{Permissions: []Permission{PermUsersView}}
+	broadcast := Rule{Permissions: []Permission{PermBroadcast}}
+	moderators := Rule{Roles: []entities.Role{entities.RoleModerator, entities.RoleAdmin}}
+
+	tests := []struct {
+		name   string
+		userID int64
+		rule   Rule
+		want   bool
+	}{
+		{"public rule", unknownID, Rule{}, true},
+		{"public rule without sender", 0, Rule{}, true},
+		{"no sender", 0, viewUsers, false},
+		{"admin role", adminID, Admins, true},
+		{"moderator is not admin", moderatorID, Admins, false},
+		{"any of the roles", moderatorID, moderators, true},
+		{"permission of the policy", moderatorID, viewUsers, true},
+		{"permission outside the policy", moderatorID, broadcast, false},
+		{"admin holds every permission", adminID, broadcast, true},
+		{"plain user", plainID, viewUsers, false},
+		{"unknown user", unknownID, moderators, false},
+	}
+	for _, tt := range tests {
+		got, err := a.Allowed(context.Background(), tt.userID, tt.rule)
+		if err != nil || got != tt.want {
+			t.Errorf("%s: Allowed = %v, %v, want %v", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	a := newTestAccess(t)
+	ctx := context.Background()
+	if ok, err := a.Authorize(ctx, plainID, plainID, "command:/admin", Admins); err != nil || ok {
+		t.Fatalf("plain user = %v, %v, want denied", ok, err)
+	}
+	if ok, err := a.Authorize(ctx, adminID, adminID, "command:/admin", Admins); err != nil || !ok {
+		t.Fatalf("admin = %v, %v, want allowed", ok, err)
+	}
+}
+
+func TestSubject(t *testing.T) {
+	a := newTestAccess(t)
+	ctx := context.Background()
+	tests := []struct {
+		userID     int64
+		wantBanned bool
+		wantLang   string
+	}{
+		{plainID, true, "it"},
+		{moderatorID, false, ""},
+		{unknownID, false, ""},
+	}
+	for _, tt := range tests {
+		banned, err := a.Banned(ctx, tt.userID)
+		if err != nil || banned != tt.wantBanned {
+			t.Errorf("Banned(%d) = %v, %v, want %v", tt.userID, banned, err, tt.wantBanned)
+		}
+		lang, err := a.Language(ctx, tt.userID)
+		if err != nil || lang != tt.wantLang {
+			t.Errorf("Language(%d) = %q, %v, want %q", tt.userID, lang, err, tt.wantLang)
+		}
+	}
+}
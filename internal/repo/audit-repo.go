@@ -0,0 +1,163 @@
+package repo
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/frangi01/bbtelgo/internal/entities"
+	"github.com/frangi01/bbtelgo/internal/logx"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const AuditCollection = "audit_log"
+
+// AuditRepository is append-only: records are never updated nor deleted.
+type AuditRepository struct {
+	col    *mongo.Collection
+	logger *logx.Logger // reports the records of the repositories that could not be written
+}
+
+// NewAuditRepository: indexes are created by the migrations (internal/migrations);
+// logger is optional.
+func NewAuditRepository(client *mongo.Client, dbName string, logger *logx.Logger) *AuditRepository {
+	return &AuditRepository{col: client.Database(dbName).Collection(AuditCollection), logger: logger}
+}
+
+// Append inserts a record, stamping _id and createdAt
+func (r *AuditRepository) Append(ctx context.Context, a *entities.AuditEntity) error {
+	a.MongoID = primitive.NewObjectID()
+	a.CreatedAt = time.Now().UTC()
+	_, err := r.col.InsertOne(ctx, a)
+	return err
+}
+
+type AuditListOptions struct {
+	PerPage    int64
+	Cursor     string // Page.Next of the previous call
+	ActorID    *int64
+	TargetID   *int64
+	Action     *string
+	DocumentID *primitive.ObjectID // history of one document
+}
+
+// List: newest first, keyset paginated
+func (r *AuditRepository) List(ctx context.Context, opt AuditListOptions) (Page[entities.AuditEntity], error) {
+	page := Page[entities.AuditEntity]{Total: -1}
+	if opt.PerPage <= 0 || opt.PerPage > 1000 {
+		opt.PerPage = 50
+	}
+	filter := bson.M{}
+	if opt.ActorID != nil {
+		filter["actorId"] = *opt.ActorID
+	}
+	if opt.TargetID != nil {
+		filter["targetId"] = *opt.TargetID
+	}
+	if opt.Action != nil {
+		filter["action"] = *opt.Action
+	}
+	if opt.DocumentID != nil {
+		filter["documentId"] = *opt.DocumentID
+	}
+	if opt.Cursor != "" {
+		createdAt, id, err := decodeCursor[time.Time](opt.Cursor)
+		if err != nil {
+			return page, err
+		}
+		filter = and(filter, afterCursor("createdAt", createdAt, id))
+	}
+
+	findOpt := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(opt.PerPage + 1)
+	cur, err := r.col.Find(ctx, filter, findOpt)
+	if err != nil {
+		return page, err
+	}
+	defer cur.Close(ctx)
+
+	if err := cur.All(ctx, &page.Items); err != nil {
+		return page, err
+	}
+	if int64(len(page.Items)) > opt.PerPage {
+		page.Items = page.Items[:opt.PerPage]
+		last := page.Items[len(page.Items)-1]
+		if page.Next, err = encodeCursor(last.CreatedAt, last.MongoID); err != nil {
+			return page, err
+		}
+	}
+	return page, nil
+}
+
+type actorKey struct{}
+
+// WithActor attributes the changes made by the repositories with ctx to actorID
+// (Telegram ID); the handlers set it to the sender of the update.
+func WithActor(ctx context.Context, actorID int64) context.Context {
+	return context.WithValue(ctx, actorKey{}, actorID)
+}
+
+// Actor returns the actor of ctx (0 = the bot itself).
+func Actor(ctx context.Context) int64 {
+	id, _ := ctx.Value(actorKey{}).(int64)
+	return id
+}
+
+// change is a write of a repository, recorded as "<collection>.<op>".
+type change struct {
+	collection string
+	op         string // update, delete, restore, purge
+	documentID primitive.ObjectID
+	targetID   int64
+	chatID     int64
+	fields     []string
+}
+
+// record appends c, attributed to the actor of ctx; a nil repository records nothing.
+// The change is already applied, so a failure is only logged.
+func (r *AuditRepository) record(ctx context.Context, c change) {
+	if r == nil {
+		return
+	}
+	err := r.Append(ctx, &entities.AuditEntity{
+		Action:     c.collection + "." + c.op,
+		ActorID:    Actor(ctx),
+		TargetID:   c.targetID,
+		ChatID:     c.chatID,
+		Outcome:    entities.AuditAllowed,
+		Collection: c.collection,
+		DocumentID: c.documentID,
+		Fields:     c.fields,
+	})
+	if err != nil && r.logger != nil {
+		r.logger.Errorf("audit %s.%s %s (target %d): %v", c.collection, c.op, c.documentID.Hex(), c.targetID, err)
+	}
+}
+
+// changedFields lists the keys written by an update document ($set, $unset, $addToSet...),
+// without updatedAt; settings.<key> paths are kept whole.
+func changedFields(update bson.M) []string {
+	seen := map[string]bool{}
+	for op, doc := range update {
+		fields, ok := doc.(bson.M)
+		if !ok || !strings.HasPrefix(op, "$") || op == "$setOnInsert" {
+			continue
+		}
+		for k := range fields {
+			if k != "updatedAt" {
+				seen[k] = true
+			}
+		}
+	}
+	out := make([]string, 0, len(seen))
+	for k := range seen {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,137 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/frangi01/bbtelgo/internal/entities"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	CampaignErrNotFound   = errors.New("campaign not found")
+	CampaignErrTransition = errors.New("campaign status transition not allowed")
+)
+
+const CampaignCollection = "campaigns"
+
+type CampaignRepository struct {
+	col *mongo.Collection
+}
+
+// NewCampaignRepository: indexes are created by the migrations (internal/migrations)
+func NewCampaignRepository(client *mongo.Client, dbName string) *CampaignRepository {
+	return &CampaignRepository{col: client.Database(dbName).Collection(CampaignCollection)}
+}
+
+// Create: new campaigns always start as draft
+func (r *CampaignRepository) Create(ctx context.Context, c *entities.CampaignEntity) (primitive.ObjectID, error) {
+	if c.MongoID.IsZero() {
+		c.MongoID = primitive.NewObjectID()
+	}
+	now := time.Now().UTC()
+	if c.CreatedAt.IsZero() {
+		c.CreatedAt = now
+	}
+	c.UpdatedAt = now
+	c.Status = entities.CampaignDraft
+	c.Stats = entities.CampaignStats{}
+
+	res, err := r.col.InsertOne(ctx, c)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	oid, _ := res.InsertedID.(primitive.ObjectID)
+	return oid, nil
+}
+
+// FindByObjectID
+func (r *CampaignRepository) FindByObjectID(ctx context.Context, id primitive.ObjectID) (*entities.CampaignEntity, error) {
+	var c entities.CampaignEntity
+	err := r.col.FindOne(ctx, bson.M{"_id": id}).Decode(&c)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, CampaignErrNotFound
+	}
+	return &c, err
+}
+
+// ListByStatus (oldest first)
+func (r *CampaignRepository) ListByStatus(ctx context.Context, status entities.CampaignStatus) ([]entities.CampaignEntity, error) {
+	cur, err := r.col.Find(ctx, bson.M{"status": status}, options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var out []entities.CampaignEntity
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Transition moves the campaign to status "to" only if it is currently in one of "from";
+// set is applied in the same update (e.g. startedAt).
+func (r *CampaignRepository) Transition(ctx context.Context, id primitive.ObjectID, from []entities.CampaignStatus, to entities.CampaignStatus, set bson.M) error {
+	if set == nil {
+		set = bson.M{}
+	}
+	set["status"] = to
+	set["updatedAt"] = time.Now().UTC()
+
+	res, err := r.col.UpdateOne(ctx, bson.M{"_id": id, "status": bson.M{"$in": from}}, bson.M{"$set": set})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		if _, err := r.FindByObjectID(ctx, id); err != nil {
+			return err
+		}
+		return CampaignErrTransition
+	}
+	return nil
+}
+
+// IncStats adds the deltas to the delivery counters
+func (r *CampaignRepository) IncStats(ctx context.Context, id primitive.ObjectID, delta entities.CampaignStats) error {
+	inc := bson.M{}
+	if delta.Total != 0 {
+		inc["stats.total"] = delta.Total
+	}
+	if delta.Sent != 0 {
+		inc["stats.sent"] = delta.Sent
+	}
+	if delta.Blocked != 0 {
+		inc["stats.blocked"] = delta.Blocked
+	}
+	if delta.Failed != 0 {
+		inc["stats.failed"] = delta.Failed
+	}
+	if len(inc) == 0 {
+		return nil
+	}
+	res, err := r.col.UpdateByID(ctx, id, bson.M{"$inc": inc, "$set": bson.M{"updatedAt": time.Now().UTC()}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return CampaignErrNotFound
+	}
+	return nil
+}
+
+// Delete (by _id)
+func (r *CampaignRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	res, err := r.col.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return CampaignErrNotFound
+	}
+	return nil
+}
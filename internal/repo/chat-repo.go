@@ -0,0 +1,167 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/frangi01/bbtelgo/internal/entities"
+	"github.com/go-telegram/bot/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ChatErrNotFound = errors.New("chat not found")
+
+const ChatCollection = "chats"
+
+type ChatRepository struct {
+	col *mongo.Collection
+}
+
+// NewChatRepository: indexes are created by the migrations (internal/migrations)
+func NewChatRepository(client *mongo.Client, dbName string) *ChatRepository {
+	return &ChatRepository{col: client.Database(dbName).Collection(ChatCollection)}
+}
+
+// chatInfo is the $set of the Telegram fields of a chat (title and username only when known)
+func chatInfo(chat models.Chat, now time.Time) bson.M {
+	set := bson.M{"type": chat.Type, "updatedAt": now}
+	if chat.Title != "" {
+		set["title"] = chat.Title
+	}
+	if chat.Username != "" {
+		set["username"] = chat.Username
+	}
+	return set
+}
+
+// SetStatus records a membership change of the bot (my_chat_member): by is who made it.
+// The chat is created if unknown.
+func (r *ChatRepository) SetStatus(ctx context.Context, chat models.Chat, status entities.ChatStatus, by int64, at time.Time) error {
+	now := time.Now().UTC()
+	at = at.UTC()
+
+	set := chatInfo(chat, now)
+	set["status"] = status
+	set["statusBy"] = by
+	set["statusAt"] = at
+	switch status {
+	case entities.ChatLeft, entities.ChatKicked:
+		set["leftAt"] = at
+	}
+
+	update := bson.M{
+		"$set": set,
+		"$setOnInsert": bson.M{
+			"_id":       primitive.NewObjectID(),
+			"createdAt": now,
+		},
+	}
+	filter := bson.M{"chatId": chat.ID}
+	if status.Active() {
+		// promotions keep the join date
+		filter["status"] = bson.M{"$in": []entities.ChatStatus{entities.ChatMember, entities.ChatAdmin}}
+		res, err := r.col.UpdateOne(ctx, filter, update)
+		if err != nil {
+			return err
+		}
+		if res.MatchedCount > 0 {
+			// a member stored without a join date (null or missing) gets this one
+			_, err = r.col.UpdateOne(ctx, bson.M{"chatId": chat.ID, "joinedAt": nil}, bson.M{"$set": bson.M{"joinedAt": at}})
+			return err
+		}
+		filter = bson.M{"chatId": chat.ID}
+		set["joinedAt"] = at
+	}
+	_, err := r.col.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	return err
+}
+
+// UpdateInfo refreshes title, type and username (e.g. on new_chat_title); unknown chats
+// are created as ChatMember, joined now, since the bot is receiving their updates.
+func (r *ChatRepository) UpdateInfo(ctx context.Context, chat models.Chat) error {
+	now := time.Now().UTC()
+	update := bson.M{
+		"$set": chatInfo(chat, now),
+		"$setOnInsert": bson.M{
+			"_id":       primitive.NewObjectID(),
+			"status":    entities.ChatMember,
+			"joinedAt":  now,
+			"createdAt": now,
+		},
+	}
+	_, err := r.col.UpdateOne(ctx, bson.M{"chatId": chat.ID}, update, options.Update().SetUpsert(true))
+	return err
+}
+
+// Migrate records the upgrade of group fromID to supergroup to: the group is marked
+// ChatMigrated, the supergroup inherits its membership. Stored messages are moved by
+// MessageStore.MoveChat.
+func (r *ChatRepository) Migrate(ctx context.Context, fromID int64, to models.Chat) error {
+	now := time.Now().UTC()
+
+	var old entities.ChatEntity
+	err := r.col.FindOneAndUpdate(ctx,
+		bson.M{"chatId": fromID},
+		bson.M{"$set": bson.M{"status": entities.ChatMigrated, "migratedTo": to.ID, "statusAt": now, "updatedAt": now}},
+	).Decode(&old)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return err
+	}
+
+	set := chatInfo(to, now)
+	set["type"] = models.ChatTypeSupergroup
+	set["migratedFrom"] = fromID
+	if to.Title == "" && old.Title != "" {
+		set["title"] = old.Title
+	}
+	insert := bson.M{
+		"_id":       primitive.NewObjectID(),
+		"status":    entities.ChatMember,
+		"joinedAt":  now,
+		"createdAt": now,
+	}
+	if old.Status.Active() {
+		insert["status"] = old.Status
+		insert["statusBy"] = old.StatusBy
+		if old.JoinedAt != nil {
+			insert["joinedAt"] = old.JoinedAt
+		}
+	}
+	_, err = r.col.UpdateOne(ctx, bson.M{"chatId": to.ID}, bson.M{"$set": set, "$setOnInsert": insert}, options.Update().SetUpsert(true))
+	return err
+}
+
+func (r *ChatRepository) FindByChatID(ctx context.Context, chatID int64) (*entities.ChatEntity, error) {
+	var c entities.ChatEntity
+	err := r.col.FindOne(ctx, bson.M{"chatId": chatID}).Decode(&c)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ChatErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// ListByStatus returns the chats in any of statuses (all when empty), oldest first.
+func (r *ChatRepository) ListByStatus(ctx context.Context, statuses ...entities.ChatStatus) ([]entities.ChatEntity, error) {
+	filter := bson.M{}
+	if len(statuses) > 0 {
+		filter["status"] = bson.M{"$in": statuses}
+	}
+	cur, err := r.col.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var out []entities.ChatEntity
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
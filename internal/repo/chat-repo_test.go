@@ -0,0 +1,46 @@
+package repo_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/frangi01/bbtelgo/internal/entities"
+	"github.com/frangi01/bbtelgo/internal/repo"
+	"github.com/go-telegram/bot/models"
+)
+
+func TestChatRepositoryJoinedAt(t *testing.T) {
+	db := newTestDB(t)
+	r := repo.NewChatRepository(db.client, db.name)
+	ctx := context.Background()
+	group := models.Chat{ID: -100, Type: models.ChatTypeGroup, Title: "group"}
+
+	// first seen through a service message, then promoted
+	if err := r.UpdateInfo(ctx, group); err != nil {
+		t.Fatalf("update info: %v", err)
+	}
+	c, err := r.FindByChatID(ctx, group.ID)
+	if err != nil || c.Status != entities.ChatMember || c.JoinedAt == nil {
+		t.Fatalf("after UpdateInfo: %+v, %v, want a member with a join date", c, err)
+	}
+	joined := *c.JoinedAt
+
+	if err := r.SetStatus(ctx, group, entities.ChatAdmin, 1, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("promote: %v", err)
+	}
+	c, err = r.FindByChatID(ctx, group.ID)
+	if err != nil || c.Status != entities.ChatAdmin || c.JoinedAt == nil || !c.JoinedAt.Equal(joined) {
+		t.Fatalf("after promotion: %+v, %v, want admin joined at %v", c, err, joined)
+	}
+
+	// the supergroup inherits the membership
+	super := models.Chat{ID: -1001, Type: models.ChatTypeSupergroup}
+	if err := r.Migrate(ctx, group.ID, super); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	c, err = r.FindByChatID(ctx, super.ID)
+	if err != nil || c.Status != entities.ChatAdmin || c.Title != "group" || c.JoinedAt == nil || !c.JoinedAt.Equal(joined) {
+		t.Fatalf("supergroup: %+v, %v, want the admin membership of the group", c, err)
+	}
+}
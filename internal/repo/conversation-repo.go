@@ -0,0 +1,77 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/frangi01/bbtelgo/internal/entities"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ConversationErrNotFound = errors.New("conversation not found")
+
+// expired conversations are kept for a while so the user can be told they timed out
+const ConversationPurgeAfter = time.Hour
+
+const ConversationCollection = "conversations"
+
+type ConversationRepository struct {
+	col *mongo.Collection
+}
+
+// NewConversationRepository: indexes are created by the migrations (internal/migrations)
+func NewConversationRepository(client *mongo.Client, dbName string) *ConversationRepository {
+	return &ConversationRepository{col: client.Database(dbName).Collection(ConversationCollection)}
+}
+
+// UpsertByChatAndUser: replaces the conversation of (chatId, userId)
+func (r *ConversationRepository) UpsertByChatAndUser(ctx context.Context, c *entities.ConversationEntity) error {
+	now := time.Now().UTC()
+
+	update := bson.M{
+		"$set": bson.M{
+			"flow":      c.Flow,
+			"state":     c.State,
+			"data":      c.Data,
+			"expiresAt": c.ExpiresAt,
+			"updatedAt": now,
+		},
+		"$setOnInsert": bson.M{
+			"_id":       primitive.NewObjectID(),
+			"createdAt": now,
+		},
+	}
+
+	filter := bson.M{"chatId": c.ChatID, "userId": c.UserID}
+	_, err := r.col.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	return err
+}
+
+// FindByChatAndUser
+func (r *ConversationRepository) FindByChatAndUser(ctx context.Context, chatID, userID int64) (*entities.ConversationEntity, error) {
+	var c entities.ConversationEntity
+	err := r.col.FindOne(ctx, bson.M{"chatId": chatID, "userId": userID}).Decode(&c)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ConversationErrNotFound
+	}
+	return &c, err
+}
+
+// DeleteByChatAndUser: no error if the conversation does not exist
+func (r *ConversationRepository) DeleteByChatAndUser(ctx context.Context, chatID, userID int64) error {
+	_, err := r.col.DeleteOne(ctx, bson.M{"chatId": chatID, "userId": userID})
+	return err
+}
+
+// DeleteByUser deletes the conversations of userID in every chat
+func (r *ConversationRepository) DeleteByUser(ctx context.Context, userID int64) (int64, error) {
+	res, err := r.col.DeleteMany(ctx, bson.M{"userId": userID})
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
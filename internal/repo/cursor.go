@@ -0,0 +1,74 @@
+package repo
+
+import (
+	"encoding/base64"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Page is a slice of a listing sorted on (key desc, _id desc).
+type Page[T any] struct {
+	Items []T
+	Next  string // cursor of the following page, "" on the last one
+	Total int64  // total matches, -1 unless requested with CountTotal
+}
+
+// cursor is the position after the last item of a page: its sort key and _id.
+type cursor struct {
+	Key bson.RawValue      `bson:"k"`
+	ID  primitive.ObjectID `bson:"i"`
+}
+
+// encodeCursor returns the opaque (URL-safe) cursor of a position.
+func encodeCursor(key any, id primitive.ObjectID) (string, error) {
+	raw, err := bson.Marshal(bson.D{{Key: "k", Value: key}, {Key: "i", Value: id}})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// decodeCursor decodes a cursor whose sort key has type K.
+func decodeCursor[K any](s string) (key K, id primitive.ObjectID, err error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return key, id, ErrInvalidCursor
+	}
+	var c cursor
+	if err := bson.Unmarshal(raw, &c); err != nil || c.ID.IsZero() {
+		return key, id, ErrInvalidCursor
+	}
+	if err := c.Key.Unmarshal(&key); err != nil {
+		return key, id, ErrInvalidCursor
+	}
+	return key, c.ID, nil
+}
+
+// afterCursor is the keyset condition of a (field desc, _id desc) listing.
+func afterCursor(field string, key any, id primitive.ObjectID) bson.M {
+	return bson.M{"$or": bson.A{
+		bson.M{field: bson.M{"$lt": key}},
+		bson.M{field: key, "_id": bson.M{"$lt": id}},
+	}}
+}
+
+// and merges filter conditions, skipping empty ones.
+func and(filters ...bson.M) bson.M {
+	var parts bson.A
+	for _, f := range filters {
+		if len(f) > 0 {
+			parts = append(parts, f)
+		}
+	}
+	switch len(parts) {
+	case 0:
+		return bson.M{}
+	case 1:
+		return parts[0].(bson.M)
+	}
+	return bson.M{"$and": parts}
+}
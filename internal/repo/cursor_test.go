@@ -0,0 +1,76 @@
+package repo
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	id := primitive.NewObjectID()
+
+	t.Run("time key", func(t *testing.T) {
+		at := time.Date(2026, 3, 4, 5, 6, 7, 8_000_000, time.UTC)
+		s, err := encodeCursor(at, id)
+		if err != nil {
+			t.Fatalf("encode: %v", err)
+		}
+		key, gotID, err := decodeCursor[time.Time](s)
+		if err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if !key.Equal(at) || gotID != id {
+			t.Fatalf("decoded (%v, %v), want (%v, %v)", key, gotID, at, id)
+		}
+	})
+
+	t.Run("int key", func(t *testing.T) {
+		s, err := encodeCursor(1700000000, id)
+		if err != nil {
+			t.Fatalf("encode: %v", err)
+		}
+		key, gotID, err := decodeCursor[int](s)
+		if err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if key != 1700000000 || gotID != id {
+			t.Fatalf("decoded (%v, %v), want (1700000000, %v)", key, gotID, id)
+		}
+	})
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	raw := func(doc bson.D) string {
+		b, err := bson.Marshal(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	timeCursor, err := encodeCursor(time.Now(), primitive.NewObjectID())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"not base64", "not a cursor!"},
+		{"not bson", base64.RawURLEncoding.EncodeToString([]byte("hello"))},
+		{"missing id", raw(bson.D{{Key: "k", Value: 1}})},
+		{"zero id", raw(bson.D{{Key: "k", Value: 1}, {Key: "i", Value: primitive.NilObjectID}})},
+		{"wrong key type", timeCursor},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := decodeCursor[int](tt.cursor); !errors.Is(err, ErrInvalidCursor) {
+				t.Fatalf("err = %v, want ErrInvalidCursor", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/frangi01/bbtelgo/internal/entities"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var DeliveryErrNotFound = errors.New("delivery not found")
+
+const DeliveryCollection = "campaign_deliveries"
+
+type DeliveryRepository struct {
+	col *mongo.Collection
+}
+
+// NewDeliveryRepository: indexes are created by the migrations (internal/migrations)
+func NewDeliveryRepository(client *mongo.Client, dbName string) *DeliveryRepository {
+	return &DeliveryRepository{col: client.Database(dbName).Collection(DeliveryCollection)}
+}
+
+// InsertPending queues the users of a campaign; users already queued are skipped,
+// so it can be repeated safely. Returns how many deliveries were added.
+func (r *DeliveryRepository) InsertPending(ctx context.Context, campaignID primitive.ObjectID, userIDs []int64) (int64, error) {
+	if len(userIDs) == 0 {
+		return 0, nil
+	}
+	now := time.Now().UTC()
+	docs := make([]any, 0, len(userIDs))
+	for _, id := range userIDs {
+		docs = append(docs, entities.DeliveryEntity{
+			MongoID:    primitive.NewObjectID(),
+			CampaignID: campaignID,
+			UserID:     id,
+			Status:     entities.DeliveryPending,
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		})
+	}
+
+	_, err := r.col.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	if err == nil {
+		return int64(len(docs)), nil
+	}
+	var bwe mongo.BulkWriteException
+	if !errors.As(err, &bwe) || bwe.WriteConcernError != nil {
+		return 0, err
+	}
+	for _, we := range bwe.WriteErrors {
+		if !mongo.IsDuplicateKeyError(we) {
+			return 0, err
+		}
+	}
+	return int64(len(docs) - len(bwe.WriteErrors)), nil
+}
+
+// Pending returns up to limit queued deliveries of a campaign
+func (r *DeliveryRepository) Pending(ctx context.Context, campaignID primitive.ObjectID, limit int64) ([]entities.DeliveryEntity, error) {
+	findOpt := options.Find().
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetLimit(limit)
+
+	cur, err := r.col.Find(ctx, bson.M{"campaignId": campaignID, "status": entities.DeliveryPending}, findOpt)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var out []entities.DeliveryEntity
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Claim moves a pending delivery to sending, so only one worker sends it; false if
+// someone else claimed it first.
+func (r *DeliveryRepository) Claim(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	return r.transition(ctx, id, entities.DeliveryPending, bson.M{"status": entities.DeliverySending})
+}
+
+// Release puts a claimed delivery back in the queue (not sent, e.g. on shutdown).
+func (r *DeliveryRepository) Release(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	return r.transition(ctx, id, entities.DeliverySending, bson.M{"status": entities.DeliveryPending})
+}
+
+// ReleaseStale puts back in the queue the deliveries of a campaign claimed before
+// "before" and never completed (the worker died while sending them).
+func (r *DeliveryRepository) ReleaseStale(ctx context.Context, campaignID primitive.ObjectID, before time.Time) (int64, error) {
+	res, err := r.col.UpdateMany(ctx,
+		bson.M{"campaignId": campaignID, "status": entities.DeliverySending, "updatedAt": bson.M{"$lt": before}},
+		bson.M{"$set": bson.M{"status": entities.DeliveryPending, "updatedAt": time.Now().UTC()}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
+
+// Count returns the deliveries of a campaign in status
+func (r *DeliveryRepository) Count(ctx context.Context, campaignID primitive.ObjectID, status entities.DeliveryStatus) (int64, error) {
+	return r.col.CountDocuments(ctx, bson.M{"campaignId": campaignID, "status": status})
+}
+
+func (r *DeliveryRepository) transition(ctx context.Context, id primitive.ObjectID, from entities.DeliveryStatus, set bson.M) (bool, error) {
+	set["updatedAt"] = time.Now().UTC()
+	res, err := r.col.UpdateOne(ctx, bson.M{"_id": id, "status": from}, bson.M{"$set": set})
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount == 1, nil
+}
+
+// Complete stores the outcome of a claimed delivery; false if it is not claimed (anymore).
+func (r *DeliveryRepository) Complete(ctx context.Context, id primitive.ObjectID, status entities.DeliveryStatus, messageID int, errMsg string) (bool, error) {
+	set := bson.M{"status": status, "updatedAt": time.Now().UTC()}
+	if messageID != 0 {
+		set["messageId"] = messageID
+	}
+	if errMsg != "" {
+		set["error"] = errMsg
+	}
+	return r.transition(ctx, id, entities.DeliverySending, set)
+}
+
+// CountByStatus returns the number of deliveries of a campaign per status
+func (r *DeliveryRepository) CountByStatus(ctx context.Context, campaignID primitive.ObjectID) (map[entities.DeliveryStatus]int64, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"campaignId": campaignID}}},
+		{{Key: "$group", Value: bson.M{"_id": "$status", "n": bson.M{"$sum": 1}}}},
+	}
+	cur, err := r.col.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	out := map[entities.DeliveryStatus]int64{}
+	for cur.Next(ctx) {
+		var row struct {
+			Status entities.DeliveryStatus `bson:"_id"`
+			N      int64                   `bson:"n"`
+		}
+		if err := cur.Decode(&row); err != nil {
+			return nil, err
+		}
+		out[row.Status] = row.N
+	}
+	return out, cur.Err()
+}
+
+// DeleteByCampaign removes the whole delivery log of a campaign
+func (r *DeliveryRepository) DeleteByCampaign(ctx context.Context, campaignID primitive.ObjectID) (int64, error) {
+	res, err := r.col.DeleteMany(ctx, bson.M{"campaignId": campaignID})
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
+
+// DeleteByUser removes the deliveries of a user from every campaign (erasure)
+func (r *DeliveryRepository) DeleteByUser(ctx context.Context, userID int64) (int64, error) {
+	res, err := r.col.DeleteMany(ctx, bson.M{"userId": userID})
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
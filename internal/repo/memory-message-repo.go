@@ -0,0 +1,400 @@
+package repo
+
+import (
+	"cmp"
+	"context"
+	"sort"
+	"strings"
+	"unicode"
+	"sync"
+	"time"
+
+	"github.com/frangi01/bbtelgo/internal/entities"
+	"github.com/go-telegram/bot/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memMessageKey struct {
+	chatID    int64
+	messageID int
+}
+
+// MemoryMessageRepository is a thread-safe MessageStore kept in memory (tests, lightweight deployments).
+// It enforces the same unique keys as the Mongo indexes (_id, chat.id + id); changes are not audited.
+type MemoryMessageRepository struct {
+	mu    sync.RWMutex
+	byID  map[primitive.ObjectID]*entities.MessageEntity
+	byKey map[memMessageKey]primitive.ObjectID
+}
+
+func NewMemoryMessageRepository() *MemoryMessageRepository {
+	return &MemoryMessageRepository{
+		byID:  make(map[primitive.ObjectID]*entities.MessageEntity),
+		byKey: make(map[memMessageKey]primitive.ObjectID),
+	}
+}
+
+func messageKey(m *entities.MessageEntity) memMessageKey {
+	return memMessageKey{chatID: m.Chat.ID, messageID: m.Message.ID}
+}
+
+func (r *MemoryMessageRepository) Create(ctx context.Context, m *entities.MessageEntity) (primitive.ObjectID, error) {
+	if m.MongoID.IsZero() {
+		m.MongoID = primitive.NewObjectID()
+	}
+	now := time.Now().UTC()
+	if m.CreatedAt.IsZero() {
+		m.CreatedAt = now
+	}
+	m.UpdatedAt = now
+
+	doc, err := memClone(m)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.byID[doc.MongoID]; ok {
+		return primitive.NilObjectID, memDuplicateKey("_id_")
+	}
+	if _, ok := r.byKey[messageKey(doc)]; ok {
+		return primitive.NilObjectID, memDuplicateKey("uniq_chatId_messageId")
+	}
+	r.byID[doc.MongoID] = doc
+	r.byKey[messageKey(doc)] = doc.MongoID
+	return doc.MongoID, nil
+}
+
+func (r *MemoryMessageRepository) UpsertByChatAndMessageID(ctx context.Context, m *entities.MessageEntity) (created bool, oid primitive.ObjectID, err error) {
+	doc, err := memClone(m)
+	if err != nil {
+		return false, primitive.NilObjectID, err
+	}
+	now := time.Now().UTC()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// as in Mongo: _id and createdAt only on insert
+	doc.UpdatedAt = now
+	doc.DeletedAt = nil
+	if id, ok := r.byKey[messageKey(doc)]; ok {
+		doc.MongoID, doc.CreatedAt, doc.DeletedAt = id, r.byID[id].CreatedAt, r.byID[id].DeletedAt
+		r.byID[id] = doc
+		return false, id, nil
+	}
+	doc.MongoID, doc.CreatedAt = primitive.NewObjectID(), now
+	r.byID[doc.MongoID] = doc
+	r.byKey[messageKey(doc)] = doc.MongoID
+	return true, doc.MongoID, nil
+}
+
+func (r *MemoryMessageRepository) FindByObjectID(ctx context.Context, id primitive.ObjectID) (*entities.MessageEntity, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	doc, ok := r.byID[id]
+	if !ok || doc.DeletedAt != nil {
+		return nil, MessageErrNotFound
+	}
+	return memClone(doc)
+}
+
+func (r *MemoryMessageRepository) FindByChatAndMessageID(ctx context.Context, chatID int64, messageID int) (*entities.MessageEntity, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	id, ok := r.byKey[memMessageKey{chatID: chatID, messageID: messageID}]
+	if !ok || r.byID[id].DeletedAt != nil {
+		return nil, MessageErrNotFound
+	}
+	return memClone(r.byID[id])
+}
+
+func (r *MemoryMessageRepository) Update(ctx context.Context, id primitive.ObjectID, set bson.M) error {
+	set["updatedAt"] = time.Now().UTC()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	old, ok := r.byID[id]
+	if !ok || old.DeletedAt != nil {
+		return MessageErrNotFound
+	}
+	doc, err := memApplySet(old, set)
+	if err != nil {
+		return err
+	}
+	doc.MongoID = id
+	if other, ok := r.byKey[messageKey(doc)]; ok && other != id {
+		return memDuplicateKey("uniq_chatId_messageId")
+	}
+	delete(r.byKey, messageKey(old))
+	r.byID[id] = doc
+	r.byKey[messageKey(doc)] = id
+	return nil
+}
+
+func (r *MemoryMessageRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return r.setDeleted(id, true)
+}
+
+func (r *MemoryMessageRepository) Restore(ctx context.Context, id primitive.ObjectID) error {
+	return r.setDeleted(id, false)
+}
+
+// setDeleted soft-deletes (or restores) the message, which must be in the opposite state.
+func (r *MemoryMessageRepository) setDeleted(id primitive.ObjectID, del bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	doc, ok := r.byID[id]
+	if !ok || (doc.DeletedAt != nil) == del {
+		return MessageErrNotFound
+	}
+	doc.UpdatedAt, doc.DeletedAt = *memNow(), nil
+	if del {
+		doc.DeletedAt = memNow()
+	}
+	return nil
+}
+
+func (r *MemoryMessageRepository) DeleteMany(ctx context.Context, f MessageFilter) (int64, error) {
+	f.IncludeDeleted = true
+	if len(messageFilter(f)) == 0 {
+		return 0, MessageErrEmptyFilter
+	}
+	match := memMessageMatch(f)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var n int64
+	for id, doc := range r.byID {
+		if match(doc) {
+			delete(r.byID, id)
+			delete(r.byKey, messageKey(doc))
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (r *MemoryMessageRepository) DeleteByIDs(ctx context.Context, ids []primitive.ObjectID) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var n int64
+	for _, id := range ids {
+		if doc, ok := r.byID[id]; ok {
+			delete(r.byID, id)
+			delete(r.byKey, messageKey(doc))
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (r *MemoryMessageRepository) AnonymizeSender(ctx context.Context, fromID int64) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now().UTC()
+	var n int64
+	for _, doc := range r.byID {
+		if doc.From != nil && doc.From.ID == fromID {
+			from := AnonymousSender
+			doc.From, doc.UpdatedAt = &from, now
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (r *MemoryMessageRepository) MoveChat(ctx context.Context, fromChatID, toChatID int64) (moved, skipped int64, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now().UTC()
+	for _, doc := range r.byID {
+		if doc.Chat.ID != fromChatID {
+			continue
+		}
+		key := memMessageKey{chatID: toChatID, messageID: doc.Message.ID}
+		if _, ok := r.byKey[key]; ok {
+			skipped++
+			continue
+		}
+		delete(r.byKey, messageKey(doc))
+		doc.Chat.ID, doc.Chat.Type, doc.UpdatedAt = toChatID, models.ChatTypeSupergroup, now
+		r.byKey[key] = doc.MongoID
+		moved++
+	}
+	return moved, skipped, nil
+}
+
+func (r *MemoryMessageRepository) List(ctx context.Context, opt MessageListOptions) (Page[entities.MessageEntity], error) {
+	if opt.PerPage <= 0 || opt.PerPage > 1000 {
+		opt.PerPage = 50
+	}
+	var after func(*entities.MessageEntity) bool
+	if opt.Cursor != "" {
+		date, id, err := decodeCursor[int](opt.Cursor)
+		if err != nil {
+			return Page[entities.MessageEntity]{Total: -1}, err
+		}
+		after = func(m *entities.MessageEntity) bool {
+			return memAfter(cmp.Compare(m.Date, date), m.MongoID, id)
+		}
+	}
+
+	matched, err := r.matching(opt.MessageFilter)
+	if err != nil {
+		return Page[entities.MessageEntity]{Total: -1}, err
+	}
+	// date desc, _id desc
+	sort.Slice(matched, func(i, j int) bool {
+		// i first when j comes after it
+		return memAfter(cmp.Compare(matched[j].Date, matched[i].Date), matched[j].MongoID, matched[i].MongoID)
+	})
+
+	return memPaginate(matched, memPageOptions{page: opt.Page, perPage: opt.PerPage, countTotal: opt.CountTotal}, after,
+		func(m *entities.MessageEntity) (string, error) { return encodeCursor(m.Date, m.MongoID) })
+}
+
+func (r *MemoryMessageRepository) Iterate(ctx context.Context, f MessageFilter, fn func(m *entities.MessageEntity) error) error {
+	matched, err := r.matching(f)
+	if err != nil {
+		return err
+	}
+	// date asc, _id asc
+	sort.Slice(matched, func(i, j int) bool {
+		if matched[i].Date != matched[j].Date {
+			return matched[i].Date < matched[j].Date
+		}
+		return matched[i].MongoID.Hex() < matched[j].MongoID.Hex()
+	})
+
+	for i := range matched {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(&matched[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func memMessageMatch(f MessageFilter) func(m *entities.MessageEntity) bool {
+	var textLike string
+	if f.TextLike != nil {
+		textLike = strings.ToLower(*f.TextLike)
+	}
+	return func(m *entities.MessageEntity) bool {
+		switch {
+		case !f.IncludeDeleted && m.DeletedAt != nil:
+			return false
+		case f.ChatID != nil && m.Chat.ID != *f.ChatID:
+			return false
+		case f.ChatType != nil && m.Chat.Type != *f.ChatType:
+			return false
+		case f.FromID != nil && (m.From == nil || m.From.ID != *f.FromID):
+			return false
+		case f.DateFrom != nil && int64(m.Date) < *f.DateFrom:
+			return false
+		case f.DateTo != nil && int64(m.Date) >= *f.DateTo:
+			return false
+		case textLike != "" && !strings.Contains(strings.ToLower(m.Text), textLike):
+			return false
+		}
+		return true
+	}
+}
+
+// matching returns copies of the messages accepted by f.
+func (r *MemoryMessageRepository) matching(f MessageFilter) ([]entities.MessageEntity, error) {
+	match := memMessageMatch(f)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var out []entities.MessageEntity
+	for _, doc := range r.byID {
+		if !match(doc) {
+			continue
+		}
+		c, err := memClone(doc)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *c)
+	}
+	return out, nil
+}
+
+// Search approximates the Mongo text search: whole-word, case-insensitive matches
+// without stemming, scored by the number of matched terms.
+func (r *MemoryMessageRepository) Search(ctx context.Context, opt MessageSearchOptions) ([]MessageHit, error) {
+	opt.TextLike = nil
+	if opt.Limit <= 0 {
+		opt.Limit = DefaultSearchLimit
+	}
+	opt.Limit = min(opt.Limit, MaxSearchLimit)
+	q := parseSearchQuery(opt.Query, opt.Mode)
+	if len(q.terms) == 0 {
+		return nil, nil
+	}
+
+	matched, err := r.matching(opt.MessageFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	var hits []MessageHit
+	for i := range matched {
+		m := &matched[i]
+		score, ok := memSearchScore(strings.ToLower(m.Text+"\n"+m.Caption), q, opt.Mode)
+		if !ok {
+			continue
+		}
+		hit := MessageHit{Message: *m}
+		if opt.Mode == SearchText {
+			hit.Score = score
+		}
+		hit.Snippet, hit.Matches = snippet(searchableText(m), q.terms, opt.SnippetLength)
+		hits = append(hits, hit)
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		a, b := hits[i], hits[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		return memAfter(cmp.Compare(b.Message.Date, a.Message.Date), b.Message.MongoID, a.Message.MongoID)
+	})
+	if int64(len(hits)) > opt.Limit {
+		hits = hits[:opt.Limit]
+	}
+	return hits, nil
+}
+
+func memSearchScore(text string, q searchQuery, mode SearchMode) (float64, bool) {
+	for _, p := range q.phrases {
+		if !strings.Contains(text, p) {
+			return 0, false
+		}
+	}
+	if mode == SearchSubstring {
+		return 0, true
+	}
+
+	words := strings.FieldsFunc(text, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsNumber(r) })
+	has := make(map[string]int, len(words))
+	for _, w := range words {
+		has[w]++
+	}
+	for _, w := range q.excluded {
+		if has[w] > 0 {
+			return 0, false
+		}
+	}
+	score := 0.0
+	for _, t := range q.terms {
+		score += float64(has[t])
+	}
+	return score, score > 0 || len(q.phrases) > 0
+}
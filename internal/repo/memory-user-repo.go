@@ -0,0 +1,402 @@
+package repo
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/frangi01/bbtelgo/internal/entities"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryUserRepository is a thread-safe UserStore kept in memory (tests, lightweight deployments).
+// It enforces the same unique keys as the Mongo indexes (_id, Telegram ID); changes are not audited.
+type MemoryUserRepository struct {
+	mu         sync.RWMutex
+	byID       map[primitive.ObjectID]*entities.UserEntity
+	byTelegram map[int64]primitive.ObjectID
+}
+
+func NewMemoryUserRepository() *MemoryUserRepository {
+	return &MemoryUserRepository{
+		byID:       make(map[primitive.ObjectID]*entities.UserEntity),
+		byTelegram: make(map[int64]primitive.ObjectID),
+	}
+}
+
+func (r *MemoryUserRepository) Create(ctx context.Context, u *entities.UserEntity) (primitive.ObjectID, error) {
+	if u.MongoID.IsZero() {
+		u.MongoID = primitive.NewObjectID()
+	}
+	now := time.Now().UTC()
+	if u.CreatedAt.IsZero() {
+		u.CreatedAt = now
+	}
+	u.UpdatedAt = now
+
+	doc, err := memClone(u)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.byID[doc.MongoID]; ok {
+		return primitive.NilObjectID, memDuplicateKey("_id_")
+	}
+	if _, ok := r.byTelegram[doc.ID]; ok {
+		return primitive.NilObjectID, memDuplicateKey("uniq_telegram_id")
+	}
+	r.byID[doc.MongoID] = doc
+	r.byTelegram[doc.ID] = doc.MongoID
+	return doc.MongoID, nil
+}
+
+func (r *MemoryUserRepository) UpsertByTelegramID(ctx context.Context, u *entities.UserEntity) (created bool, oid primitive.ObjectID, err error) {
+	doc, err := memClone(u)
+	if err != nil {
+		return false, primitive.NilObjectID, err
+	}
+	now := time.Now().UTC()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// as in Mongo: on update only the Telegram fields change
+	if id, ok := r.byTelegram[doc.ID]; ok {
+		if r.byID[id].DeletedAt != nil {
+			return false, id, UserErrDeleted
+		}
+		updated, err := memClone(r.byID[id])
+		if err != nil {
+			return false, primitive.NilObjectID, err
+		}
+		updated.User = doc.User
+		updated.UpdatedAt = now
+		r.byID[id] = updated
+		return false, id, nil
+	}
+	doc.MongoID, doc.CreatedAt, doc.UpdatedAt = primitive.NewObjectID(), now, now
+	r.byID[doc.MongoID] = doc
+	r.byTelegram[doc.ID] = doc.MongoID
+	return true, doc.MongoID, nil
+}
+
+func (r *MemoryUserRepository) FindByObjectID(ctx context.Context, id primitive.ObjectID) (*entities.UserEntity, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	doc, ok := r.byID[id]
+	if !ok || doc.DeletedAt != nil {
+		return nil, UserErrNotFound
+	}
+	return memClone(doc)
+}
+
+func (r *MemoryUserRepository) FindByTelegramID(ctx context.Context, telegramID int64) (*entities.UserEntity, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	id, ok := r.byTelegram[telegramID]
+	if !ok || r.byID[id].DeletedAt != nil {
+		return nil, UserErrNotFound
+	}
+	return memClone(r.byID[id])
+}
+
+func (r *MemoryUserRepository) FindByUsername(ctx context.Context, username string) (*entities.UserEntity, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	username = strings.TrimPrefix(strings.TrimSpace(username), "@")
+	if username == "" {
+		return nil, UserErrNotFound
+	}
+	for _, doc := range r.byID {
+		if doc.DeletedAt == nil && doc.Username != "" && strings.EqualFold(doc.Username, username) {
+			return memClone(doc)
+		}
+	}
+	return nil, UserErrNotFound
+}
+
+func (r *MemoryUserRepository) Update(ctx context.Context, id primitive.ObjectID, set bson.M) error {
+	set["updatedAt"] = time.Now().UTC()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	old, ok := r.byID[id]
+	if !ok || old.DeletedAt != nil {
+		return UserErrNotFound
+	}
+	doc, err := memApplySet(old, set)
+	if err != nil {
+		return err
+	}
+	doc.MongoID = id
+	if other, ok := r.byTelegram[doc.ID]; ok && other != id {
+		return memDuplicateKey("uniq_telegram_id")
+	}
+	delete(r.byTelegram, old.ID)
+	r.byID[id] = doc
+	r.byTelegram[doc.ID] = id
+	return nil
+}
+
+// modify applies fn to the stored user with the Telegram ID, touching updatedAt
+// unless fn returns false.
+func (r *MemoryUserRepository) modify(telegramID int64, fn func(u *entities.UserEntity) bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	id, ok := r.byTelegram[telegramID]
+	if !ok || r.byID[id].DeletedAt != nil {
+		return UserErrNotFound
+	}
+	u := r.byID[id]
+	if fn(u) {
+		u.UpdatedAt = time.Now().UTC().Truncate(time.Millisecond)
+	}
+	return nil
+}
+
+func memNow() *time.Time {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	return &now
+}
+
+func (r *MemoryUserRepository) SetBlocked(ctx context.Context, telegramID int64, blocked bool) error {
+	return r.modify(telegramID, func(u *entities.UserEntity) bool {
+		u.Blocked, u.BlockedAt = false, nil
+		if blocked {
+			u.Blocked, u.BlockedAt = true, memNow()
+		}
+		return true
+	})
+}
+
+func (r *MemoryUserRepository) SetBanned(ctx context.Context, telegramID int64, banned bool, reason string) error {
+	return r.modify(telegramID, func(u *entities.UserEntity) bool {
+		u.Banned, u.BannedAt, u.BanReason = false, nil, ""
+		if banned {
+			u.Banned, u.BannedAt, u.BanReason = true, memNow(), reason
+		}
+		return true
+	})
+}
+
+func (r *MemoryUserRepository) SetLanguage(ctx context.Context, telegramID int64, lang string) error {
+	return r.modify(telegramID, func(u *entities.UserEntity) bool {
+		u.Language = lang
+		return true
+	})
+}
+
+func (r *MemoryUserRepository) AddRole(ctx context.Context, telegramID int64, role entities.Role) error {
+	return r.modify(telegramID, func(u *entities.UserEntity) bool {
+		if !slices.Contains(u.Roles, role) {
+			u.Roles = append(slices.Clone(u.Roles), role)
+		}
+		return true
+	})
+}
+
+func (r *MemoryUserRepository) RemoveRole(ctx context.Context, telegramID int64, role entities.Role) error {
+	return r.modify(telegramID, func(u *entities.UserEntity) bool {
+		u.Roles = slices.DeleteFunc(slices.Clone(u.Roles), func(x entities.Role) bool { return x == role })
+		if len(u.Roles) == 0 {
+			u.Roles = nil
+		}
+		return true
+	})
+}
+
+func (r *MemoryUserRepository) SetRoles(ctx context.Context, telegramID int64, roles []entities.Role) error {
+	return r.modify(telegramID, func(u *entities.UserEntity) bool {
+		u.Roles = nil
+		if len(roles) > 0 {
+			u.Roles = slices.Clone(roles)
+		}
+		return true
+	})
+}
+
+func (r *MemoryUserRepository) TouchLastSeen(ctx context.Context, telegramID int64, at time.Time) error {
+	at = at.UTC().Truncate(time.Millisecond)
+	return r.modify(telegramID, func(u *entities.UserEntity) bool {
+		if u.LastSeenAt == nil || at.After(*u.LastSeenAt) {
+			u.LastSeenAt = &at
+		}
+		u.Blocked, u.BlockedAt = false, nil
+		return true
+	})
+}
+
+func (r *MemoryUserRepository) SetReferralSource(ctx context.Context, telegramID int64, source string) (set bool, err error) {
+	if source == "" {
+		return false, nil
+	}
+	err = r.modify(telegramID, func(u *entities.UserEntity) bool {
+		if u.ReferralSource != "" {
+			return false
+		}
+		u.ReferralSource, set = source, true
+		return true
+	})
+	return set, err
+}
+
+func (r *MemoryUserRepository) SetSetting(ctx context.Context, telegramID int64, key string, value any) error {
+	if err := validSettingKey(key); err != nil {
+		return err
+	}
+	// through BSON, so the stored value has the types Mongo would return
+	var stored any
+	if value != nil {
+		raw, err := bson.Marshal(bson.M{"v": value})
+		if err != nil {
+			return err
+		}
+		var doc bson.M
+		if err := bson.Unmarshal(raw, &doc); err != nil {
+			return err
+		}
+		stored = doc["v"]
+	}
+	return r.modify(telegramID, func(u *entities.UserEntity) bool {
+		settings := make(map[string]any, len(u.Settings)+1)
+		for k, v := range u.Settings {
+			settings[k] = v
+		}
+		if value == nil {
+			delete(settings, key)
+		} else {
+			settings[key] = stored
+		}
+		u.Settings = settings
+		if len(settings) == 0 {
+			u.Settings = nil
+		}
+		return true
+	})
+}
+
+func (r *MemoryUserRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return r.setDeleted(id, true)
+}
+
+func (r *MemoryUserRepository) Restore(ctx context.Context, id primitive.ObjectID) error {
+	return r.setDeleted(id, false)
+}
+
+// setDeleted soft-deletes (or restores) the user, which must be in the opposite state.
+func (r *MemoryUserRepository) setDeleted(id primitive.ObjectID, del bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	doc, ok := r.byID[id]
+	if !ok || (doc.DeletedAt != nil) == del {
+		return UserErrNotFound
+	}
+	doc.UpdatedAt, doc.DeletedAt = *memNow(), nil
+	if del {
+		doc.DeletedAt = memNow()
+	}
+	return nil
+}
+
+func (r *MemoryUserRepository) PurgeByTelegramID(ctx context.Context, telegramID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	id, ok := r.byTelegram[telegramID]
+	if !ok {
+		return UserErrNotFound
+	}
+	delete(r.byID, id)
+	delete(r.byTelegram, telegramID)
+	return nil
+}
+
+func (r *MemoryUserRepository) List(ctx context.Context, opt ListOptions) (Page[entities.UserEntity], error) {
+	if opt.PerPage <= 0 || opt.PerPage > 1000 {
+		opt.PerPage = 20
+	}
+	var prefix *regexp.Regexp
+	if opt.UsernamePrefix != nil && *opt.UsernamePrefix != "" {
+		prefix = regexp.MustCompile("^" + regexp.QuoteMeta(*opt.UsernamePrefix))
+	}
+	var after func(*entities.UserEntity) bool
+	if opt.Cursor != "" {
+		createdAt, id, err := decodeCursor[time.Time](opt.Cursor)
+		if err != nil {
+			return Page[entities.UserEntity]{Total: -1}, err
+		}
+		after = func(u *entities.UserEntity) bool {
+			return memAfter(u.CreatedAt.Compare(createdAt), u.MongoID, id)
+		}
+	}
+
+	matched, err := r.matching(func(u *entities.UserEntity) bool {
+		return u.DeletedAt == nil && (prefix == nil || prefix.MatchString(u.Username))
+	})
+	if err != nil {
+		return Page[entities.UserEntity]{Total: -1}, err
+	}
+	// createdAt desc, _id desc
+	sort.Slice(matched, func(i, j int) bool {
+		// i first when j comes after it
+		return memAfter(matched[j].CreatedAt.Compare(matched[i].CreatedAt), matched[j].MongoID, matched[i].MongoID)
+	})
+
+	return memPaginate(matched, memPageOptions{page: opt.Page, perPage: opt.PerPage, countTotal: opt.CountTotal}, after,
+		func(u *entities.UserEntity) (string, error) { return encodeCursor(u.CreatedAt, u.MongoID) })
+}
+
+func (r *MemoryUserRepository) Iterate(ctx context.Context, f entities.UserFilter, fn func(u *entities.UserEntity) error) error {
+	matched, err := r.matching(func(u *entities.UserEntity) bool {
+		switch {
+		case len(f.LanguageCodes) > 0 && !slices.Contains(f.LanguageCodes, u.Lang()):
+			return false
+		case len(f.TelegramIDs) > 0 && !slices.Contains(f.TelegramIDs, u.ID):
+			return false
+		case !f.IncludeBlocked && u.Blocked:
+			return false
+		case !f.IncludeDeleted && u.DeletedAt != nil:
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	// _id order, as in Mongo
+	sort.Slice(matched, func(i, j int) bool { return matched[i].MongoID.Hex() < matched[j].MongoID.Hex() })
+
+	for i := range matched {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(&matched[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matching returns copies of the users accepted by match.
+func (r *MemoryUserRepository) matching(match func(u *entities.UserEntity) bool) ([]entities.UserEntity, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var out []entities.UserEntity
+	for _, doc := range r.byID {
+		if !match(doc) {
+			continue
+		}
+		c, err := memClone(doc)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *c)
+	}
+	return out, nil
+}
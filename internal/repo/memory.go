@@ -0,0 +1,119 @@
+package repo
+
+import (
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Helpers of the in-memory repositories: documents go through a BSON round trip,
+// so they are stored and returned exactly as Mongo would (deep copies, ms precision).
+
+func memClone[T any](v *T) (*T, error) {
+	raw, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out T
+	if err := bson.Unmarshal(raw, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// memApplySet applies a $set document (dotted paths allowed) to v.
+func memApplySet[T any](v *T, set bson.M) (*T, error) {
+	raw, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var doc bson.M
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	for path, value := range set {
+		keys := strings.Split(path, ".")
+		node := doc
+		for _, k := range keys[:len(keys)-1] {
+			child, ok := node[k].(bson.M)
+			if !ok {
+				if node[k] != nil {
+					return nil, fmt.Errorf("cannot set %q: %q is not a document", path, k)
+				}
+				child = bson.M{}
+				node[k] = child
+			}
+			node = child
+		}
+		node[keys[len(keys)-1]] = value
+	}
+
+	raw, err = bson.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var out T
+	if err := bson.Unmarshal(raw, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// memDuplicateKey mimics the error of a unique index violation (mongo.IsDuplicateKeyError is true).
+func memDuplicateKey(index string) error {
+	return mongo.WriteException{WriteErrors: mongo.WriteErrors{{
+		Code:    11000,
+		Message: "E11000 duplicate key error index: " + index,
+	}}}
+}
+
+// memPaginate returns a page of items (sorted as the Mongo listing) like List does:
+// after (nil without cursor) tells whether an item comes after the cursor position,
+// next encodes the cursor of an item; total is -1 unless counted.
+func memPaginate[T any](items []T, opt memPageOptions, after func(*T) bool, next func(*T) (string, error)) (Page[T], error) {
+	page := Page[T]{Items: []T{}, Total: -1}
+	if opt.countTotal {
+		page.Total = int64(len(items))
+	}
+
+	switch {
+	case after != nil:
+		i := 0
+		for i < len(items) && !after(&items[i]) {
+			i++
+		}
+		items = items[i:]
+	case opt.page > 1:
+		from := min((opt.page-1)*opt.perPage, int64(len(items)))
+		items = items[from:]
+	}
+
+	if int64(len(items)) > opt.perPage {
+		items = items[:opt.perPage]
+		cur, err := next(&items[len(items)-1])
+		if err != nil {
+			return page, err
+		}
+		page.Next = cur
+	}
+	page.Items = append(page.Items, items...)
+	return page, nil
+}
+
+type memPageOptions struct {
+	page       int64
+	perPage    int64
+	countTotal bool
+}
+
+// memAfter tells whether an item comes after the cursor (cKey, cID) in a (key desc, _id desc)
+// listing; cmpKeys compares the item key with cKey (-1, 0, +1).
+func memAfter(cmpKeys int, id, cID primitive.ObjectID) bool {
+	if cmpKeys != 0 {
+		return cmpKeys < 0
+	}
+	return id.Hex() < cID.Hex()
+}
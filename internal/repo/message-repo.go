@@ -3,49 +3,50 @@ package repo
 import (
 	"context"
 	"errors"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/frangi01/bbtelgo/internal/entities"
+	"github.com/go-telegram/bot/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-var MessageErrNotFound = errors.New("message not found")
+var (
+	MessageErrNotFound    = errors.New("message not found")
+	MessageErrEmptyFilter = errors.New("message filter is empty")
+)
+
+// AnonymousSender replaces the sender of anonymized messages (see AnonymizeSender)
+var AnonymousSender = models.User{FirstName: "Deleted user"}
+
+// Key of a message document: models.Message has no bson tags, so the driver
+// lowercases the field names (Message.ID -> "id", Chat.ID -> "chat.id").
+const (
+	MessageFieldChatID = "chat.id"
+	MessageFieldID     = "id"
+)
 
+const MessageCollection = "messages"
+
+// MessageRepository records Update, Delete and Restore in the audit log (AuditCollection),
+// attributed to the actor of the context (see WithActor); the transcript writes and the
+// bulk operations (DeleteMany, AnonymizeSender, MoveChat) are not recorded one by one.
 type MessageRepository struct {
-	col *mongo.Collection
-}
-
-func NewMessageRepository(client *mongo.Client, dbName string) (*MessageRepository, error) {
-	col := client.Database(dbName).Collection("messages")
-
-	// Indexes:
-	// 1) Unique on (chat.id, messageid)
-	// 2) Non-unique on date for range query (timeline)
-	// 3) Non-unique on from.id to filter by sender
-	_, err := col.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
-		{
-			Keys: bson.D{
-				{Key: "chat.id", Value: 1},
-				{Key: "id", Value: 1}, // models.Message.MessageID -> "messageid"
-			},
-			Options: options.Index().SetUnique(true).SetName("uniq_chatId_messageId"),
-		},
-		{
-			Keys:    bson.D{{Key: "date", Value: -1}}, // models.Message.Date (unix)
-			Options: options.Index().SetName("idx_date"),
-		},
-		{
-			Keys:    bson.D{{Key: "from.id", Value: 1}}, // sender Telegram
-			Options: options.Index().SetName("idx_fromId"),
-		},
-	})
-	if err != nil {
-		return nil, err
+	col   *mongo.Collection
+	audit *AuditRepository
+}
+
+// NewMessageRepository: indexes are created by the migrations (internal/migrations);
+// audit nil = changes not recorded.
+func NewMessageRepository(client *mongo.Client, dbName string, audit *AuditRepository) *MessageRepository {
+	return &MessageRepository{
+		col:   client.Database(dbName).Collection(MessageCollection),
+		audit: audit,
 	}
-	return &MessageRepository{col: col}, nil
 }
 
 // Create: inserts a new message (fails if it violates the unique index)
@@ -67,8 +68,8 @@ func (r *MessageRepository) Create(ctx context.Context, m *entities.MessageEntit
 	return oid, nil
 }
 
-// UpsertByChatAndMessageID: idempotent on key (chat.id, messageid)
-// If it exists -> updates Telegram payload + updatedAt
+// UpsertByChatAndMessageID: idempotent on key (chat.id, id)
+// If it exists -> updates Telegram payload + updatedAt (a soft-deleted message stays deleted)
 // If it does not exist -> inserts with _id and createdAt
 func (r *MessageRepository) UpsertByChatAndMessageID(ctx context.Context, m *entities.MessageEntity) (created bool, oid primitive.ObjectID, err error) {
 	// if m.Chat == nil {
@@ -94,12 +95,13 @@ func (r *MessageRepository) UpsertByChatAndMessageID(ctx context.Context, m *ent
 	}
 	delete(setDoc, "_id")
 	delete(setDoc, "createdAt")
+	delete(setDoc, deletedAtField)
 	setDoc["updatedAt"] = now
 	update["$set"] = setDoc
 
 	filter := bson.M{
-		"chat.id":   m.Chat.ID,
-		"messageid": m.Message.ID,
+		MessageFieldChatID: m.Chat.ID,
+		MessageFieldID:     m.Message.ID,
 	}
 
 	opts := options.Update().SetUpsert(true)
@@ -128,7 +130,7 @@ func (r *MessageRepository) UpsertByChatAndMessageID(ctx context.Context, m *ent
 // FindByObjectID
 func (r *MessageRepository) FindByObjectID(ctx context.Context, id primitive.ObjectID) (*entities.MessageEntity, error) {
 	var m entities.MessageEntity
-	err := r.col.FindOne(ctx, bson.M{"_id": id}).Decode(&m)
+	err := r.col.FindOne(ctx, live(bson.M{"_id": id})).Decode(&m)
 	if errors.Is(err, mongo.ErrNoDocuments) {
 		return nil, MessageErrNotFound
 	}
@@ -138,7 +140,7 @@ func (r *MessageRepository) FindByObjectID(ctx context.Context, id primitive.Obj
 // FindByChatAndMessageID
 func (r *MessageRepository) FindByChatAndMessageID(ctx context.Context, chatID int64, messageID int) (*entities.MessageEntity, error) {
 	var m entities.MessageEntity
-	err := r.col.FindOne(ctx, bson.M{"chat.id": chatID, "messageid": messageID}).Decode(&m)
+	err := r.col.FindOne(ctx, live(bson.M{MessageFieldChatID: chatID, MessageFieldID: messageID})).Decode(&m)
 	if errors.Is(err, mongo.ErrNoDocuments) {
 		return nil, MessageErrNotFound
 	}
@@ -147,91 +149,303 @@ func (r *MessageRepository) FindByChatAndMessageID(ctx context.Context, chatID i
 
 // Update: partial update for _id + touch UpdatedAt
 func (r *MessageRepository) Update(ctx context.Context, id primitive.ObjectID, set bson.M) error {
+	return r.updateByID(ctx, live(bson.M{"_id": id}), bson.M{"$set": set}, "update")
+}
+
+// Delete soft-deletes per _id: the message is hidden until Restore
+func (r *MessageRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	update := bson.M{"$set": bson.M{deletedAtField: time.Now().UTC()}}
+	return r.updateByID(ctx, live(bson.M{"_id": id}), update, "delete")
+}
+
+// Restore brings back a soft-deleted message (per _id)
+func (r *MessageRepository) Restore(ctx context.Context, id primitive.ObjectID) error {
+	update := bson.M{"$unset": bson.M{deletedAtField: ""}}
+	return r.updateByID(ctx, deleted(bson.M{"_id": id}), update, "restore")
+}
+
+// updateByID applies update to the message of filter (per _id), touching updatedAt, and
+// records it as op.
+func (r *MessageRepository) updateByID(ctx context.Context, filter, update bson.M, op string) error {
+	set, _ := update["$set"].(bson.M)
+	if set == nil {
+		set = bson.M{}
+		update["$set"] = set
+	}
 	set["updatedAt"] = time.Now().UTC()
-	res, err := r.col.UpdateByID(ctx, id, bson.M{"$set": set})
-	if err != nil {
-		return err
+
+	var doc struct {
+		MongoID primitive.ObjectID `bson:"_id"`
+		Chat    struct {
+			ID int64 `bson:"id"`
+		} `bson:"chat"`
 	}
-	if res.MatchedCount == 0 {
+	opts := options.FindOneAndUpdate().SetProjection(bson.M{"_id": 1, MessageFieldChatID: 1})
+	err := r.col.FindOneAndUpdate(ctx, filter, update, opts).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
 		return MessageErrNotFound
 	}
+	if err != nil {
+		return err
+	}
+	r.audit.record(ctx, change{collection: MessageCollection, op: op, documentID: doc.MongoID, chatID: doc.Chat.ID, fields: changedFields(update)})
 	return nil
 }
 
-// Delete per _id
-func (r *MessageRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
-	res, err := r.col.DeleteOne(ctx, bson.M{"_id": id})
+// DeleteMany deletes for good the messages matching f, soft-deleted ones included;
+// an empty filter is refused.
+func (r *MessageRepository) DeleteMany(ctx context.Context, f MessageFilter) (int64, error) {
+	f.IncludeDeleted = true
+	filter := messageFilter(f)
+	if len(filter) == 0 {
+		return 0, MessageErrEmptyFilter
+	}
+	res, err := r.col.DeleteMany(ctx, filter)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	if res.DeletedCount == 0 {
-		return MessageErrNotFound
+	return res.DeletedCount, nil
+}
+
+// DeleteByIDs deletes for good the messages with the given _ids, soft-deleted ones included.
+func (r *MessageRepository) DeleteByIDs(ctx context.Context, ids []primitive.ObjectID) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
 	}
-	return nil
+	res, err := r.col.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, nil
 }
 
-// Options di lista
-type MessageListOptions struct {
-	Page     int64
-	PerPage  int64
+// AnonymizeSender replaces the sender of the messages of fromID with AnonymousSender.
+func (r *MessageRepository) AnonymizeSender(ctx context.Context, fromID int64) (int64, error) {
+	res, err := r.col.UpdateMany(ctx, bson.M{"from.id": fromID}, bson.M{"$set": bson.M{
+		"from":      AnonymousSender,
+		"updatedAt": time.Now().UTC(),
+	}})
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
+
+// MoveChat rewrites the chat of the messages of fromChatID (group upgraded to the
+// supergroup toChatID). Messages whose id is already stored in toChatID are left in
+// place and counted as skipped.
+func (r *MessageRepository) MoveChat(ctx context.Context, fromChatID, toChatID int64) (moved, skipped int64, err error) {
+	set := bson.M{"$set": bson.M{
+		MessageFieldChatID: toChatID,
+		"chat.type":        models.ChatTypeSupergroup,
+		"updatedAt":        time.Now().UTC(),
+	}}
+	res, err := r.col.UpdateMany(ctx, bson.M{MessageFieldChatID: fromChatID}, set)
+	if res != nil {
+		moved = res.ModifiedCount
+	}
+	if err == nil || !mongo.IsDuplicateKeyError(err) {
+		return moved, 0, err
+	}
+
+	// a conflict stops UpdateMany: go on one message at a time
+	cur, err := r.col.Find(ctx, bson.M{MessageFieldChatID: fromChatID}, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return moved, 0, err
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		var doc struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		if err := cur.Decode(&doc); err != nil {
+			return moved, skipped, err
+		}
+		_, err := r.col.UpdateOne(ctx, bson.M{"_id": doc.ID}, set)
+		switch {
+		case err == nil:
+			moved++
+		case mongo.IsDuplicateKeyError(err):
+			skipped++
+		default:
+			return moved, skipped, err
+		}
+	}
+	return moved, skipped, cur.Err()
+}
+
+// MessageFilter selects messages (nil fields are ignored); soft-deleted ones are skipped
+// unless IncludeDeleted.
+type MessageFilter struct {
 	ChatID   *int64 // chat filter
+	ChatType *models.ChatType
 	FromID   *int64 // sender filter (Telegram user id)
 	DateFrom *int64 // unix seconds (Telegram Message.Date)
 	DateTo   *int64 // unix seconds (exclusive)
-	TextLike *string
+	TextLike *string // case-insensitive substring of the text (see Search for full text)
+	IncludeDeleted bool // soft-deleted messages too (GDPR export, retention archive)
 }
 
-// List: paginated + common filters
-func (r *MessageRepository) List(ctx context.Context, opt MessageListOptions) ([]entities.MessageEntity, int64, error) {
-	if opt.Page <= 0 {
-		opt.Page = 1
-	}
-	if opt.PerPage <= 0 || opt.PerPage > 1000 {
-		opt.PerPage = 50
-	}
+// Options di lista: newest first; pass the Next cursor of a page to get the
+// following one (keyset pagination), Page is the legacy skip-based alternative.
+type MessageListOptions struct {
+	MessageFilter
+	Page       int64
+	PerPage    int64
+	Cursor     string // Page.Next of the previous call
+	CountTotal bool   // also count the matches (an extra query)
+}
 
+func messageFilter(f MessageFilter) bson.M {
 	filter := bson.M{}
-	if opt.ChatID != nil {
-		filter["chat.id"] = *opt.ChatID
+	if f.ChatID != nil {
+		filter["chat.id"] = *f.ChatID
+	}
+	if f.ChatType != nil {
+		filter["chat.type"] = *f.ChatType
 	}
-	if opt.FromID != nil {
-		filter["from.id"] = *opt.FromID
+	if f.FromID != nil {
+		filter["from.id"] = *f.FromID
 	}
 	// range on dates (models.Message.Date is int, unix sec)
-	if opt.DateFrom != nil || opt.DateTo != nil {
+	if f.DateFrom != nil || f.DateTo != nil {
 		rg := bson.M{}
-		if opt.DateFrom != nil {
-			rg["$gte"] = *opt.DateFrom
+		if f.DateFrom != nil {
+			rg["$gte"] = *f.DateFrom
 		}
-		if opt.DateTo != nil {
-			rg["$lt"] = *opt.DateTo
+		if f.DateTo != nil {
+			rg["$lt"] = *f.DateTo
 		}
 		filter["date"] = rg
 	}
-	if opt.TextLike != nil && *opt.TextLike != "" {
-		// semplice regex case-sensitive; per i18n/case-insensitive usa collation
-		filter["text"] = bson.M{"$regex": *opt.TextLike}
+	if f.TextLike != nil && *f.TextLike != "" {
+		// literal substring, case-insensitive (the input is escaped, not a pattern)
+		filter["text"] = primitive.Regex{Pattern: regexp.QuoteMeta(*f.TextLike), Options: "i"}
 	}
+	if !f.IncludeDeleted {
+		live(filter)
+	}
+	return filter
+}
 
-	total, err := r.col.CountDocuments(ctx, filter)
-	if err != nil {
-		return nil, 0, err
+// List: paginated + common filters
+func (r *MessageRepository) List(ctx context.Context, opt MessageListOptions) (Page[entities.MessageEntity], error) {
+	page := Page[entities.MessageEntity]{Total: -1}
+	if opt.PerPage <= 0 || opt.PerPage > 1000 {
+		opt.PerPage = 50
 	}
+	filter := messageFilter(opt.MessageFilter)
 
+	if opt.CountTotal {
+		total, err := r.col.CountDocuments(ctx, filter)
+		if err != nil {
+			return page, err
+		}
+		page.Total = total
+	}
+
+	// one more than asked, to know whether there is a next page
 	findOpt := options.Find().
 		SetSort(bson.D{{Key: "date", Value: -1}, {Key: "_id", Value: -1}}).
-		SetSkip((opt.Page - 1) * opt.PerPage).
-		SetLimit(opt.PerPage)
+		SetLimit(opt.PerPage + 1)
+
+	switch {
+	case opt.Cursor != "":
+		date, id, err := decodeCursor[int](opt.Cursor)
+		if err != nil {
+			return page, err
+		}
+		filter = and(filter, afterCursor("date", date, id))
+	case opt.Page > 1:
+		findOpt.SetSkip((opt.Page - 1) * opt.PerPage)
+	}
 
 	cur, err := r.col.Find(ctx, filter, findOpt)
 	if err != nil {
-		return nil, 0, err
+		return page, err
 	}
 	defer cur.Close(ctx)
 
-	var out []entities.MessageEntity
-	if err := cur.All(ctx, &out); err != nil {
-		return nil, 0, err
+	if err := cur.All(ctx, &page.Items); err != nil {
+		return page, err
+	}
+	if int64(len(page.Items)) > opt.PerPage {
+		page.Items = page.Items[:opt.PerPage]
+		last := page.Items[len(page.Items)-1]
+		if page.Next, err = encodeCursor(last.Date, last.MongoID); err != nil {
+			return page, err
+		}
+	}
+	return page, nil
+}
+
+// Iterate streams the messages matching f (oldest first) to fn, without loading them all;
+// an error from fn stops the iteration and is returned.
+func (r *MessageRepository) Iterate(ctx context.Context, f MessageFilter, fn func(m *entities.MessageEntity) error) error {
+	findOpt := options.Find().SetSort(bson.D{{Key: "date", Value: 1}, {Key: "_id", Value: 1}})
+	cur, err := r.col.Find(ctx, messageFilter(f), findOpt)
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		var m entities.MessageEntity
+		if err := cur.Decode(&m); err != nil {
+			return err
+		}
+		if err := fn(&m); err != nil {
+			return err
+		}
+	}
+	return cur.Err()
+}
+
+// Search finds messages by text or caption, see SearchMode. Results are capped at Limit.
+func (r *MessageRepository) Search(ctx context.Context, opt MessageSearchOptions) ([]MessageHit, error) {
+	opt.TextLike = nil
+	if opt.Limit <= 0 {
+		opt.Limit = DefaultSearchLimit
+	}
+	opt.Limit = min(opt.Limit, MaxSearchLimit)
+	q := parseSearchQuery(opt.Query, opt.Mode)
+	if len(q.terms) == 0 {
+		return nil, nil
+	}
+
+	filter := messageFilter(opt.MessageFilter)
+	findOpt := options.Find().SetLimit(opt.Limit)
+
+	switch opt.Mode {
+	case SearchSubstring:
+		re := primitive.Regex{Pattern: regexp.QuoteMeta(strings.TrimSpace(opt.Query)), Options: "i"}
+		filter = and(filter, bson.M{"$or": bson.A{bson.M{"text": re}, bson.M{"caption": re}}})
+		findOpt.SetSort(bson.D{{Key: "date", Value: -1}, {Key: "_id", Value: -1}})
+	default:
+		filter["$text"] = bson.M{"$search": opt.Query}
+		findOpt.
+			SetProjection(bson.M{"score": bson.M{"$meta": "textScore"}}).
+			SetSort(bson.D{{Key: "score", Value: bson.M{"$meta": "textScore"}}, {Key: "date", Value: -1}})
+	}
+
+	cur, err := r.col.Find(ctx, filter, findOpt)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var hits []MessageHit
+	for cur.Next(ctx) {
+		var row struct {
+			entities.MessageEntity `bson:",inline"`
+			Score                  float64 `bson:"score"`
+		}
+		if err := cur.Decode(&row); err != nil {
+			return nil, err
+		}
+		hit := MessageHit{Message: row.MessageEntity, Score: row.Score}
+		hit.Snippet, hit.Matches = snippet(searchableText(&row.MessageEntity), q.terms, opt.SnippetLength)
+		hits = append(hits, hit)
 	}
-	return out, total, nil
+	return hits, cur.Err()
 }
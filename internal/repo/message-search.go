@@ -0,0 +1,218 @@
+package repo
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/frangi01/bbtelgo/internal/entities"
+)
+
+type SearchMode int
+
+const (
+	// SearchText uses the Mongo text index: whole words (case and diacritics are ignored),
+	// "quoted phrases" and -excluded words, results sorted by relevance.
+	SearchText SearchMode = iota
+	// SearchSubstring matches the query literally (case-insensitive), newest first.
+	SearchSubstring
+)
+
+const (
+	DefaultSearchLimit   = 20
+	MaxSearchLimit       = 100
+	DefaultSnippetLength = 120 // runes
+)
+
+type MessageSearchOptions struct {
+	MessageFilter // TextLike is ignored
+	Query         string
+	Mode          SearchMode
+	Limit         int64
+	SnippetLength int // 0 = DefaultSnippetLength
+}
+
+// Span is a [Start, End) byte range of a snippet.
+type Span struct {
+	Start int
+	End   int
+}
+
+type MessageHit struct {
+	Message entities.MessageEntity
+	Score   float64 // text relevance (SearchText only)
+	Snippet string  // excerpt of the text/caption around the first match
+	Matches []Span  // matched terms inside Snippet
+}
+
+// Highlight wraps the matches of the snippet with pre/post; escape (optional) is
+// applied to the snippet text only, e.g. html.EscapeString with "<b>", "</b>".
+func (h MessageHit) Highlight(pre, post string, escape func(string) string) string {
+	if escape == nil {
+		escape = func(s string) string { return s }
+	}
+	var sb strings.Builder
+	last := 0
+	for _, m := range h.Matches {
+		sb.WriteString(escape(h.Snippet[last:m.Start]))
+		sb.WriteString(pre)
+		sb.WriteString(escape(h.Snippet[m.Start:m.End]))
+		sb.WriteString(post)
+		last = m.End
+	}
+	sb.WriteString(escape(h.Snippet[last:]))
+	return sb.String()
+}
+
+// searchQuery is a parsed text query.
+type searchQuery struct {
+	terms    []string // words and phrases to highlight/match (lowercase)
+	phrases  []string // "quoted phrases" (lowercase), all required
+	excluded []string // -words (lowercase)
+}
+
+func parseSearchQuery(q string, mode SearchMode) searchQuery {
+	var sq searchQuery
+	if mode == SearchSubstring {
+		if q = strings.TrimSpace(q); q != "" {
+			sq.terms = []string{strings.ToLower(q)}
+			sq.phrases = sq.terms
+		}
+		return sq
+	}
+
+	rest := q
+	for {
+		i := strings.IndexByte(rest, '"')
+		if i < 0 {
+			break
+		}
+		j := strings.IndexByte(rest[i+1:], '"')
+		if j < 0 {
+			break
+		}
+		if phrase := strings.ToLower(strings.TrimSpace(rest[i+1 : i+1+j])); phrase != "" {
+			sq.phrases = append(sq.phrases, phrase)
+			sq.terms = append(sq.terms, phrase)
+		}
+		rest = rest[:i] + " " + rest[i+2+j:]
+	}
+	for _, w := range strings.Fields(rest) {
+		w = strings.ToLower(w)
+		if strings.HasPrefix(w, "-") {
+			if w = strings.TrimLeft(w, "-"); w != "" {
+				sq.excluded = append(sq.excluded, w)
+			}
+			continue
+		}
+		sq.terms = append(sq.terms, w)
+	}
+	return sq
+}
+
+// searchableText returns the text of the message (caption for media).
+func searchableText(m *entities.MessageEntity) string {
+	if m.Text != "" {
+		return m.Text
+	}
+	return m.Caption
+}
+
+// snippet cuts about length runes of text around the first match of the terms
+// and returns it with the matches it contains.
+func snippet(text string, terms []string, length int) (string, []Span) {
+	if length <= 0 {
+		length = DefaultSnippetLength
+	}
+	all := findTerms(text, terms)
+
+	start, end := 0, len(text)
+	if utf8.RuneCountInString(text) > length {
+		center := 0
+		if len(all) > 0 {
+			center = all[0].Start
+		}
+		// about a third of the window before the first match
+		start = moveRunes(text, center, -length/3)
+		end = moveRunes(text, start, length)
+		start = snapToSpace(text, start, -1)
+		end = snapToSpace(text, end, 1)
+	}
+
+	var prefix, suffix string
+	if start > 0 {
+		prefix = "…"
+	}
+	if end < len(text) {
+		suffix = "…"
+	}
+	out := prefix + strings.TrimSpace(text[start:end]) + suffix
+	trimmed := len(text[start:end]) - len(strings.TrimLeft(text[start:end], " \t\n"))
+	shift := len(prefix) - start - trimmed
+
+	var spans []Span
+	body := len(out) - len(suffix)
+	for _, m := range all {
+		s, e := m.Start+shift, m.End+shift
+		if s >= len(prefix) && e <= body {
+			spans = append(spans, Span{Start: s, End: e})
+		}
+	}
+	return out, spans
+}
+
+// findTerms returns the non-overlapping case-insensitive matches of the terms, in order.
+func findTerms(text string, terms []string) []Span {
+	lower := strings.ToLower(text)
+	if len(lower) != len(text) {
+		// lowercasing changed byte lengths: offsets would not map back
+		return nil
+	}
+	var spans []Span
+	for i := 0; i < len(lower); {
+		best := -1
+		for _, t := range terms {
+			if t != "" && strings.HasPrefix(lower[i:], t) && len(t) > best {
+				best = len(t)
+			}
+		}
+		if best > 0 {
+			spans = append(spans, Span{Start: i, End: i + best})
+			i += best
+			continue
+		}
+		_, size := utf8.DecodeRuneInString(lower[i:])
+		i += size
+	}
+	return spans
+}
+
+func moveRunes(s string, at, n int) int {
+	for ; n < 0 && at > 0; n++ {
+		_, size := utf8.DecodeLastRuneInString(s[:at])
+		at -= size
+	}
+	for ; n > 0 && at < len(s); n-- {
+		_, size := utf8.DecodeRuneInString(s[at:])
+		at += size
+	}
+	return at
+}
+
+// snapToSpace moves at (by at most 15 bytes in dir) to a word boundary, not to cut words.
+func snapToSpace(s string, at, dir int) int {
+	for i, pos := 0, at; i < 15 && pos > 0 && pos < len(s); i++ {
+		r, _ := utf8.DecodeRuneInString(s[pos:])
+		if unicode.IsSpace(r) {
+			return pos
+		}
+		if dir < 0 {
+			_, size := utf8.DecodeLastRuneInString(s[:pos])
+			pos -= size
+		} else {
+			_, size := utf8.DecodeRuneInString(s[pos:])
+			pos += size
+		}
+	}
+	return at
+}
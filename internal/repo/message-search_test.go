@@ -0,0 +1,84 @@
+package repo
+
+import (
+	"html"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestFindTerms(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		terms []string
+		want  []Span
+	}{
+		{"none", "hello world", []string{"bye"}, nil},
+		{"case-insensitive", "Hello HELLO", []string{"hello"}, []Span{{0, 5}, {6, 11}}},
+		{"longest term wins", "hello world", []string{"hell", "hello"}, []Span{{0, 5}}},
+		{"no overlaps", "aaaa", []string{"aa"}, []Span{{0, 2}, {2, 4}}},
+		{"multibyte before", "città hello", []string{"hello"}, []Span{{7, 12}}},
+		{"empty term skipped", "abc", []string{""}, nil},
+		{"length changing case", "İstanbul", []string{"stanbul"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := findTerms(tt.text, tt.terms); !slices.Equal(got, tt.want) {
+				t.Fatalf("findTerms(%q, %q) = %v, want %v", tt.text, tt.terms, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	long := strings.Repeat("lorem ipsum dolor ", 20) + "NEEDLE in the haystack " + strings.Repeat("sit amet ", 20)
+
+	tests := []struct {
+		name       string
+		text       string
+		terms      []string
+		length     int
+		wantText   string // "" = don't check
+		wantPrefix bool
+		wantSuffix bool
+		wantSpans  int
+	}{
+		{"short text untouched", "find the needle here", []string{"needle"}, 40, "find the needle here", false, false, 1},
+		{"cut around the match", long, []string{"needle"}, 40, "", true, true, 1},
+		{"cut at the start", "needle " + long, []string{"needle"}, 40, "", false, true, 1},
+		{"no match keeps the start", long, []string{"absent"}, 40, "", false, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, spans := snippet(tt.text, tt.terms, tt.length)
+			if tt.wantText != "" && out != tt.wantText {
+				t.Errorf("snippet = %q, want %q", out, tt.wantText)
+			}
+			if got := strings.HasPrefix(out, "…"); got != tt.wantPrefix {
+				t.Errorf("snippet %q: leading ellipsis %v, want %v", out, got, tt.wantPrefix)
+			}
+			if got := strings.HasSuffix(out, "…"); got != tt.wantSuffix {
+				t.Errorf("snippet %q: trailing ellipsis %v, want %v", out, got, tt.wantSuffix)
+			}
+			// the spans point at the terms inside the snippet
+			if len(spans) != tt.wantSpans {
+				t.Errorf("spans = %v, want %d", spans, tt.wantSpans)
+			}
+			for _, s := range spans {
+				if match := out[s.Start:s.End]; !slices.ContainsFunc(tt.terms, func(term string) bool { return strings.EqualFold(match, term) }) {
+					t.Errorf("span %v = %q, not a term", s, match)
+				}
+			}
+		})
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	text := "a <b> & hello"
+	out, spans := snippet(text, []string{"hello"}, 0)
+	hit := MessageHit{Snippet: out, Matches: spans}
+	if got, want := hit.Highlight("<b>", "</b>", html.EscapeString), "a &lt;b&gt; &amp; <b>hello</b>"; got != want {
+		t.Fatalf("Highlight = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,24 @@
+package repo
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Soft delete: Delete sets deletedAt instead of removing the document, every Find/List/
+// Iterate/Search skips it and the updates do not touch it; Restore brings it back.
+// The data is really removed only by the hard deletes (UserStore.PurgeByTelegramID,
+// MessageStore.DeleteMany and DeleteByIDs), used by the GDPR erasure and the retention sweeper.
+
+const deletedAtField = "deletedAt"
+
+// live restricts filter (changed in place) to the documents not soft-deleted.
+func live(filter bson.M) bson.M {
+	filter[deletedAtField] = bson.M{"$exists": false}
+	return filter
+}
+
+// deleted restricts filter (changed in place) to the soft-deleted documents.
+func deleted(filter bson.M) bson.M {
+	filter[deletedAtField] = bson.M{"$exists": true}
+	return filter
+}
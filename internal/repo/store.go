@@ -0,0 +1,60 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/frangi01/bbtelgo/internal/entities"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// UserStore is implemented by UserRepository (Mongo) and MemoryUserRepository.
+// Delete is a soft delete (see soft-delete.go).
+type UserStore interface {
+	Create(ctx context.Context, u *entities.UserEntity) (primitive.ObjectID, error)
+	UpsertByTelegramID(ctx context.Context, u *entities.UserEntity) (created bool, oid primitive.ObjectID, err error)
+	FindByObjectID(ctx context.Context, id primitive.ObjectID) (*entities.UserEntity, error)
+	FindByTelegramID(ctx context.Context, telegramID int64) (*entities.UserEntity, error)
+	FindByUsername(ctx context.Context, username string) (*entities.UserEntity, error)
+	Update(ctx context.Context, id primitive.ObjectID, set bson.M) error
+	SetBlocked(ctx context.Context, telegramID int64, blocked bool) error
+	SetBanned(ctx context.Context, telegramID int64, banned bool, reason string) error
+	SetLanguage(ctx context.Context, telegramID int64, lang string) error
+	AddRole(ctx context.Context, telegramID int64, role entities.Role) error
+	RemoveRole(ctx context.Context, telegramID int64, role entities.Role) error
+	SetRoles(ctx context.Context, telegramID int64, roles []entities.Role) error
+	TouchLastSeen(ctx context.Context, telegramID int64, at time.Time) error
+	SetReferralSource(ctx context.Context, telegramID int64, source string) (set bool, err error)
+	SetSetting(ctx context.Context, telegramID int64, key string, value any) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+	Restore(ctx context.Context, id primitive.ObjectID) error
+	PurgeByTelegramID(ctx context.Context, telegramID int64) error
+	List(ctx context.Context, opt ListOptions) (Page[entities.UserEntity], error)
+	Iterate(ctx context.Context, f entities.UserFilter, fn func(u *entities.UserEntity) error) error
+}
+
+// MessageStore is implemented by MessageRepository (Mongo) and MemoryMessageRepository.
+type MessageStore interface {
+	Create(ctx context.Context, m *entities.MessageEntity) (primitive.ObjectID, error)
+	UpsertByChatAndMessageID(ctx context.Context, m *entities.MessageEntity) (created bool, oid primitive.ObjectID, err error)
+	FindByObjectID(ctx context.Context, id primitive.ObjectID) (*entities.MessageEntity, error)
+	FindByChatAndMessageID(ctx context.Context, chatID int64, messageID int) (*entities.MessageEntity, error)
+	Update(ctx context.Context, id primitive.ObjectID, set bson.M) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+	Restore(ctx context.Context, id primitive.ObjectID) error
+	DeleteMany(ctx context.Context, f MessageFilter) (int64, error)
+	DeleteByIDs(ctx context.Context, ids []primitive.ObjectID) (int64, error)
+	AnonymizeSender(ctx context.Context, fromID int64) (int64, error)
+	MoveChat(ctx context.Context, fromChatID, toChatID int64) (moved, skipped int64, err error)
+	List(ctx context.Context, opt MessageListOptions) (Page[entities.MessageEntity], error)
+	Iterate(ctx context.Context, f MessageFilter, fn func(m *entities.MessageEntity) error) error
+	Search(ctx context.Context, opt MessageSearchOptions) ([]MessageHit, error)
+}
+
+var (
+	_ UserStore    = (*UserRepository)(nil)
+	_ UserStore    = (*MemoryUserRepository)(nil)
+	_ MessageStore = (*MessageRepository)(nil)
+	_ MessageStore = (*MemoryMessageRepository)(nil)
+)
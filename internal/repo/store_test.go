@@ -0,0 +1,706 @@
+package repo_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/frangi01/bbtelgo/internal/entities"
+	"github.com/frangi01/bbtelgo/internal/logx"
+	"github.com/frangi01/bbtelgo/internal/migrations"
+	"github.com/frangi01/bbtelgo/internal/repo"
+	"github.com/go-telegram/bot/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// The store tests run against the in-memory repositories and, when mongoURIEnv is set,
+// against the Mongo ones too (a fresh database with the migrations applied, dropped after).
+
+const mongoURIEnv = "BBTELGO_TEST_MONGO_URI"
+
+type testDB struct {
+	client *mongo.Client
+	name   string
+	audit  *repo.AuditRepository
+}
+
+func newTestDB(t *testing.T) *testDB {
+	t.Helper()
+	uri := os.Getenv(mongoURIEnv)
+	if uri == "" {
+		t.Skipf("%s not set", mongoURIEnv)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	logger, err := logx.New(filepath.Join(t.TempDir(), "test.log"), logx.Options{})
+	if err != nil {
+		t.Fatalf("logger: %v", err)
+	}
+	name := "bbtelgo_test_" + primitive.NewObjectID().Hex()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		_ = client.Database(name).Drop(ctx)
+		_ = client.Disconnect(ctx)
+		_ = logger.Close()
+	})
+
+	if _, err := migrations.NewRunner(client.Database(name), nil, logger, migrations.All()...).Up(ctx); err != nil {
+		t.Fatalf("migrations: %v", err)
+	}
+	return &testDB{client: client, name: name, audit: repo.NewAuditRepository(client, name, logger)}
+}
+
+func forEachUserStore(t *testing.T, fn func(t *testing.T, s repo.UserStore)) {
+	t.Run("memory", func(t *testing.T) {
+		fn(t, repo.NewMemoryUserRepository())
+	})
+	t.Run("mongo", func(t *testing.T) {
+		db := newTestDB(t)
+		fn(t, repo.NewUserRepository(db.client, db.name, db.audit))
+	})
+}
+
+func forEachMessageStore(t *testing.T, fn func(t *testing.T, s repo.MessageStore)) {
+	t.Run("memory", func(t *testing.T) {
+		fn(t, repo.NewMemoryMessageRepository())
+	})
+	t.Run("mongo", func(t *testing.T) {
+		db := newTestDB(t)
+		fn(t, repo.NewMessageRepository(db.client, db.name, db.audit))
+	})
+}
+
+func newUser(id int64, username string) *entities.UserEntity {
+	return &entities.UserEntity{User: models.User{ID: id, FirstName: "user", Username: username}}
+}
+
+func newMessage(chatID int64, id, date int, text string) *entities.MessageEntity {
+	return &entities.MessageEntity{Message: models.Message{
+		ID:   id,
+		Chat: models.Chat{ID: chatID, Type: models.ChatTypePrivate},
+		From: &models.User{ID: chatID},
+		Date: date,
+		Text: text,
+	}}
+}
+
+func mustCreateUser(t *testing.T, s repo.UserStore, u *entities.UserEntity) primitive.ObjectID {
+	t.Helper()
+	id, err := s.Create(context.Background(), u)
+	if err != nil {
+		t.Fatalf("create user %d: %v", u.ID, err)
+	}
+	return id
+}
+
+func mustCreateMessage(t *testing.T, s repo.MessageStore, m *entities.MessageEntity) primitive.ObjectID {
+	t.Helper()
+	id, err := s.Create(context.Background(), m)
+	if err != nil {
+		t.Fatalf("create message %d/%d: %v", m.Chat.ID, m.ID, err)
+	}
+	return id
+}
+
+func TestUserStoreUniqueKeys(t *testing.T) {
+	forEachUserStore(t, func(t *testing.T, s repo.UserStore) {
+		ctx := context.Background()
+		first := mustCreateUser(t, s, newUser(1, "alice"))
+		second := mustCreateUser(t, s, newUser(2, "bob"))
+
+		tests := []struct {
+			name string
+			call func() error
+		}{
+			{"create same telegram id", func() error {
+				_, err := s.Create(ctx, newUser(1, "other"))
+				return err
+			}},
+			{"create same _id", func() error {
+				u := newUser(3, "carol")
+				u.MongoID = first
+				_, err := s.Create(ctx, u)
+				return err
+			}},
+			{"update to a taken telegram id", func() error {
+				return s.Update(ctx, second, bson.M{"id": int64(1)})
+			}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if err := tt.call(); !mongo.IsDuplicateKeyError(err) {
+					t.Fatalf("err = %v, want a duplicate key error", err)
+				}
+			})
+		}
+
+		created, oid, err := s.UpsertByTelegramID(ctx, newUser(1, "alice2"))
+		if err != nil || created || oid != first {
+			t.Fatalf("upsert existing = (%v, %v, %v), want (false, %v, nil)", created, oid, err, first)
+		}
+		u, err := s.FindByTelegramID(ctx, 1)
+		if err != nil || u.Username != "alice2" {
+			t.Fatalf("after upsert: %+v, %v", u, err)
+		}
+		if created, _, err := s.UpsertByTelegramID(ctx, newUser(3, "carol")); err != nil || !created {
+			t.Fatalf("upsert new = (%v, %v), want (true, nil)", created, err)
+		}
+	})
+}
+
+func TestUserStoreNotFound(t *testing.T) {
+	forEachUserStore(t, func(t *testing.T, s repo.UserStore) {
+		ctx := context.Background()
+		live := mustCreateUser(t, s, newUser(1, "alice"))
+		missing := primitive.NewObjectID()
+
+		tests := []struct {
+			name string
+			call func() error
+		}{
+			{"find by object id", func() error { _, err := s.FindByObjectID(ctx, missing); return err }},
+			{"find by telegram id", func() error { _, err := s.FindByTelegramID(ctx, 404); return err }},
+			{"find by unknown username", func() error { _, err := s.FindByUsername(ctx, "nobody"); return err }},
+			{"find by empty username", func() error { _, err := s.FindByUsername(ctx, ""); return err }},
+			{"find by bare @", func() error { _, err := s.FindByUsername(ctx, " @ "); return err }},
+			{"update", func() error { return s.Update(ctx, missing, bson.M{"firstname": "x"}) }},
+			{"set banned", func() error { return s.SetBanned(ctx, 404, true, "") }},
+			{"set language", func() error { return s.SetLanguage(ctx, 404, "it") }},
+			{"add role", func() error { return s.AddRole(ctx, 404, entities.RoleAdmin) }},
+			{"delete", func() error { return s.Delete(ctx, missing) }},
+			{"restore a live user", func() error { return s.Restore(ctx, live) }},
+			{"purge", func() error { return s.PurgeByTelegramID(ctx, 404) }},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if err := tt.call(); !errors.Is(err, repo.UserErrNotFound) {
+					t.Fatalf("err = %v, want UserErrNotFound", err)
+				}
+			})
+		}
+	})
+}
+
+func TestUserStoreProfileFields(t *testing.T) {
+	forEachUserStore(t, func(t *testing.T, s repo.UserStore) {
+		ctx := context.Background()
+		mustCreateUser(t, s, newUser(1, "alice"))
+		seen := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+		steps := []struct {
+			name string
+			call func() error
+		}{
+			{"set language", func() error { return s.SetLanguage(ctx, 1, "it") }},
+			{"add role", func() error { return s.AddRole(ctx, 1, entities.RoleAdmin) }},
+			{"add role again", func() error { return s.AddRole(ctx, 1, entities.RoleAdmin) }},
+			{"add other role", func() error { return s.AddRole(ctx, 1, entities.RoleModerator) }},
+			{"remove role", func() error { return s.RemoveRole(ctx, 1, entities.RoleAdmin) }},
+			{"ban", func() error { return s.SetBanned(ctx, 1, true, "spam") }},
+			{"touch last seen", func() error { return s.TouchLastSeen(ctx, 1, seen) }},
+			{"touch an older last seen", func() error { return s.TouchLastSeen(ctx, 1, seen.Add(-time.Hour)) }},
+			{"set setting", func() error { return s.SetSetting(ctx, 1, "theme", "dark") }},
+		}
+		for _, st := range steps {
+			if err := st.call(); err != nil {
+				t.Fatalf("%s: %v", st.name, err)
+			}
+		}
+		if set, err := s.SetReferralSource(ctx, 1, "ads"); err != nil || !set {
+			t.Fatalf("first referral = (%v, %v), want (true, nil)", set, err)
+		}
+		if set, err := s.SetReferralSource(ctx, 1, "friend"); err != nil || set {
+			t.Fatalf("second referral = (%v, %v), want (false, nil)", set, err)
+		}
+		if err := s.SetSetting(ctx, 1, "a.b", 1); !errors.Is(err, repo.ErrInvalidSettingKey) {
+			t.Fatalf("dotted setting key: %v, want ErrInvalidSettingKey", err)
+		}
+
+		// the Telegram payload of a later update must not reset the profile
+		if _, _, err := s.UpsertByTelegramID(ctx, newUser(1, "alice2")); err != nil {
+			t.Fatalf("upsert: %v", err)
+		}
+
+		u, err := s.FindByTelegramID(ctx, 1)
+		if err != nil {
+			t.Fatalf("find: %v", err)
+		}
+		switch {
+		case u.Username != "alice2":
+			t.Errorf("username = %q, want alice2", u.Username)
+		case u.Language != "it" || u.Lang() != "it":
+			t.Errorf("language = %q, want it", u.Language)
+		case !slices.Equal(u.Roles, []entities.Role{entities.RoleModerator}):
+			t.Errorf("roles = %v, want [moderator]", u.Roles)
+		case !u.Banned || u.BannedAt == nil || u.BanReason != "spam":
+			t.Errorf("ban = %v %v %q, want banned for spam", u.Banned, u.BannedAt, u.BanReason)
+		case u.LastSeenAt == nil || !u.LastSeenAt.Equal(seen):
+			t.Errorf("last seen = %v, want %v", u.LastSeenAt, seen)
+		case u.ReferralSource != "ads":
+			t.Errorf("referral = %q, want ads", u.ReferralSource)
+		case u.Settings["theme"] != "dark":
+			t.Errorf("settings = %v, want theme=dark", u.Settings)
+		}
+
+		if err := s.SetRoles(ctx, 1, nil); err != nil {
+			t.Fatalf("set roles: %v", err)
+		}
+		if err := s.SetBanned(ctx, 1, false, ""); err != nil {
+			t.Fatalf("unban: %v", err)
+		}
+		if u, err := s.FindByTelegramID(ctx, 1); err != nil || len(u.Roles) != 0 || u.Banned || u.BanReason != "" {
+			t.Fatalf("after reset: %+v, %v", u, err)
+		}
+	})
+}
+
+func TestUserStoreFindByUsername(t *testing.T) {
+	forEachUserStore(t, func(t *testing.T, s repo.UserStore) {
+		ctx := context.Background()
+		mustCreateUser(t, s, newUser(1, "Alice"))
+		mustCreateUser(t, s, newUser(2, ""))
+
+		for _, q := range []string{"Alice", "alice", "@ALICE", " @alice "} {
+			u, err := s.FindByUsername(ctx, q)
+			if err != nil || u.ID != 1 {
+				t.Errorf("FindByUsername(%q) = %+v, %v, want user 1", q, u, err)
+			}
+		}
+	})
+}
+
+func TestUserStoreSoftDelete(t *testing.T) {
+	forEachUserStore(t, func(t *testing.T, s repo.UserStore) {
+		ctx := context.Background()
+		id := mustCreateUser(t, s, newUser(1, "alice"))
+		mustCreateUser(t, s, newUser(2, "bob"))
+
+		if err := s.Delete(ctx, id); err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+		if err := s.Delete(ctx, id); !errors.Is(err, repo.UserErrNotFound) {
+			t.Fatalf("delete again: %v, want UserErrNotFound", err)
+		}
+		if _, err := s.FindByTelegramID(ctx, 1); !errors.Is(err, repo.UserErrNotFound) {
+			t.Fatalf("find deleted: %v, want UserErrNotFound", err)
+		}
+		if _, err := s.FindByUsername(ctx, "alice"); !errors.Is(err, repo.UserErrNotFound) {
+			t.Fatalf("find deleted by username: %v, want UserErrNotFound", err)
+		}
+		if err := s.SetBanned(ctx, 1, true, ""); !errors.Is(err, repo.UserErrNotFound) {
+			t.Fatalf("ban deleted: %v, want UserErrNotFound", err)
+		}
+
+		page, err := s.List(ctx, repo.ListOptions{CountTotal: true})
+		if err != nil {
+			t.Fatalf("list: %v", err)
+		}
+		if got := userIDs(page.Items); page.Total != 1 || !slices.Equal(got, []int64{2}) {
+			t.Fatalf("list = %v (total %d), want [2] (total 1)", got, page.Total)
+		}
+		if got := iterateUsers(t, s, entities.UserFilter{}); !slices.Equal(got, []int64{2}) {
+			t.Fatalf("iterate = %v, want [2]", got)
+		}
+		if got := iterateUsers(t, s, entities.UserFilter{IncludeDeleted: true}); len(got) != 2 {
+			t.Fatalf("iterate with deleted = %v, want both users", got)
+		}
+
+		// the user writing again does not undo the deletion
+		renamed := newUser(1, "alice2")
+		if created, oid, err := s.UpsertByTelegramID(ctx, renamed); !errors.Is(err, repo.UserErrDeleted) || created || oid != id {
+			t.Fatalf("upsert deleted = %v, %v, %v, want UserErrDeleted for %v", created, oid, err, id)
+		}
+		if _, err := s.FindByTelegramID(ctx, 1); !errors.Is(err, repo.UserErrNotFound) {
+			t.Fatalf("find after upsert: %v, want UserErrNotFound", err)
+		}
+
+		if err := s.Restore(ctx, id); err != nil {
+			t.Fatalf("restore: %v", err)
+		}
+		if u, err := s.FindByTelegramID(ctx, 1); err != nil || u.DeletedAt != nil || u.Username != "alice" {
+			t.Fatalf("find restored: %+v, %v, want alice untouched by the upsert", u, err)
+		}
+	})
+}
+
+func TestUserStoreList(t *testing.T) {
+	forEachUserStore(t, func(t *testing.T, s repo.UserStore) {
+		ctx := context.Background()
+		base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+		for i, name := range []string{"a.bob", "axbob", "carol", "dave", "erin"} {
+			u := newUser(int64(i+1), name)
+			u.CreatedAt = base.Add(time.Duration(i) * time.Minute)
+			mustCreateUser(t, s, u)
+		}
+		prefix, dotted := "ax", "a.b"
+
+		tests := []struct {
+			name      string
+			opt       repo.ListOptions
+			want      []int64
+			wantTotal int64
+			wantNext  bool
+		}{
+			{"first page", repo.ListOptions{PerPage: 2}, []int64{5, 4}, -1, true},
+			{"skip page", repo.ListOptions{Page: 2, PerPage: 2}, []int64{3, 2}, -1, true},
+			{"last page", repo.ListOptions{Page: 3, PerPage: 2}, []int64{1}, -1, false},
+			{"count", repo.ListOptions{PerPage: 10, CountTotal: true}, []int64{5, 4, 3, 2, 1}, 5, false},
+			{"username prefix", repo.ListOptions{UsernamePrefix: &prefix, CountTotal: true}, []int64{2}, 1, false},
+			{"literal prefix", repo.ListOptions{UsernamePrefix: &dotted, CountTotal: true}, []int64{1}, 1, false},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				page, err := s.List(ctx, tt.opt)
+				if err != nil {
+					t.Fatalf("list: %v", err)
+				}
+				if got := userIDs(page.Items); !slices.Equal(got, tt.want) {
+					t.Errorf("items = %v, want %v", got, tt.want)
+				}
+				if page.Total != tt.wantTotal {
+					t.Errorf("total = %d, want %d", page.Total, tt.wantTotal)
+				}
+				if (page.Next != "") != tt.wantNext {
+					t.Errorf("next = %q, want a cursor: %v", page.Next, tt.wantNext)
+				}
+			})
+		}
+
+		t.Run("cursor walk", func(t *testing.T) {
+			var got []int64
+			opt := repo.ListOptions{PerPage: 2}
+			for range 5 {
+				page, err := s.List(ctx, opt)
+				if err != nil {
+					t.Fatalf("list: %v", err)
+				}
+				got = append(got, userIDs(page.Items)...)
+				if page.Next == "" {
+					break
+				}
+				opt.Cursor = page.Next
+			}
+			if want := []int64{5, 4, 3, 2, 1}; !slices.Equal(got, want) {
+				t.Fatalf("walk = %v, want %v", got, want)
+			}
+		})
+
+		t.Run("invalid cursor", func(t *testing.T) {
+			if _, err := s.List(ctx, repo.ListOptions{Cursor: "not a cursor"}); !errors.Is(err, repo.ErrInvalidCursor) {
+				t.Fatalf("err = %v, want ErrInvalidCursor", err)
+			}
+		})
+	})
+}
+
+func TestUserStoreIterate(t *testing.T) {
+	forEachUserStore(t, func(t *testing.T, s repo.UserStore) {
+		ctx := context.Background()
+		for i := int64(1); i <= 3; i++ {
+			mustCreateUser(t, s, newUser(i, fmt.Sprintf("user%d", i)))
+		}
+		if err := s.SetBlocked(ctx, 2, true); err != nil {
+			t.Fatalf("block: %v", err)
+		}
+
+		tests := []struct {
+			name string
+			f    entities.UserFilter
+			want []int64
+		}{
+			{"all but blocked", entities.UserFilter{}, []int64{1, 3}},
+			{"with blocked", entities.UserFilter{IncludeBlocked: true}, []int64{1, 2, 3}},
+			{"by telegram id", entities.UserFilter{TelegramIDs: []int64{1, 2}, IncludeBlocked: true}, []int64{1, 2}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if got := iterateUsers(t, s, tt.f); !slices.Equal(got, tt.want) {
+					t.Fatalf("iterate = %v, want %v", got, tt.want)
+				}
+			})
+		}
+
+		stop := errors.New("stop")
+		calls := 0
+		err := s.Iterate(ctx, entities.UserFilter{}, func(u *entities.UserEntity) error {
+			calls++
+			return stop
+		})
+		if !errors.Is(err, stop) || calls != 1 {
+			t.Fatalf("iterate stopped after %d calls with %v, want 1 call and the callback error", calls, err)
+		}
+	})
+}
+
+func userIDs(users []entities.UserEntity) []int64 {
+	ids := make([]int64, len(users))
+	for i, u := range users {
+		ids[i] = u.ID
+	}
+	return ids
+}
+
+func iterateUsers(t *testing.T, s repo.UserStore, f entities.UserFilter) []int64 {
+	t.Helper()
+	var ids []int64
+	err := s.Iterate(context.Background(), f, func(u *entities.UserEntity) error {
+		ids = append(ids, u.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("iterate: %v", err)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func TestMessageStoreUniqueKeys(t *testing.T) {
+	forEachMessageStore(t, func(t *testing.T, s repo.MessageStore) {
+		ctx := context.Background()
+		first := mustCreateMessage(t, s, newMessage(10, 1, 100, "hello"))
+		mustCreateMessage(t, s, newMessage(20, 1, 100, "same id, other chat"))
+
+		if _, err := s.Create(ctx, newMessage(10, 1, 200, "again")); !mongo.IsDuplicateKeyError(err) {
+			t.Fatalf("create same chat and message id: %v, want a duplicate key error", err)
+		}
+		created, oid, err := s.UpsertByChatAndMessageID(ctx, newMessage(10, 1, 100, "edited"))
+		if err != nil || created || oid != first {
+			t.Fatalf("upsert existing = (%v, %v, %v), want (false, %v, nil)", created, oid, err, first)
+		}
+		m, err := s.FindByChatAndMessageID(ctx, 10, 1)
+		if err != nil || m.Text != "edited" {
+			t.Fatalf("after upsert: %+v, %v", m, err)
+		}
+		if created, _, err := s.UpsertByChatAndMessageID(ctx, newMessage(10, 2, 100, "new")); err != nil || !created {
+			t.Fatalf("upsert new = (%v, %v), want (true, nil)", created, err)
+		}
+	})
+}
+
+func TestMessageStoreNotFound(t *testing.T) {
+	forEachMessageStore(t, func(t *testing.T, s repo.MessageStore) {
+		ctx := context.Background()
+		live := mustCreateMessage(t, s, newMessage(10, 1, 100, "hello"))
+		missing := primitive.NewObjectID()
+
+		tests := []struct {
+			name string
+			call func() error
+		}{
+			{"find by object id", func() error { _, err := s.FindByObjectID(ctx, missing); return err }},
+			{"find by chat and message id", func() error { _, err := s.FindByChatAndMessageID(ctx, 10, 404); return err }},
+			{"update", func() error { return s.Update(ctx, missing, bson.M{"text": "x"}) }},
+			{"delete", func() error { return s.Delete(ctx, missing) }},
+			{"restore a live message", func() error { return s.Restore(ctx, live) }},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if err := tt.call(); !errors.Is(err, repo.MessageErrNotFound) {
+					t.Fatalf("err = %v, want MessageErrNotFound", err)
+				}
+			})
+		}
+	})
+}
+
+func TestMessageStoreSoftDelete(t *testing.T) {
+	forEachMessageStore(t, func(t *testing.T, s repo.MessageStore) {
+		ctx := context.Background()
+		id := mustCreateMessage(t, s, newMessage(10, 1, 100, "hello"))
+		mustCreateMessage(t, s, newMessage(10, 2, 200, "world"))
+
+		if err := s.Delete(ctx, id); err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+		if _, err := s.FindByObjectID(ctx, id); !errors.Is(err, repo.MessageErrNotFound) {
+			t.Fatalf("find deleted: %v, want MessageErrNotFound", err)
+		}
+
+		chat := int64(10)
+		tests := []struct {
+			name string
+			f    repo.MessageFilter
+			want []int
+		}{
+			{"live only", repo.MessageFilter{ChatID: &chat}, []int{2}},
+			{"with deleted", repo.MessageFilter{ChatID: &chat, IncludeDeleted: true}, []int{2, 1}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				page, err := s.List(ctx, repo.MessageListOptions{MessageFilter: tt.f})
+				if err != nil {
+					t.Fatalf("list: %v", err)
+				}
+				if got := messageIDs(page.Items); !slices.Equal(got, tt.want) {
+					t.Fatalf("list = %v, want %v", got, tt.want)
+				}
+			})
+		}
+
+		if err := s.Restore(ctx, id); err != nil {
+			t.Fatalf("restore: %v", err)
+		}
+		if _, err := s.FindByChatAndMessageID(ctx, 10, 1); err != nil {
+			t.Fatalf("find restored: %v", err)
+		}
+	})
+}
+
+func TestMessageStoreDeleteByIDs(t *testing.T) {
+	forEachMessageStore(t, func(t *testing.T, s repo.MessageStore) {
+		ctx := context.Background()
+		first := mustCreateMessage(t, s, newMessage(10, 1, 100, "first"))
+		second := mustCreateMessage(t, s, newMessage(10, 2, 200, "second"))
+		mustCreateMessage(t, s, newMessage(10, 3, 300, "kept"))
+
+		n, err := s.DeleteByIDs(ctx, []primitive.ObjectID{first, second, primitive.NewObjectID()})
+		if err != nil || n != 2 {
+			t.Fatalf("DeleteByIDs = %d, %v, want 2", n, err)
+		}
+		if _, err := s.FindByObjectID(ctx, first); !errors.Is(err, repo.MessageErrNotFound) {
+			t.Fatalf("deleted message: %v, want MessageErrNotFound", err)
+		}
+		if _, err := s.FindByChatAndMessageID(ctx, 10, 3); err != nil {
+			t.Fatalf("kept message: %v", err)
+		}
+		if n, err := s.DeleteByIDs(ctx, nil); err != nil || n != 0 {
+			t.Fatalf("DeleteByIDs(nil) = %d, %v, want 0", n, err)
+		}
+	})
+}
+
+func TestMessageStoreList(t *testing.T) {
+	forEachMessageStore(t, func(t *testing.T, s repo.MessageStore) {
+		ctx := context.Background()
+		for i := 1; i <= 5; i++ {
+			mustCreateMessage(t, s, newMessage(10, i, 1000+i, fmt.Sprintf("message %d", i)))
+		}
+		mustCreateMessage(t, s, newMessage(20, 1, 2000, "other chat"))
+		chat := int64(10)
+		from, to := int64(1002), int64(1005)
+
+		tests := []struct {
+			name      string
+			opt       repo.MessageListOptions
+			want      []int
+			wantTotal int64
+		}{
+			{"first page", repo.MessageListOptions{MessageFilter: repo.MessageFilter{ChatID: &chat}, PerPage: 2}, []int{5, 4}, -1},
+			{"skip page", repo.MessageListOptions{MessageFilter: repo.MessageFilter{ChatID: &chat}, Page: 3, PerPage: 2}, []int{1}, -1},
+			{"date range", repo.MessageListOptions{MessageFilter: repo.MessageFilter{ChatID: &chat, DateFrom: &from, DateTo: &to}, CountTotal: true}, []int{4, 3, 2}, 3},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				page, err := s.List(ctx, tt.opt)
+				if err != nil {
+					t.Fatalf("list: %v", err)
+				}
+				if got := messageIDs(page.Items); !slices.Equal(got, tt.want) {
+					t.Errorf("items = %v, want %v", got, tt.want)
+				}
+				if page.Total != tt.wantTotal {
+					t.Errorf("total = %d, want %d", page.Total, tt.wantTotal)
+				}
+			})
+		}
+
+		t.Run("cursor walk", func(t *testing.T) {
+			var got []int
+			opt := repo.MessageListOptions{MessageFilter: repo.MessageFilter{ChatID: &chat}, PerPage: 2}
+			for range 5 {
+				page, err := s.List(ctx, opt)
+				if err != nil {
+					t.Fatalf("list: %v", err)
+				}
+				got = append(got, messageIDs(page.Items)...)
+				if page.Next == "" {
+					break
+				}
+				opt.Cursor = page.Next
+			}
+			if want := []int{5, 4, 3, 2, 1}; !slices.Equal(got, want) {
+				t.Fatalf("walk = %v, want %v", got, want)
+			}
+		})
+
+		t.Run("iterate", func(t *testing.T) {
+			var got []int
+			err := s.Iterate(ctx, repo.MessageFilter{ChatID: &chat, DateFrom: &from}, func(m *entities.MessageEntity) error {
+				got = append(got, m.ID)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("iterate: %v", err)
+			}
+			slices.Sort(got)
+			if want := []int{2, 3, 4, 5}; !slices.Equal(got, want) {
+				t.Fatalf("iterate = %v, want %v", got, want)
+			}
+		})
+	})
+}
+
+func TestMessageStoreSearch(t *testing.T) {
+	forEachMessageStore(t, func(t *testing.T, s repo.MessageStore) {
+		ctx := context.Background()
+		mustCreateMessage(t, s, newMessage(10, 1, 100, "hello world"))
+		mustCreateMessage(t, s, newMessage(10, 2, 200, "goodbye world"))
+		mustCreateMessage(t, s, newMessage(10, 3, 300, "hello there"))
+		mustCreateMessage(t, s, newMessage(20, 1, 400, "hello from another chat"))
+		chat := int64(10)
+
+		tests := []struct {
+			name  string
+			query string
+			mode  repo.SearchMode
+			want  []int
+		}{
+			{"word", "hello", repo.SearchText, []int{1, 3}},
+			{"excluded word", "world -goodbye", repo.SearchText, []int{1}},
+			{"phrase", `"goodbye world"`, repo.SearchText, []int{2}},
+			{"substring", "LO WOR", repo.SearchSubstring, []int{1}},
+			{"empty query", "  ", repo.SearchText, nil},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				hits, err := s.Search(ctx, repo.MessageSearchOptions{MessageFilter: repo.MessageFilter{ChatID: &chat}, Query: tt.query, Mode: tt.mode})
+				if err != nil {
+					t.Fatalf("search: %v", err)
+				}
+				var got []int
+				for _, h := range hits {
+					got = append(got, h.Message.ID)
+					if len(h.Matches) == 0 {
+						t.Errorf("message %d: no match in snippet %q", h.Message.ID, h.Snippet)
+					}
+				}
+				slices.Sort(got)
+				if !slices.Equal(got, tt.want) {
+					t.Fatalf("hits = %v, want %v", got, tt.want)
+				}
+			})
+		}
+	})
+}
+
+func messageIDs(messages []entities.MessageEntity) []int {
+	ids := make([]int, len(messages))
+	for i, m := range messages {
+		ids[i] = m.ID
+	}
+	return ids
+}
@@ -3,6 +3,8 @@ package repo
 import (
 	"context"
 	"errors"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/frangi01/bbtelgo/internal/entities"
@@ -13,33 +15,27 @@ import (
 )
 
 
-var UserErrNotFound = errors.New("user not found")
+var (
+	UserErrNotFound = errors.New("user not found")
+	UserErrDeleted  = errors.New("user deleted") // soft-deleted: only Restore brings them back
+)
+
+const UserCollection = "users"
 
+// UserRepository records the changes of the users in the audit log (AuditCollection),
+// attributed to the actor of the context (see WithActor); last-seen updates are not recorded.
 type UserRepository struct {
-	col *mongo.Collection
-}
-
-func NewUserRepository(client *mongo.Client, dbName string) (*UserRepository, error) {
-	col := client.Database(dbName).Collection("users")
-
-	// Unique index on Telegram ID (field "id" in the BSON doc)
-	_, err := col.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
-		{
-			Keys:    bson.D{{Key: "id", Value: 1}},
-			Options: options.Index().SetUnique(true).SetName("uniq_telegram_id"),
-		},
-		// Optional: index on username (not unique: it can change)
-		{
-			Keys: bson.D{{Key: "username", Value: 1}},
-			Options: options.Index().
-				SetName("idx_username").
-				SetSparse(true),
-		},
-	})
-	if err != nil {
-		return nil, err
+	col   *mongo.Collection
+	audit *AuditRepository
+}
+
+// NewUserRepository: indexes are created by the migrations (internal/migrations);
+// audit nil = changes not recorded.
+func NewUserRepository(client *mongo.Client, dbName string, audit *AuditRepository) *UserRepository {
+	return &UserRepository{
+		col:   client.Database(dbName).Collection(UserCollection),
+		audit: audit,
 	}
-	return &UserRepository{col: col}, nil
 }
 
 // Create: insert document complete; if you want to prevent duplicates, use UpsertByTelegramID
@@ -61,26 +57,13 @@ func (r *UserRepository) Create(ctx context.Context, u *entities.UserEntity) (pr
 	return oid, nil
 }
 
-// UpsertByTelegramID: create/update from the Telegram payload (Telegram ID is the key)
+// UpsertByTelegramID: create/update from the Telegram payload (Telegram ID is the key).
+// The profile fields of u (entities.ProfileFields) are only used when the user is created;
+// a soft-deleted user is left as is and UserErrDeleted is returned with their _id.
 func (r *UserRepository) UpsertByTelegramID(ctx context.Context, u *entities.UserEntity) (created bool, oid primitive.ObjectID, err error) {
 	now := time.Now().UTC()
 
-	// $set with the entire Telegram struct inline; setOnInsert for _id/createdAt
-	update := bson.M{
-		"$set": bson.M{
-			// Inline all Telegram fields (the driver will encode the fields at the root)
-			// Passing 'u' directly is fine: driver encoding -> root keys.
-			// If you want to be more explicit: replace with a bson.D and map the fields.
-		},
-		"$setOnInsert": bson.M{
-			"_id":       primitive.NewObjectID(),
-			"createdAt": now,
-		},
-	}
-
-	// WARNING: to use $set with a struct at the root, use bson.Raw from Marshal or use $replaceRoot in an aggregation.
-	//  The simple and safe way is: serialize it yourself into a document and then merge it into the keys of $set:
-
+	// We serialize the entire struct, then move the fields handled separately
 	raw, err := bson.Marshal(u)
 	if err != nil {
 		return false, primitive.NilObjectID, err
@@ -91,40 +74,54 @@ func (r *UserRepository) UpsertByTelegramID(ctx context.Context, u *entities.Use
 	}
 	delete(setDoc, "_id")
 	delete(setDoc, "createdAt")
-	
+	delete(setDoc, deletedAtField)
 	setDoc["updatedAt"] = now
-	update["$set"] = setDoc
-
-	
 
-	opts := options.Update().SetUpsert(true)
-	res, err := r.col.UpdateOne(ctx, bson.M{"id": u.ID}, update, opts)
-	if err != nil {
-		// duplicate key -> could indicate a collision on username if you make it unique; here we rethrow the error
-		return false, primitive.NilObjectID, err
+	insertID := primitive.NewObjectID()
+	onInsert := bson.M{
+		"_id":       insertID,
+		"createdAt": now,
 	}
-
-	// If inserted anew, UpsertedID is populated
-	if res.UpsertedID != nil {
-		if id, ok := res.UpsertedID.(primitive.ObjectID); ok {
-			return true, id, nil
+	for _, k := range entities.ProfileFields {
+		if v, ok := setDoc[k]; ok {
+			onInsert[k] = v
+			delete(setDoc, k)
 		}
 	}
 
-	// Otherwise it was update: retrieve _id
-	var doc struct {
+	update := bson.M{
+		"$set":         setDoc,
+		"$setOnInsert": onInsert,
+	}
+
+	// the document before the update: none if inserted anew
+	var before struct {
 		MongoID primitive.ObjectID `bson:"_id"`
 	}
-	if err := r.col.FindOne(ctx, bson.M{"id": u.ID}, options.FindOne().SetProjection(bson.M{"_id": 1})).Decode(&doc); err != nil {
+	opts := options.FindOneAndUpdate().
+		SetUpsert(true).
+		SetReturnDocument(options.Before).
+		SetProjection(bson.M{"_id": 1})
+	err = r.col.FindOneAndUpdate(ctx, live(bson.M{"id": u.ID}), update, opts).Decode(&before)
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return true, insertID, nil
+	case mongo.IsDuplicateKeyError(err):
+		// the live filter missed a soft-deleted user: the insert hit the unique Telegram ID
+		if derr := r.col.FindOne(ctx, deleted(bson.M{"id": u.ID}), options.FindOne().SetProjection(bson.M{"_id": 1})).Decode(&before); derr == nil {
+			return false, before.MongoID, UserErrDeleted
+		}
+		return false, primitive.NilObjectID, err
+	case err != nil:
 		return false, primitive.NilObjectID, err
 	}
-	return false, doc.MongoID, nil
+	return false, before.MongoID, nil
 }
 
 // FindByObjectID
 func (r *UserRepository) FindByObjectID(ctx context.Context, id primitive.ObjectID) (*entities.UserEntity, error) {
 	var u entities.UserEntity
-	err := r.col.FindOne(ctx, bson.M{"_id": id}).Decode(&u)
+	err := r.col.FindOne(ctx, live(bson.M{"_id": id})).Decode(&u)
 	if errors.Is(err, mongo.ErrNoDocuments) {
 		return nil, UserErrNotFound
 	}
@@ -134,17 +131,25 @@ func (r *UserRepository) FindByObjectID(ctx context.Context, id primitive.Object
 // FindByTelegramID
 func (r *UserRepository) FindByTelegramID(ctx context.Context, telegramID int64) (*entities.UserEntity, error) {
 	var u entities.UserEntity
-	err := r.col.FindOne(ctx, bson.M{"id": telegramID}).Decode(&u)
+	err := r.col.FindOne(ctx, live(bson.M{"id": telegramID})).Decode(&u)
 	if errors.Is(err, mongo.ErrNoDocuments) {
 		return nil, UserErrNotFound
 	}
 	return &u, err
 }
 
-// FindByUsername (default case-sensitive; for case-insensitive use collation)
+// usernameCollation makes username lookups case-insensitive, as Telegram usernames are
+// (strength 2 ignores case only; it must match the collation of idx_username_ci).
+var usernameCollation = &options.Collation{Locale: "en", Strength: 2}
+
+// FindByUsername (case-insensitive, with or without the leading "@")
 func (r *UserRepository) FindByUsername(ctx context.Context, username string) (*entities.UserEntity, error) {
 	var u entities.UserEntity
-	err := r.col.FindOne(ctx, bson.M{"username": username}).Decode(&u)
+	username = strings.TrimPrefix(strings.TrimSpace(username), "@")
+	if username == "" {
+		return nil, UserErrNotFound
+	}
+	err := r.col.FindOne(ctx, live(bson.M{"username": username}), options.FindOne().SetCollation(usernameCollation)).Decode(&u)
 	if errors.Is(err, mongo.ErrNoDocuments) {
 		return nil, UserErrNotFound
 	}
@@ -153,67 +158,310 @@ func (r *UserRepository) FindByUsername(ctx context.Context, username string) (*
 
 // Update partial (by _id) with $set and touch UpdatedAt
 func (r *UserRepository) Update(ctx context.Context, id primitive.ObjectID, set bson.M) error {
+	return r.updateByID(ctx, live(bson.M{"_id": id}), bson.M{"$set": set}, "update")
+}
+
+// updateByID applies update to the user of filter (by _id), touching updatedAt, and
+// records it as op.
+func (r *UserRepository) updateByID(ctx context.Context, filter, update bson.M, op string) error {
+	set, _ := update["$set"].(bson.M)
+	if set == nil {
+		set = bson.M{}
+		update["$set"] = set
+	}
 	set["updatedAt"] = time.Now().UTC()
-	res, err := r.col.UpdateByID(ctx, id, bson.M{"$set": set})
+
+	var doc struct {
+		MongoID primitive.ObjectID `bson:"_id"`
+		ID      int64              `bson:"id"`
+	}
+	opts := options.FindOneAndUpdate().SetProjection(bson.M{"_id": 1, "id": 1})
+	err := r.col.FindOneAndUpdate(ctx, filter, update, opts).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return UserErrNotFound
+	}
 	if err != nil {
 		return err
 	}
-	if res.MatchedCount == 0 {
+	r.audit.record(ctx, change{collection: UserCollection, op: op, documentID: doc.MongoID, targetID: doc.ID, fields: changedFields(update)})
+	return nil
+}
+
+// updateByTelegramID applies update to the user with the Telegram ID, touching updatedAt,
+// and records the change.
+func (r *UserRepository) updateByTelegramID(ctx context.Context, telegramID int64, filter, update bson.M) (matched bool, err error) {
+	if filter == nil {
+		filter = bson.M{}
+	}
+	filter["id"] = telegramID
+	set, _ := update["$set"].(bson.M)
+	if set == nil {
+		set = bson.M{}
+		update["$set"] = set
+	}
+	set["updatedAt"] = time.Now().UTC()
+
+	var doc struct {
+		MongoID primitive.ObjectID `bson:"_id"`
+	}
+	opts := options.FindOneAndUpdate().SetProjection(bson.M{"_id": 1})
+	err = r.col.FindOneAndUpdate(ctx, live(filter), update, opts).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	r.audit.record(ctx, change{collection: UserCollection, op: "update", documentID: doc.MongoID, targetID: telegramID, fields: changedFields(update)})
+	return true, nil
+}
+
+// notFound turns a missed update into UserErrNotFound
+func notFound(matched bool, err error) error {
+	if err == nil && !matched {
 		return UserErrNotFound
 	}
-	return nil
+	return err
 }
 
-// Delete (by _id)
-func (r *UserRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
-	res, err := r.col.DeleteOne(ctx, bson.M{"_id": id})
+// SetBlocked flags (or clears) a user that blocked the bot, by Telegram ID
+func (r *UserRepository) SetBlocked(ctx context.Context, telegramID int64, blocked bool) error {
+	update := bson.M{"$unset": bson.M{"blocked": "", "blockedAt": ""}}
+	if blocked {
+		update = bson.M{"$set": bson.M{"blocked": true, "blockedAt": time.Now().UTC()}}
+	}
+	return notFound(r.updateByTelegramID(ctx, telegramID, nil, update))
+}
+
+// SetBanned bans (with an optional reason) or unbans a user
+func (r *UserRepository) SetBanned(ctx context.Context, telegramID int64, banned bool, reason string) error {
+	update := bson.M{"$unset": bson.M{"banned": "", "bannedAt": "", "banReason": ""}}
+	if banned {
+		set := bson.M{"banned": true, "bannedAt": time.Now().UTC()}
+		update = bson.M{"$set": set}
+		if reason != "" {
+			set["banReason"] = reason
+		} else {
+			update["$unset"] = bson.M{"banReason": ""}
+		}
+	}
+	return notFound(r.updateByTelegramID(ctx, telegramID, nil, update))
+}
+
+// SetLanguage sets the preferred language ("" goes back to the Telegram one)
+func (r *UserRepository) SetLanguage(ctx context.Context, telegramID int64, lang string) error {
+	update := bson.M{"$unset": bson.M{"language": ""}}
+	if lang != "" {
+		update = bson.M{"$set": bson.M{"language": lang}}
+	}
+	return notFound(r.updateByTelegramID(ctx, telegramID, nil, update))
+}
+
+// AddRole grants a role (no-op if already granted)
+func (r *UserRepository) AddRole(ctx context.Context, telegramID int64, role entities.Role) error {
+	return notFound(r.updateByTelegramID(ctx, telegramID, nil, bson.M{"$addToSet": bson.M{"roles": role}}))
+}
+
+// RemoveRole revokes a role (no-op if not granted)
+func (r *UserRepository) RemoveRole(ctx context.Context, telegramID int64, role entities.Role) error {
+	return notFound(r.updateByTelegramID(ctx, telegramID, nil, bson.M{"$pull": bson.M{"roles": role}}))
+}
+
+// SetRoles replaces all the roles
+func (r *UserRepository) SetRoles(ctx context.Context, telegramID int64, roles []entities.Role) error {
+	update := bson.M{"$unset": bson.M{"roles": ""}}
+	if len(roles) > 0 {
+		update = bson.M{"$set": bson.M{"roles": roles}}
+	}
+	return notFound(r.updateByTelegramID(ctx, telegramID, nil, update))
+}
+
+// TouchLastSeen records activity at "at" (never moving it back in time); an active
+// user has evidently unblocked the bot, so the blocked flag is cleared.
+// It is activity rather than a change, so it is not audited.
+func (r *UserRepository) TouchLastSeen(ctx context.Context, telegramID int64, at time.Time) error {
+	update := bson.M{
+		"$max":   bson.M{"lastSeenAt": at.UTC()},
+		"$unset": bson.M{"blocked": "", "blockedAt": ""},
+		"$set":   bson.M{"updatedAt": time.Now().UTC()},
+	}
+	res, err := r.col.UpdateOne(ctx, live(bson.M{"id": telegramID}), update)
 	if err != nil {
 		return err
 	}
-	if res.DeletedCount == 0 {
+	return notFound(res.MatchedCount == 1, nil)
+}
+
+// SetReferralSource stores where the user came from, only if not already known;
+// set=false means it was already recorded.
+func (r *UserRepository) SetReferralSource(ctx context.Context, telegramID int64, source string) (set bool, err error) {
+	if source == "" {
+		return false, nil
+	}
+	filter := bson.M{"referralSource": bson.M{"$exists": false}}
+	matched, err := r.updateByTelegramID(ctx, telegramID, filter, bson.M{"$set": bson.M{"referralSource": source}})
+	if err != nil || matched {
+		return matched, err
+	}
+	if _, err := r.FindByTelegramID(ctx, telegramID); err != nil {
+		return false, err
+	}
+	return false, nil
+}
+
+// SetSetting stores one setting (value nil removes it)
+func (r *UserRepository) SetSetting(ctx context.Context, telegramID int64, key string, value any) error {
+	if err := validSettingKey(key); err != nil {
+		return err
+	}
+	update := bson.M{"$unset": bson.M{"settings." + key: ""}}
+	if value != nil {
+		update = bson.M{"$set": bson.M{"settings." + key: value}}
+	}
+	return notFound(r.updateByTelegramID(ctx, telegramID, nil, update))
+}
+
+var ErrInvalidSettingKey = errors.New("invalid setting key")
+
+// validSettingKey rejects keys that Mongo would read as paths or operators
+func validSettingKey(key string) error {
+	if key == "" || strings.ContainsAny(key, ".$") {
+		return ErrInvalidSettingKey
+	}
+	return nil
+}
+
+// Delete soft-deletes (by _id): the user is hidden until Restore
+func (r *UserRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	update := bson.M{"$set": bson.M{deletedAtField: time.Now().UTC()}}
+	return r.updateByID(ctx, live(bson.M{"_id": id}), update, "delete")
+}
+
+// Restore brings back a soft-deleted user (by _id)
+func (r *UserRepository) Restore(ctx context.Context, id primitive.ObjectID) error {
+	update := bson.M{"$unset": bson.M{deletedAtField: ""}}
+	return r.updateByID(ctx, deleted(bson.M{"_id": id}), update, "restore")
+}
+
+// PurgeByTelegramID removes the user for good, soft-deleted or not (GDPR erasure)
+func (r *UserRepository) PurgeByTelegramID(ctx context.Context, telegramID int64) error {
+	var doc struct {
+		MongoID primitive.ObjectID `bson:"_id"`
+	}
+	opts := options.FindOneAndDelete().SetProjection(bson.M{"_id": 1})
+	err := r.col.FindOneAndDelete(ctx, bson.M{"id": telegramID}, opts).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
 		return UserErrNotFound
 	}
+	if err != nil {
+		return err
+	}
+	r.audit.record(ctx, change{collection: UserCollection, op: "purge", documentID: doc.MongoID, targetID: telegramID})
 	return nil
 }
 
-// List with filters
+// List with filters, newest first.
+// Pass the Next cursor of a page to get the following one (keyset pagination);
+// Page is the legacy skip-based alternative and gets slow on deep pages.
 type ListOptions struct {
 	Page          int64
 	PerPage       int64
-	UsernamePrefix *string // es. autocompletion
+	UsernamePrefix *string // es. autocompletion, matched literally
+	Cursor        string  // Page.Next of the previous call
+	CountTotal    bool    // also count the matches (an extra query)
 }
 
-func (r *UserRepository) List(ctx context.Context, opt ListOptions) ([]entities.UserEntity, int64, error) {
-	if opt.Page <= 0 {
-		opt.Page = 1
-	}
+func (r *UserRepository) List(ctx context.Context, opt ListOptions) (Page[entities.UserEntity], error) {
+	page := Page[entities.UserEntity]{Total: -1}
 	if opt.PerPage <= 0 || opt.PerPage > 1000 {
 		opt.PerPage = 20
 	}
-	filter := bson.M{}
+	filter := live(bson.M{})
 	if opt.UsernamePrefix != nil && *opt.UsernamePrefix != "" {
-		filter["username"] = bson.M{"$regex": "^" + *opt.UsernamePrefix}
+		filter["username"] = bson.M{"$regex": "^" + regexp.QuoteMeta(*opt.UsernamePrefix)}
 	}
 
-	total, err := r.col.CountDocuments(ctx, filter)
-	if err != nil {
-		return nil, 0, err
+	if opt.CountTotal {
+		total, err := r.col.CountDocuments(ctx, filter)
+		if err != nil {
+			return page, err
+		}
+		page.Total = total
 	}
 
+	// one more than asked, to know whether there is a next page
 	findOpt := options.Find().
-		SetSort(bson.D{{Key: "createdAt", Value: -1}}).
-		SetSkip((opt.Page - 1) * opt.PerPage).
-		SetLimit(opt.PerPage)
+		SetSort(bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(opt.PerPage + 1)
+
+	switch {
+	case opt.Cursor != "":
+		createdAt, id, err := decodeCursor[time.Time](opt.Cursor)
+		if err != nil {
+			return page, err
+		}
+		filter = and(filter, afterCursor("createdAt", createdAt, id))
+	case opt.Page > 1:
+		findOpt.SetSkip((opt.Page - 1) * opt.PerPage)
+	}
 
 	cur, err := r.col.Find(ctx, filter, findOpt)
 	if err != nil {
-		return nil, 0, err
+		return page, err
 	}
 	defer cur.Close(ctx)
 
-	var out []entities.UserEntity
-	if err := cur.All(ctx, &out); err != nil {
-		return nil, 0, err
+	if err := cur.All(ctx, &page.Items); err != nil {
+		return page, err
+	}
+	if int64(len(page.Items)) > opt.PerPage {
+		page.Items = page.Items[:opt.PerPage]
+		last := page.Items[len(page.Items)-1]
+		if page.Next, err = encodeCursor(last.CreatedAt, last.MongoID); err != nil {
+			return page, err
+		}
 	}
-	return out, total, nil
-}
\ No newline at end of file
+	return page, nil
+}
+
+// Iterate streams the users matching f (in _id order) to fn, without loading them all;
+// an error from fn stops the iteration and is returned.
+func (r *UserRepository) Iterate(ctx context.Context, f entities.UserFilter, fn func(u *entities.UserEntity) error) error {
+	cur, err := r.col.Find(ctx, userFilter(f), options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		var u entities.UserEntity
+		if err := cur.Decode(&u); err != nil {
+			return err
+		}
+		if err := fn(&u); err != nil {
+			return err
+		}
+	}
+	return cur.Err()
+}
+
+func userFilter(f entities.UserFilter) bson.M {
+	filter := bson.M{}
+	if len(f.LanguageCodes) > 0 {
+		// the preferred language wins over the Telegram one
+		filter["$or"] = bson.A{
+			bson.M{"language": bson.M{"$in": f.LanguageCodes}},
+			bson.M{"language": bson.M{"$exists": false}, "languagecode": bson.M{"$in": f.LanguageCodes}},
+		}
+	}
+	if len(f.TelegramIDs) > 0 {
+		filter["id"] = bson.M{"$in": f.TelegramIDs}
+	}
+	if !f.IncludeBlocked {
+		filter["blocked"] = bson.M{"$ne": true}
+	}
+	if !f.IncludeDeleted {
+		live(filter)
+	}
+	return filter
+}
@@ -0,0 +1,248 @@
+package retention
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/frangi01/bbtelgo/internal/config"
+	"github.com/frangi01/bbtelgo/internal/db"
+	"github.com/frangi01/bbtelgo/internal/entities"
+	"github.com/frangi01/bbtelgo/internal/logx"
+	"github.com/frangi01/bbtelgo/internal/repo"
+	"github.com/go-telegram/bot/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	DefaultInterval = time.Hour
+
+	lockKey     = "retention:lock"
+	lockTTL     = 5 * time.Minute // extended after every batch
+	deleteBatch = 500
+)
+
+var ErrLockLost = errors.New("retention: lock lost")
+
+// Sweeper deletes the messages older than the retention policy of their chat type,
+// archiving them first when an archive directory is configured.
+// A background sweeper rather than TTL indexes: Mongo would delete without archiving,
+// and a TTL index cannot depend on the chat type.
+type Sweeper struct {
+	messages repo.MessageStore
+	cache    *db.CacheClient
+	logger   *logx.Logger
+	cfg      config.RetentionCfg
+	instance string
+}
+
+// New: cache is optional (without it a single instance is assumed).
+func New(messages repo.MessageStore, cache *db.CacheClient, logger *logx.Logger, cfg config.RetentionCfg) *Sweeper {
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultInterval
+	}
+	buf := make([]byte, 8)
+	_, _ = rand.Read(buf)
+	return &Sweeper{messages: messages, cache: cache, logger: logger, cfg: cfg, instance: hex.EncodeToString(buf)}
+}
+
+// Run sweeps every Interval until ctx is done.
+func (s *Sweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.Sweep(ctx); err != nil && ctx.Err() == nil {
+			s.logger.Errorf("retention: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Result of the sweep of one chat type.
+type Result struct {
+	ChatType models.ChatType
+	Before   time.Time // messages dated before it were swept
+	Archive  string    // archive file ("" = not archived or nothing to archive)
+	Archived int64
+	Deleted  int64
+}
+
+// Sweep applies every policy once; with Redis only one replica sweeps at a time
+// (the others return no results).
+func (s *Sweeper) Sweep(ctx context.Context) ([]Result, error) {
+	if s.cache != nil {
+		ok, err := s.cache.AcquireLock(ctx, lockKey, s.instance, lockTTL)
+		if err != nil || !ok {
+			return nil, err
+		}
+		defer func() {
+			if _, err := s.cache.ReleaseLock(context.Background(), lockKey, s.instance); err != nil {
+				s.logger.Errorf("retention: release lock: %v", err)
+			}
+		}()
+	}
+
+	chatTypes := make([]string, 0, len(s.cfg.Policies))
+	for t := range s.cfg.Policies {
+		chatTypes = append(chatTypes, t)
+	}
+	sort.Strings(chatTypes)
+
+	now := time.Now().UTC()
+	var results []Result
+	for _, t := range chatTypes {
+		res, err := s.sweep(ctx, models.ChatType(t), now.Add(-s.cfg.Policies[t]))
+		if err != nil {
+			return results, fmt.Errorf("sweep %s: %w", t, err)
+		}
+		if res.Deleted > 0 {
+			s.logger.Infof("retention: %s: %d messages before %s deleted (archive %q)", t, res.Deleted, res.Before.Format(time.RFC3339), res.Archive)
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+func (s *Sweeper) sweep(ctx context.Context, chatType models.ChatType, before time.Time) (res Result, err error) {
+	res = Result{ChatType: chatType, Before: before}
+	dateTo := before.Unix()
+	// soft-deleted messages too: DeleteByIDs removes them as well
+	filter := repo.MessageFilter{ChatType: &chatType, DateTo: &dateTo, IncludeDeleted: true}
+
+	var archive *archiveFile
+	if s.cfg.ArchiveDir != "" {
+		if archive, err = s.createArchive(chatType, before); err != nil {
+			return res, err
+		}
+		res.Archive = archive.path
+		defer func() {
+			if cerr := archive.close(res.Archived == 0); cerr != nil && err == nil {
+				err = cerr
+			}
+			if res.Archived == 0 {
+				res.Archive = ""
+			}
+		}()
+	}
+
+	// only the _ids read (and archived) are deleted, so a message arriving meanwhile
+	// is never deleted without being archived
+	ids := make([]primitive.ObjectID, 0, deleteBatch)
+	flush := func() error {
+		if len(ids) == 0 {
+			return nil
+		}
+		// the batch must be on disk before it is deleted
+		if archive != nil {
+			if err := archive.sync(); err != nil {
+				return err
+			}
+		}
+		n, err := s.messages.DeleteByIDs(ctx, ids)
+		res.Deleted += n
+		ids = ids[:0]
+		if err != nil {
+			return err
+		}
+		return s.extendLock(ctx)
+	}
+	err = s.messages.Iterate(ctx, filter, func(m *entities.MessageEntity) error {
+		if archive != nil {
+			if err := archive.enc.Encode(m); err != nil {
+				return fmt.Errorf("archive %s: %w", archive.path, err)
+			}
+			res.Archived++
+		}
+		ids = append(ids, m.MongoID)
+		if len(ids) < deleteBatch {
+			return nil
+		}
+		return flush()
+	})
+	if err != nil {
+		return res, err
+	}
+	return res, flush()
+}
+
+// extendLock keeps the lock while a long sweep runs; a lost lock stops the sweep.
+func (s *Sweeper) extendLock(ctx context.Context) error {
+	if s.cache == nil {
+		return nil
+	}
+	ok, err := s.cache.ExtendLock(ctx, lockKey, s.instance, lockTTL)
+	if err != nil {
+		return fmt.Errorf("extend lock: %w", err)
+	}
+	if !ok {
+		return ErrLockLost
+	}
+	return nil
+}
+
+// archiveFile is a gzipped JSONL file in the archive directory.
+type archiveFile struct {
+	path string
+	f    *os.File
+	zw   *gzip.Writer
+	enc  *json.Encoder
+}
+
+// createArchive creates <dir>/<chat type>-<before>.jsonl.gz.
+func (s *Sweeper) createArchive(chatType models.ChatType, before time.Time) (*archiveFile, error) {
+	if err := os.MkdirAll(s.cfg.ArchiveDir, 0o755); err != nil {
+		return nil, fmt.Errorf("archive dir: %w", err)
+	}
+	path := filepath.Join(s.cfg.ArchiveDir, fmt.Sprintf("%s-%s.jsonl.gz", chatType, before.Format("20060102T150405Z")))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0o640)
+	if err != nil {
+		return nil, fmt.Errorf("archive: %w", err)
+	}
+	zw := gzip.NewWriter(f)
+	return &archiveFile{path: path, f: f, zw: zw, enc: json.NewEncoder(zw)}, nil
+}
+
+// sync flushes what was encoded so far to disk.
+func (a *archiveFile) sync() error {
+	if err := a.zw.Flush(); err != nil {
+		return fmt.Errorf("archive %s: %w", a.path, err)
+	}
+	if err := a.f.Sync(); err != nil {
+		return fmt.Errorf("archive %s: %w", a.path, err)
+	}
+	return nil
+}
+
+// close completes the file, or removes it when empty. A file is kept even after
+// an error: the batches synced before it may already be deleted.
+func (a *archiveFile) close(empty bool) error {
+	if empty {
+		_ = a.f.Close()
+		_ = os.Remove(a.path)
+		return nil
+	}
+	err := a.zw.Close()
+	if serr := a.f.Sync(); err == nil {
+		err = serr
+	}
+	if cerr := a.f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("archive %s: %w", a.path, err)
+	}
+	return nil
+}
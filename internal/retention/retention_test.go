@@ -0,0 +1,153 @@
+package retention
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/frangi01/bbtelgo/internal/config"
+	"github.com/frangi01/bbtelgo/internal/entities"
+	"github.com/frangi01/bbtelgo/internal/logx"
+	"github.com/frangi01/bbtelgo/internal/repo"
+	"github.com/go-telegram/bot/models"
+)
+
+func newTestSweeper(t *testing.T, messages repo.MessageStore, archiveDir string) *Sweeper {
+	t.Helper()
+	logger, err := logx.New(filepath.Join(t.TempDir(), "test.log"), logx.Options{})
+	if err != nil {
+		t.Fatalf("logger: %v", err)
+	}
+	t.Cleanup(func() { _ = logger.Close() })
+	return New(messages, nil, logger, config.RetentionCfg{
+		Policies:   map[string]time.Duration{string(models.ChatTypePrivate): 24 * time.Hour},
+		ArchiveDir: archiveDir,
+	})
+}
+
+func addMessage(t *testing.T, messages repo.MessageStore, chatType models.ChatType, id int, age time.Duration) {
+	t.Helper()
+	m := &entities.MessageEntity{Message: models.Message{
+		ID:   id,
+		Chat: models.Chat{ID: 1, Type: chatType},
+		Date: int(time.Now().Add(-age).Unix()),
+	}}
+	if _, err := messages.Create(context.Background(), m); err != nil {
+		t.Fatalf("create message: %v", err)
+	}
+}
+
+func readArchive(t *testing.T, path string) []int {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open archive: %v", err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("archive is not gzipped: %v", err)
+	}
+	var ids []int
+	dec := json.NewDecoder(zr)
+	for {
+		var m entities.MessageEntity
+		if err := dec.Decode(&m); errors.Is(err, io.EOF) {
+			return ids
+		} else if err != nil {
+			t.Fatalf("decode archive: %v", err)
+		}
+		ids = append(ids, m.ID)
+	}
+}
+
+func TestSweep(t *testing.T) {
+	messages := repo.NewMemoryMessageRepository()
+	total := 2*deleteBatch + 7 // more than one batch
+	for id := 1; id <= total; id++ {
+		addMessage(t, messages, models.ChatTypePrivate, id, 48*time.Hour)
+	}
+	addMessage(t, messages, models.ChatTypePrivate, total+1, time.Hour)
+	addMessage(t, messages, models.ChatTypeGroup, total+2, 48*time.Hour) // no policy
+
+	dir := t.TempDir()
+	results, err := newTestSweeper(t, messages, dir).Sweep(context.Background())
+	if err != nil {
+		t.Fatalf("sweep: %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("results = %+v, want one per policy", results)
+	}
+	res := results[0]
+	if res.Deleted != int64(total) || res.Archived != int64(total) || res.Archive == "" {
+		t.Fatalf("result = %+v, want %d archived and deleted", res, total)
+	}
+	if ids := readArchive(t, res.Archive); len(ids) != total || ids[0] != 1 || ids[total-1] != total {
+		t.Fatalf("archive holds %d messages, want %d", len(ids), total)
+	}
+
+	for _, id := range []int{total + 1, total + 2} {
+		if _, err := messages.FindByChatAndMessageID(context.Background(), 1, id); err != nil {
+			t.Errorf("message %d outside the policy: %v", id, err)
+		}
+	}
+	if _, err := messages.FindByChatAndMessageID(context.Background(), 1, 1); !errors.Is(err, repo.MessageErrNotFound) {
+		t.Errorf("swept message: %v, want MessageErrNotFound", err)
+	}
+}
+
+func TestSweepNothingToArchive(t *testing.T) {
+	messages := repo.NewMemoryMessageRepository()
+	addMessage(t, messages, models.ChatTypePrivate, 1, time.Hour)
+
+	dir := t.TempDir()
+	results, err := newTestSweeper(t, messages, dir).Sweep(context.Background())
+	if err != nil {
+		t.Fatalf("sweep: %v", err)
+	}
+	if res := results[0]; res.Deleted != 0 || res.Archive != "" {
+		t.Fatalf("result = %+v, want nothing swept", res)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("archive dir holds %d files, want none", len(entries))
+	}
+}
+
+// lateStore stores one more expired message once the sweep has started reading.
+type lateStore struct {
+	*repo.MemoryMessageRepository
+	t *testing.T
+}
+
+func (s lateStore) Iterate(ctx context.Context, f repo.MessageFilter, fn func(m *entities.MessageEntity) error) error {
+	late := false
+	return s.MemoryMessageRepository.Iterate(ctx, f, func(m *entities.MessageEntity) error {
+		if !late {
+			late = true
+			addMessage(s.t, s.MemoryMessageRepository, models.ChatTypePrivate, 100, 48*time.Hour)
+		}
+		return fn(m)
+	})
+}
+
+func TestSweepDeletesOnlyArchived(t *testing.T) {
+	messages := repo.NewMemoryMessageRepository()
+	addMessage(t, messages, models.ChatTypePrivate, 1, 48*time.Hour)
+
+	results, err := newTestSweeper(t, lateStore{messages, t}, t.TempDir()).Sweep(context.Background())
+	if err != nil {
+		t.Fatalf("sweep: %v", err)
+	}
+	if res := results[0]; res.Deleted != 1 || res.Archived != 1 {
+		t.Fatalf("result = %+v, want the one archived message deleted", res)
+	}
+	if _, err := messages.FindByChatAndMessageID(context.Background(), 1, 100); err != nil {
+		t.Fatalf("message stored during the sweep: %v, want it kept for the next one", err)
+	}
+}
@@ -0,0 +1,130 @@
+package sender
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/frangi01/bbtelgo/internal/db"
+)
+
+// Bucket is a token bucket: Rate tokens per second, up to Burst accumulated.
+type Bucket struct {
+	Key   string
+	Rate  float64
+	Burst int
+}
+
+// Limiter blocks until one token of the bucket can be spent.
+type Limiter interface {
+	Wait(ctx context.Context, bucket Bucket) error
+}
+
+// --- in-process ---
+
+type memoryBucket struct {
+	tokens float64
+	ts     time.Time
+}
+
+// MemoryLimiter keeps the buckets in process: correct for a single replica.
+type MemoryLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*memoryBucket
+	lastGC  time.Time
+	now     func() time.Time
+}
+
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{buckets: make(map[string]*memoryBucket), lastGC: time.Now(), now: time.Now}
+}
+
+func (l *MemoryLimiter) Wait(ctx context.Context, bucket Bucket) error {
+	for {
+		wait := l.take(bucket)
+		if wait <= 0 {
+			return nil
+		}
+		if err := sleep(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+func (l *MemoryLimiter) take(bucket Bucket) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.gc(now)
+
+	mb, ok := l.buckets[bucket.Key]
+	if !ok {
+		mb = &memoryBucket{tokens: float64(bucket.Burst), ts: now}
+		l.buckets[bucket.Key] = mb
+	}
+	mb.tokens = math.Min(float64(bucket.Burst), mb.tokens+now.Sub(mb.ts).Seconds()*bucket.Rate)
+	mb.ts = now
+
+	if mb.tokens >= 1 {
+		mb.tokens--
+		return 0
+	}
+	return time.Duration((1 - mb.tokens) / bucket.Rate * float64(time.Second))
+}
+
+// gc drops the buckets idle for a while (a full bucket is the same as no bucket).
+func (l *MemoryLimiter) gc(now time.Time) {
+	if now.Sub(l.lastGC) < time.Minute {
+		return
+	}
+	l.lastGC = now
+	for k, mb := range l.buckets {
+		if now.Sub(mb.ts) > 5*time.Minute {
+			delete(l.buckets, k)
+		}
+	}
+}
+
+// --- Redis ---
+
+// RedisLimiter keeps the buckets in Redis, so every replica shares the same budget.
+// While Redis fails it falls back to in-process buckets rather than blocking sends.
+type RedisLimiter struct {
+	cache    *db.CacheClient
+	fallback *MemoryLimiter
+}
+
+func NewRedisLimiter(cache *db.CacheClient) *RedisLimiter {
+	return &RedisLimiter{cache: cache, fallback: NewMemoryLimiter()}
+}
+
+func (l *RedisLimiter) Wait(ctx context.Context, bucket Bucket) error {
+	for {
+		wait, err := l.cache.TakeToken(ctx, "sender:"+bucket.Key, bucket.Rate, bucket.Burst)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return l.fallback.Wait(ctx, bucket)
+		}
+		if wait <= 0 {
+			return nil
+		}
+		if err := sleep(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,308 @@
+package sender
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/frangi01/bbtelgo/internal/db"
+	"github.com/frangi01/bbtelgo/internal/logx"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// Priority lane of an outgoing call: when the global budget is short, higher lanes go first.
+type Priority int
+
+const (
+	PriorityLow    Priority = iota // bulk (broadcasts)
+	PriorityNormal                 // notifications
+	PriorityHigh                   // replies to the user
+)
+
+// Telegram flood limits
+const (
+	DefaultGlobalRate = 30.0      // msg/s across all chats
+	DefaultChatRate   = 1.0       // msg/s in the same private chat
+	DefaultGroupRate  = 20.0 / 60 // msg/s in the same group (20/min)
+	DefaultMaxRetries = 3
+)
+
+type Options struct {
+	GlobalRate float64
+	ChatRate   float64
+	GroupRate  float64
+	MaxRetries int // retries after a 429, waiting its retry_after
+}
+
+type ticket struct {
+	ready chan struct{}
+}
+
+// Sender throttles outgoing Bot API calls with a global and per-chat token buckets.
+type Sender struct {
+	limiter Limiter
+	logger  *logx.Logger
+	opts    Options
+
+	lanes     [PriorityHigh + 1]chan *ticket
+	stop      chan struct{}
+	closeOnce sync.Once
+
+	hookMu sync.RWMutex
+	hooks  []Hook
+}
+
+// Hook observes every message sent or edited through the sender (e.g. to store a transcript).
+type Hook func(ctx context.Context, msg *models.Message)
+
+// New starts the scheduler; call Close to stop it.
+func New(limiter Limiter, logger *logx.Logger, opts Options) *Sender {
+	if opts.GlobalRate <= 0 {
+		opts.GlobalRate = DefaultGlobalRate
+	}
+	if opts.ChatRate <= 0 {
+		opts.ChatRate = DefaultChatRate
+	}
+	if opts.GroupRate <= 0 {
+		opts.GroupRate = DefaultGroupRate
+	}
+	if opts.MaxRetries < 0 {
+		opts.MaxRetries = 0
+	} else if opts.MaxRetries == 0 {
+		opts.MaxRetries = DefaultMaxRetries
+	}
+
+	s := &Sender{limiter: limiter, logger: logger, opts: opts, stop: make(chan struct{})}
+	for i := range s.lanes {
+		s.lanes[i] = make(chan *ticket)
+	}
+	go s.schedule()
+	return s
+}
+
+// NewDefault uses the Redis limiter when cache is available, the in-process one otherwise.
+func NewDefault(cache *db.CacheClient, logger *logx.Logger) *Sender {
+	var limiter Limiter = NewMemoryLimiter()
+	if cache != nil {
+		limiter = NewRedisLimiter(cache)
+	}
+	return New(limiter, logger, Options{})
+}
+
+// OnSent registers a hook called after every successful send/edit.
+func (s *Sender) OnSent(h Hook) {
+	if h == nil {
+		return
+	}
+	s.hookMu.Lock()
+	defer s.hookMu.Unlock()
+	s.hooks = append(s.hooks, h)
+}
+
+func (s *Sender) sent(ctx context.Context, msg *models.Message, err error) (*models.Message, error) {
+	if err != nil || msg == nil {
+		return msg, err
+	}
+	s.hookMu.RLock()
+	hooks := s.hooks
+	s.hookMu.RUnlock()
+	for _, h := range hooks {
+		h(ctx, msg)
+	}
+	return msg, nil
+}
+
+func (s *Sender) Close() {
+	s.closeOnce.Do(func() { close(s.stop) })
+}
+
+// schedule hands out the global tokens, preferring the higher lanes.
+func (s *Sender) schedule() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-s.stop
+		cancel()
+	}()
+
+	global := Bucket{Key: "global", Rate: s.opts.GlobalRate, Burst: 1}
+	for {
+		t := s.next()
+		if t == nil {
+			return
+		}
+		if err := s.limiter.Wait(ctx, global); err != nil {
+			return
+		}
+		close(t.ready)
+	}
+}
+
+func (s *Sender) next() *ticket {
+	for p := PriorityHigh; p > PriorityLow; p-- {
+		select {
+		case t := <-s.lanes[p]:
+			return t
+		default:
+		}
+	}
+	select {
+	case t := <-s.lanes[PriorityHigh]:
+		return t
+	case t := <-s.lanes[PriorityNormal]:
+		return t
+	case t := <-s.lanes[PriorityLow]:
+		return t
+	case <-s.stop:
+		return nil
+	}
+}
+
+var ErrClosed = errors.New("sender: closed")
+
+// acquire waits for the buckets of the chat, then for a global token in lane p.
+func (s *Sender) acquire(ctx context.Context, chatID any, p Priority) error {
+	for _, b := range s.chatBuckets(chatID) {
+		if err := s.limiter.Wait(ctx, b); err != nil {
+			return err
+		}
+	}
+
+	t := &ticket{ready: make(chan struct{})}
+	select {
+	case s.lanes[p] <- t:
+	case <-s.stop:
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-t.ready:
+		return nil
+	case <-s.stop:
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Sender) chatBuckets(chatID any) []Bucket {
+	switch id := chatID.(type) {
+	case int64:
+		return s.bucketsFor(fmt.Sprint(id), id < 0)
+	case int:
+		return s.bucketsFor(fmt.Sprint(id), id < 0)
+	case string:
+		// "@channelusername"
+		if id != "" {
+			return s.bucketsFor(id, true)
+		}
+	}
+	return nil
+}
+
+// bucketsFor: every chat gets one message per second; groups also one every
+// 1/GroupRate seconds, with no burst (at most 20 a minute at the default rate).
+func (s *Sender) bucketsFor(key string, group bool) []Bucket {
+	buckets := []Bucket{{Key: "chat:" + key, Rate: s.opts.ChatRate, Burst: 1}}
+	if group {
+		buckets = append(buckets, Bucket{Key: "group:" + key, Rate: s.opts.GroupRate, Burst: 1})
+	}
+	return buckets
+}
+
+// Do runs call (a Bot API request to chatID) within the flood limits, retrying
+// after 429 responses as many times as Options.MaxRetries.
+func Do[T any](ctx context.Context, s *Sender, chatID any, p Priority, call func(ctx context.Context) (T, error)) (T, error) {
+	var zero T
+	for attempt := 0; ; attempt++ {
+		if err := s.acquire(ctx, chatID, p); err != nil {
+			return zero, err
+		}
+		v, err := call(ctx)
+
+		var tooMany *bot.TooManyRequestsError
+		if !errors.As(err, &tooMany) || attempt >= s.opts.MaxRetries {
+			return v, err
+		}
+		retryAfter := time.Duration(tooMany.RetryAfter) * time.Second
+		s.logger.Warnf("sender: 429 for chat %v, retry %d in %s", chatID, attempt+1, retryAfter)
+		if err := sleep(ctx, retryAfter); err != nil {
+			return zero, err
+		}
+	}
+}
+
+// Every call has two forms: X sends in the high lane (replies to the user),
+// XWithPriority in lane p.
+
+func (s *Sender) SendMessage(ctx context.Context, b *bot.Bot, params *bot.SendMessageParams) (*models.Message, error) {
+	return s.SendMessageWithPriority(ctx, b, params, PriorityHigh)
+}
+
+func (s *Sender) SendMessageWithPriority(ctx context.Context, b *bot.Bot, params *bot.SendMessageParams, p Priority) (*models.Message, error) {
+	msg, err := Do(ctx, s, params.ChatID, p, func(ctx context.Context) (*models.Message, error) {
+		return b.SendMessage(ctx, params)
+	})
+	return s.sent(ctx, msg, err)
+}
+
+func (s *Sender) SendPhoto(ctx context.Context, b *bot.Bot, params *bot.SendPhotoParams) (*models.Message, error) {
+	return s.SendPhotoWithPriority(ctx, b, params, PriorityHigh)
+}
+
+func (s *Sender) SendPhotoWithPriority(ctx context.Context, b *bot.Bot, params *bot.SendPhotoParams, p Priority) (*models.Message, error) {
+	msg, err := Do(ctx, s, params.ChatID, p, func(ctx context.Context) (*models.Message, error) {
+		if err := rewind(params.Photo); err != nil {
+			return nil, err
+		}
+		return b.SendPhoto(ctx, params)
+	})
+	return s.sent(ctx, msg, err)
+}
+
+func (s *Sender) SendDocument(ctx context.Context, b *bot.Bot, params *bot.SendDocumentParams) (*models.Message, error) {
+	return s.SendDocumentWithPriority(ctx, b, params, PriorityHigh)
+}
+
+func (s *Sender) SendDocumentWithPriority(ctx context.Context, b *bot.Bot, params *bot.SendDocumentParams, p Priority) (*models.Message, error) {
+	msg, err := Do(ctx, s, params.ChatID, p, func(ctx context.Context) (*models.Message, error) {
+		if err := rewind(params.Document); err != nil {
+			return nil, err
+		}
+		return b.SendDocument(ctx, params)
+	})
+	return s.sent(ctx, msg, err)
+}
+
+var ErrUploadNotSeekable = errors.New("sender: upload data must be an io.ReadSeeker")
+
+// rewind moves an uploaded file back to its start, so a retry after a 429 sends it whole;
+// uploads must be seekable (bytes.Reader, os.File...).
+func rewind(f models.InputFile) error {
+	upload, ok := f.(*models.InputFileUpload)
+	if !ok || upload.Data == nil {
+		return nil
+	}
+	seeker, ok := upload.Data.(io.Seeker)
+	if !ok {
+		return ErrUploadNotSeekable
+	}
+	_, err := seeker.Seek(0, io.SeekStart)
+	return err
+}
+
+func (s *Sender) EditMessageText(ctx context.Context, b *bot.Bot, params *bot.EditMessageTextParams) (*models.Message, error) {
+	return s.EditMessageTextWithPriority(ctx, b, params, PriorityHigh)
+}
+
+func (s *Sender) EditMessageTextWithPriority(ctx context.Context, b *bot.Bot, params *bot.EditMessageTextParams, p Priority) (*models.Message, error) {
+	msg, err := Do(ctx, s, params.ChatID, p, func(ctx context.Context) (*models.Message, error) {
+		return b.EditMessageText(ctx, params)
+	})
+	return s.sent(ctx, msg, err)
+}
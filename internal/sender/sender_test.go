@@ -0,0 +1,95 @@
+package sender
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot/models"
+)
+
+// sendsPerMinute counts the sends to chatID that a fresh MemoryLimiter lets through
+// in one minute of simulated time, spending the buckets the way acquire does.
+func sendsPerMinute(t *testing.T, s *Sender, chatID any) int {
+	t.Helper()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := start
+	l := NewMemoryLimiter()
+	l.now = func() time.Time { return clock }
+
+	sends := 0
+	for {
+		for _, b := range s.chatBuckets(chatID) {
+			for wait := l.take(b); wait > 0; wait = l.take(b) {
+				clock = clock.Add(wait)
+			}
+		}
+		if clock.Sub(start) >= time.Minute {
+			return sends
+		}
+		sends++
+	}
+}
+
+func TestChatBucketsPerMinute(t *testing.T) {
+	s := &Sender{opts: Options{ChatRate: DefaultChatRate, GroupRate: DefaultGroupRate}}
+
+	tests := []struct {
+		name   string
+		chatID any
+		want   int
+	}{
+		{"private", int64(42), 60},
+		{"group", int64(-100123), 20},
+		{"group int", -100123, 20},
+		{"channel username", "@channel", 20},
+	}
+	for _, tt := range tests {
+		if got := sendsPerMinute(t, s, tt.chatID); got != tt.want {
+			t.Errorf("%s: %d sends in a minute, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestChatBucketsGroupKeepsChatRate(t *testing.T) {
+	// a group allowance above the per-chat one is still capped at 1 msg/s
+	s := &Sender{opts: Options{ChatRate: DefaultChatRate, GroupRate: 2}}
+	if got := sendsPerMinute(t, s, int64(-100123)); got != 60 {
+		t.Fatalf("%d sends in a minute, want 60", got)
+	}
+}
+
+func TestChatBucketsUnknownChat(t *testing.T) {
+	s := &Sender{opts: Options{ChatRate: DefaultChatRate, GroupRate: DefaultGroupRate}}
+	if b := s.chatBuckets(""); len(b) != 0 {
+		t.Fatalf("chatBuckets(\"\") = %v, want none", b)
+	}
+}
+
+func TestRewind(t *testing.T) {
+	data := bytes.NewReader([]byte("payload"))
+	if _, err := io.ReadAll(data); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if err := rewind(&models.InputFileUpload{Filename: "a.txt", Data: data}); err != nil {
+		t.Fatalf("rewind: %v", err)
+	}
+	if got, _ := io.ReadAll(data); string(got) != "payload" {
+		t.Fatalf("after rewind read %q, want the whole payload", got)
+	}
+
+	// a plain reader could not be sent again after a 429
+	notSeekable := &models.InputFileUpload{Filename: "a.txt", Data: io.MultiReader(strings.NewReader("payload"))}
+	if err := rewind(notSeekable); !errors.Is(err, ErrUploadNotSeekable) {
+		t.Fatalf("rewind of a plain reader = %v, want ErrUploadNotSeekable", err)
+	}
+
+	for _, f := range []models.InputFile{nil, &models.InputFileString{Data: "file-id"}, &models.InputFileUpload{}} {
+		if err := rewind(f); err != nil {
+			t.Errorf("rewind(%#v) = %v, want nil", f, err)
+		}
+	}
+}
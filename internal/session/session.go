@@ -0,0 +1,222 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/frangi01/bbtelgo/internal/db"
+	"github.com/frangi01/bbtelgo/internal/logx"
+	"github.com/frangi01/bbtelgo/internal/utils"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+type Scope string
+
+const (
+	ScopeUser     Scope = "user"      // one session per user, shared across chats
+	ScopeChat     Scope = "chat"      // one session per chat, shared by its members
+	ScopeUserChat Scope = "user-chat" // one session per user in each chat
+)
+
+const DefaultTTL = 24 * time.Hour
+
+type Options struct {
+	TTL   time.Duration // 0 = DefaultTTL
+	Scope Scope         // "" = ScopeUserChat
+}
+
+// Session is a bag of JSON values bound to a user/chat. Safe for concurrent use.
+type Session struct {
+	mu    sync.Mutex
+	key   string
+	data  map[string]json.RawMessage
+	dirty bool
+}
+
+func newSession(key string) *Session {
+	return &Session{key: key, data: map[string]json.RawMessage{}}
+}
+
+// Key returns the Redis key of the session ("" for sessions that are not persisted).
+func (s *Session) Key() string {
+	return s.key
+}
+
+// Set stores v (JSON-encoded) under key.
+func (s *Session) Set(key string, v any) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("session set %s: %w", key, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[key] = raw
+	s.dirty = true
+	return nil
+}
+
+// Delete removes key from the session.
+func (s *Session) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.data[key]; ok {
+		delete(s.data, key)
+		s.dirty = true
+	}
+}
+
+// Clear empties the session.
+func (s *Session) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.data) > 0 {
+		s.data = map[string]json.RawMessage{}
+		s.dirty = true
+	}
+}
+
+// Has reports whether key is set.
+func (s *Session) Has(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.data[key]
+	return ok
+}
+
+// Dirty reports whether the session changed since it was loaded.
+func (s *Session) Dirty() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dirty
+}
+
+func (s *Session) raw(key string) (json.RawMessage, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	raw, ok := s.data[key]
+	return raw, ok
+}
+
+// Get decodes the value stored under key. ok=false if missing or not a T.
+func Get[T any](s *Session, key string) (v T, ok bool) {
+	raw, found := s.raw(key)
+	if !found {
+		return v, false
+	}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return v, false
+	}
+	return v, true
+}
+
+// GetOr is Get with a default for missing values.
+func GetOr[T any](s *Session, key string, def T) T {
+	if v, ok := Get[T](s, key); ok {
+		return v
+	}
+	return def
+}
+
+// --- context ---
+
+type ctxKey struct{}
+
+// FromContext returns the session loaded by the middleware; without the middleware
+// it returns an empty session that is never saved, so handlers need no nil checks.
+func FromContext(ctx context.Context) *Session {
+	if s, ok := ctx.Value(ctxKey{}).(*Session); ok {
+		return s
+	}
+	return newSession("")
+}
+
+func NewContext(ctx context.Context, s *Session) context.Context {
+	return context.WithValue(ctx, ctxKey{}, s)
+}
+
+// --- middleware ---
+
+// KeyFor returns the Redis key of the session for the update, "" if the update has no user/chat for the scope.
+func KeyFor(scope Scope, u *models.Update) string {
+	chatID := utils.ChatIDFromUpdate(u)
+	var userID int64
+	if from := utils.SenderFromUpdate(u); from != nil {
+		userID = from.ID
+	}
+
+	switch scope {
+	case ScopeUser:
+		if userID != 0 {
+			return fmt.Sprintf("sess:user:%d", userID)
+		}
+	case ScopeChat:
+		if chatID != 0 {
+			return fmt.Sprintf("sess:chat:%d", chatID)
+		}
+	default:
+		if userID != 0 && chatID != 0 {
+			return fmt.Sprintf("sess:%d:%d", chatID, userID)
+		}
+	}
+	return ""
+}
+
+// Middleware loads the session from Redis before the handler and saves it back
+// afterwards, only if something changed. Without Redis sessions live for one update.
+func Middleware(cache *db.CacheClient, logger *logx.Logger, opts Options) func(next bot.HandlerFunc) bot.HandlerFunc {
+	if opts.TTL <= 0 {
+		opts.TTL = DefaultTTL
+	}
+	if opts.Scope == "" {
+		opts.Scope = ScopeUserChat
+	}
+
+	return func(next bot.HandlerFunc) bot.HandlerFunc {
+		return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+			key := KeyFor(opts.Scope, update)
+			if cache == nil || key == "" {
+				next(NewContext(ctx, newSession("")), b, update)
+				return
+			}
+
+			s := newSession(key)
+			if _, err := cache.GetJSON(ctx, key, &s.data); err != nil {
+				logger.Errorf("session load %s: %v", key, err)
+				s.data = map[string]json.RawMessage{}
+			}
+			if s.data == nil {
+				s.data = map[string]json.RawMessage{}
+			}
+
+			next(NewContext(ctx, s), b, update)
+
+			if !s.Dirty() {
+				return
+			}
+			if err := Save(ctx, cache, s, opts.TTL); err != nil {
+				logger.Errorf("session save %s: %v", key, err)
+			}
+		}
+	}
+}
+
+// Save writes s to Redis (an empty session deletes the key).
+func Save(ctx context.Context, cache *db.CacheClient, s *Session, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.key == "" {
+		return nil
+	}
+	if len(s.data) == 0 {
+		_, err := cache.Delete(ctx, s.key)
+		s.dirty = err != nil
+		return err
+	}
+	err := cache.SetJSON(ctx, s.key, s.data, ttl)
+	s.dirty = err != nil
+	return err
+}
@@ -0,0 +1,78 @@
+package session
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-telegram/bot/models"
+)
+
+func TestSessionValues(t *testing.T) {
+	s := newSession("sess:1:1")
+	if s.Dirty() {
+		t.Fatal("new session is dirty")
+	}
+	if err := s.Set("count", 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set("name", "ada"); err != nil {
+		t.Fatal(err)
+	}
+	if !s.Dirty() {
+		t.Fatal("session not dirty after Set")
+	}
+
+	if v, ok := Get[int](s, "count"); !ok || v != 3 {
+		t.Errorf("Get[int](count) = %v, %v", v, ok)
+	}
+	if _, ok := Get[int](s, "name"); ok {
+		t.Error("Get[int](name) succeeded on a string")
+	}
+	if v := GetOr(s, "missing", "def"); v != "def" {
+		t.Errorf("GetOr(missing) = %q, want def", v)
+	}
+
+	s.Delete("count")
+	if s.Has("count") || !s.Has("name") {
+		t.Error("Delete removed the wrong keys")
+	}
+	s.Clear()
+	if s.Has("name") {
+		t.Error("Clear kept the values")
+	}
+}
+
+func TestFromContextWithoutMiddleware(t *testing.T) {
+	s := FromContext(context.Background())
+	if s == nil || s.Key() != "" {
+		t.Fatalf("FromContext = %+v, want an unsaved empty session", s)
+	}
+	loaded := newSession("sess:1:1")
+	if got := FromContext(NewContext(context.Background(), loaded)); got != loaded {
+		t.Fatal("FromContext did not return the stored session")
+	}
+}
+
+func TestKeyFor(t *testing.T) {
+	private := &models.Update{Message: &models.Message{Chat: models.Chat{ID: 10}, From: &models.User{ID: 7}}}
+	channel := &models.Update{ChannelPost: &models.Message{Chat: models.Chat{ID: -100}}}
+
+	tests := []struct {
+		scope Scope
+		u     *models.Update
+		want  string
+	}{
+		{ScopeUser, private, "sess:user:7"},
+		{ScopeChat, private, "sess:chat:10"},
+		{ScopeUserChat, private, "sess:10:7"},
+		{"", private, "sess:10:7"},
+		{ScopeChat, channel, "sess:chat:-100"},
+		{ScopeUser, channel, ""},
+		{ScopeUserChat, channel, ""},
+	}
+	for _, tt := range tests {
+		if got := KeyFor(tt.scope, tt.u); got != tt.want {
+			t.Errorf("KeyFor(%q) = %q, want %q", tt.scope, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package transcript
+
+import (
+	"context"
+	"slices"
+
+	"github.com/frangi01/bbtelgo/internal/entities"
+	"github.com/frangi01/bbtelgo/internal/logx"
+	"github.com/frangi01/bbtelgo/internal/repo"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// Recorder stores incoming and outgoing messages of the enabled chat types in a MessageStore.
+type Recorder struct {
+	messages  repo.MessageStore
+	logger    *logx.Logger
+	chatTypes []models.ChatType
+}
+
+// New: chatTypes are the chats to record (private, group, supergroup, channel).
+func New(messages repo.MessageStore, logger *logx.Logger, chatTypes ...models.ChatType) *Recorder {
+	return &Recorder{messages: messages, logger: logger, chatTypes: chatTypes}
+}
+
+// Enabled reports whether messages of chat type t are recorded.
+func (r *Recorder) Enabled(t models.ChatType) bool {
+	return slices.Contains(r.chatTypes, t)
+}
+
+// Record upserts msg with its direction; edits overwrite the stored message.
+// Failures are logged only: the transcript must never break the bot.
+func (r *Recorder) Record(ctx context.Context, msg *models.Message, dir entities.MessageDirection) {
+	if msg == nil || !r.Enabled(msg.Chat.Type) {
+		return
+	}
+	m := &entities.MessageEntity{Message: *msg, Direction: dir}
+	if _, _, err := r.messages.UpsertByChatAndMessageID(ctx, m); err != nil {
+		r.logger.Errorf("transcript: store message %d of chat %d: %v", msg.ID, msg.Chat.ID, err)
+	}
+}
+
+// Outgoing is a sender.Hook recording the messages sent by the bot.
+func (r *Recorder) Outgoing(ctx context.Context, msg *models.Message) {
+	r.Record(ctx, msg, entities.DirectionOut)
+}
+
+// Middleware records the incoming (and edited) messages and channel posts before handling them.
+func (r *Recorder) Middleware() func(next bot.HandlerFunc) bot.HandlerFunc {
+	return func(next bot.HandlerFunc) bot.HandlerFunc {
+		return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+			for _, msg := range []*models.Message{update.Message, update.EditedMessage, update.ChannelPost, update.EditedChannelPost} {
+				r.Record(ctx, msg, entities.DirectionIn)
+			}
+			next(ctx, b, update)
+		}
+	}
+}
@@ -2,12 +2,26 @@ package utils
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
 
+	"github.com/frangi01/bbtelgo/internal/broadcast"
+	"github.com/frangi01/bbtelgo/internal/callback"
 	"github.com/frangi01/bbtelgo/internal/config"
+	"github.com/frangi01/bbtelgo/internal/conversation"
 	"github.com/frangi01/bbtelgo/internal/db"
+	"github.com/frangi01/bbtelgo/internal/gdpr"
 	"github.com/frangi01/bbtelgo/internal/i18n"
 	"github.com/frangi01/bbtelgo/internal/logx"
+	"github.com/frangi01/bbtelgo/internal/rbac"
+	"github.com/frangi01/bbtelgo/internal/repo"
+	"github.com/frangi01/bbtelgo/internal/retention"
+	"github.com/frangi01/bbtelgo/internal/sender"
+	"github.com/frangi01/bbtelgo/internal/transcript"
+	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
 )
 
@@ -32,6 +46,17 @@ type HandlerDeps struct {
 	RepositoryList 	*db.RepositoryList
 	Cache          	*db.CacheClient
 	I18n			*i18n.Bundle
+	Conversations	conversation.Store
+	Callbacks		*callback.Codec
+	Sender			*sender.Sender
+	Broadcast		*broadcast.Service
+	Transcript		*transcript.Recorder // nil when message persistence is off
+	Access			*rbac.Access
+	GDPR			*gdpr.Service // nil without repositories
+	Retention		*retention.Sweeper // nil when no retention policy is configured
+
+	botMu			sync.Mutex
+	botUsername		string
 }
 
 func NewDeps(
@@ -41,22 +66,239 @@ func NewDeps(
 	cache *db.CacheClient,
 	i18n *i18n.Bundle,
 ) *HandlerDeps {
+	snd := sender.NewDefault(cache, logger)
+
+	var conversations conversation.Store
+	var campaigns *broadcast.Service
+	var recorder *transcript.Recorder
+	var users repo.UserStore
+	var audit *repo.AuditRepository
+	var privacy *gdpr.Service
+	var sweeper *retention.Sweeper
+	if repositoryList != nil {
+		privacy = gdpr.New(repositoryList, cache, logger)
+		if len(cfg.Retention.Policies) > 0 && repositoryList.MessageRepository != nil {
+			sweeper = retention.New(repositoryList.MessageRepository, cache, logger, cfg.Retention)
+		}
+		users, audit = repositoryList.UserRepository, repositoryList.AuditRepository
+		if len(cfg.PersistChatTypes) > 0 && repositoryList.MessageRepository != nil {
+			chatTypes := make([]models.ChatType, 0, len(cfg.PersistChatTypes))
+			for _, t := range cfg.PersistChatTypes {
+				chatTypes = append(chatTypes, models.ChatType(t))
+			}
+			recorder = transcript.New(repositoryList.MessageRepository, logger, chatTypes...)
+			snd.OnSent(recorder.Outgoing)
+		}
+		conversations = conversation.NewStore(cache, repositoryList.ConversationRepository, logger)
+		if repositoryList.CampaignRepository != nil && repositoryList.DeliveryRepository != nil && repositoryList.UserRepository != nil {
+			campaigns = broadcast.New(repositoryList.CampaignRepository, repositoryList.DeliveryRepository, repositoryList.UserRepository, cache, snd, logger, broadcast.Options{})
+		}
+	}
+
 	return &HandlerDeps{
 		Logger:         logger,
 		Cfg:            cfg,
 		RepositoryList: repositoryList,
 		Cache:          cache,
 		I18n: i18n,
+		Conversations: conversations,
+		Callbacks: callback.NewCodec(cfg.CallbackSecret, cache, cfg.CallbackTTL),
+		Sender: snd,
+		Broadcast: campaigns,
+		Transcript: recorder,
+		Access: rbac.New(users, cache, audit, logger, cfg.AdminIDs, nil),
+		GDPR: privacy,
+		Retention: sweeper,
 	}
 }
 
+// Authorize checks rule for the sender of u. Denials are audited and, for messages,
+// answered with the localized "access.denied" (callback queries are answered by the caller).
+func (d *HandlerDeps) Authorize(ctx context.Context, b *bot.Bot, u *models.Update, action string, rule rbac.Rule, lang string) (bool, error) {
+	if rule.Public() {
+		return true, nil
+	}
+	var userID int64
+	if from := SenderFromUpdate(u); from != nil {
+		userID = from.ID
+	}
+	chatID := ChatIDFromUpdate(u)
+
+	allowed, err := d.Access.Authorize(ctx, userID, chatID, action, rule)
+	if err != nil || allowed {
+		return allowed, err
+	}
+	if u.Message != nil {
+		_, err = d.Sender.SendMessage(ctx, b, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   d.I18n.T(lang, "access.denied", nil),
+		})
+	}
+	return false, err
+}
+
+type langKey struct{}
+
+// WithLang stores the preferred language of the sender of the update in ctx
+// (see handlers.LanguageMiddleware), so Lang does not look it up again.
+func WithLang(ctx context.Context, lang string) context.Context {
+	return context.WithValue(ctx, langKey{}, lang)
+}
+
+// Lang returns the language to answer from in: the preferred one stored for the user
+// (UserEntity.Language) or else the one of the Telegram client, matched against the bundle.
+func (d *HandlerDeps) Lang(ctx context.Context, from *models.User) string {
+	if from == nil {
+		return d.I18n.BestLang("")
+	}
+	preferred, ok := ctx.Value(langKey{}).(string)
+	if !ok && d.Access != nil && !from.IsBot {
+		var err error
+		if preferred, err = d.Access.Language(ctx, from.ID); err != nil {
+			d.Logger.Errorf("language %d: %v", from.ID, err)
+		}
+	}
+	if preferred != "" {
+		return d.I18n.BestLang(preferred)
+	}
+	return d.I18n.BestLang(from.LanguageCode)
+}
+
+// SetBotUsername stores the bot username (without "@"), known from the getMe of the startup.
+func (d *HandlerDeps) SetBotUsername(username string) {
+	d.botMu.Lock()
+	defer d.botMu.Unlock()
+	d.botUsername = username
+}
+
+// BotUsername returns the bot username (without "@"). It is set at startup; otherwise it is
+// fetched with getMe, outside the lock so a slow call doesn't hold up the other updates.
+func (d *HandlerDeps) BotUsername(ctx context.Context, b *bot.Bot) string {
+	d.botMu.Lock()
+	username := d.botUsername
+	d.botMu.Unlock()
+	if username != "" {
+		return username
+	}
+
+	me, err := b.GetMe(ctx)
+	if err != nil {
+		d.Logger.Errorf("getMe: %v", err)
+		return ""
+	}
+	d.SetBotUsername(me.Username)
+	return me.Username
+}
 
 func ChatIDFromUpdate(u *models.Update) int64 {
 	if u.Message != nil {
 		return u.Message.Chat.ID
 	}
+	if u.EditedMessage != nil {
+		return u.EditedMessage.Chat.ID
+	}
+	if u.ChannelPost != nil {
+		return u.ChannelPost.Chat.ID
+	}
+	if u.EditedChannelPost != nil {
+		return u.EditedChannelPost.Chat.ID
+	}
+	if u.MyChatMember != nil {
+		return u.MyChatMember.Chat.ID
+	}
+	if u.ChatMember != nil {
+		return u.ChatMember.Chat.ID
+	}
+	if u.ChatJoinRequest != nil {
+		return u.ChatJoinRequest.Chat.ID
+	}
+	if u.MessageReaction != nil {
+		return u.MessageReaction.Chat.ID
+	}
 	if u.CallbackQuery != nil {
-		return u.CallbackQuery.Message.Message.Chat.ID
+		if chat := CallbackChat(u.CallbackQuery); chat != nil {
+			return chat.ID
+		}
 	}
 	return 0
 }
+
+// RateLimitKey is the rate-limit key of a chat (see handlers.RateLimitMiddleware).
+func RateLimitKey(chatID int64) string {
+	return fmt.Sprintf("rl:user:%d:msg", chatID)
+}
+
+// ResetRateLimit clears the rate-limit counters of a chat, whatever the window type.
+func (d *HandlerDeps) ResetRateLimit(ctx context.Context, chatID int64) error {
+	if d.Cache == nil {
+		return nil
+	}
+	key := RateLimitKey(chatID)
+	// fixed window: "rl:<key>:<window start>", sliding window: "rl:sw:<key>"
+	if _, err := d.Cache.DeleteByPrefix(ctx, "rl:"+key+":", 100); err != nil {
+		return err
+	}
+	_, err := d.Cache.Delete(ctx, "rl:sw:"+key)
+	return err
+}
+
+// SenderFromUpdate returns the user who originated the update (nil for channel posts and the like).
+func SenderFromUpdate(u *models.Update) *models.User {
+	switch {
+	case u.Message != nil:
+		return u.Message.From
+	case u.EditedMessage != nil:
+		return u.EditedMessage.From
+	case u.CallbackQuery != nil:
+		return &u.CallbackQuery.From
+	case u.InlineQuery != nil:
+		return u.InlineQuery.From
+	case u.ChosenInlineResult != nil:
+		return &u.ChosenInlineResult.From
+	case u.ShippingQuery != nil:
+		return u.ShippingQuery.From
+	case u.PreCheckoutQuery != nil:
+		return u.PreCheckoutQuery.From
+	case u.PollAnswer != nil:
+		return u.PollAnswer.User
+	case u.MyChatMember != nil:
+		return &u.MyChatMember.From
+	case u.ChatMember != nil:
+		return &u.ChatMember.From
+	case u.ChatJoinRequest != nil:
+		return &u.ChatJoinRequest.From
+	case u.MessageReaction != nil:
+		return u.MessageReaction.User
+	}
+	return nil
+}
+
+// CallbackChat returns the chat of the message the button belongs to
+// (nil for buttons on inline messages).
+func CallbackChat(cb *models.CallbackQuery) *models.Chat {
+	switch {
+	case cb.Message.Message != nil:
+		return &cb.Message.Message.Chat
+	case cb.Message.InaccessibleMessage != nil:
+		return &cb.Message.InaccessibleMessage.Chat
+	}
+	return nil
+}
+
+// ParseCommand splits "/cmd@BotName arg1 arg2" into command, addressed bot
+// username (empty if none) and args. cmd is empty when text is not a command.
+func ParseCommand(text string) (cmd string, mention string, args []string) {
+	fields := strings.Fields(strings.TrimSpace(text))
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+		return "", "", nil
+	}
+	cmd = fields[0]
+	args = []string{}
+	if len(fields) > 1 {
+		args = fields[1:]
+	}
+	if i := strings.IndexByte(cmd, '@'); i > 0 {
+		cmd, mention = cmd[:i], cmd[i+1:]
+	}
+	return cmd, mention, args
+}
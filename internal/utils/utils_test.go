@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/frangi01/bbtelgo/internal/entities"
+	"github.com/frangi01/bbtelgo/internal/i18n"
+	"github.com/frangi01/bbtelgo/internal/rbac"
+	"github.com/frangi01/bbtelgo/internal/repo"
+	"github.com/go-telegram/bot/models"
+)
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		text        string
+		wantCmd     string
+		wantMention string
+		wantArgs    []string
+	}{
+		{"/start", "/start", "", []string{}},
+		{"  /start foo  bar ", "/start", "", []string{"foo", "bar"}},
+		{"/start@MyBot foo", "/start", "MyBot", []string{"foo"}},
+		{"hello /start", "", "", nil},
+		{"", "", "", nil},
+	}
+	for _, tt := range tests {
+		cmd, mention, args := ParseCommand(tt.text)
+		if cmd != tt.wantCmd || mention != tt.wantMention || !slices.Equal(args, tt.wantArgs) {
+			t.Errorf("ParseCommand(%q) = (%q, %q, %q), want (%q, %q, %q)", tt.text, cmd, mention, args, tt.wantCmd, tt.wantMention, tt.wantArgs)
+		}
+	}
+}
+
+func TestChatIDFromUpdate(t *testing.T) {
+	tests := []struct {
+		name string
+		u    *models.Update
+		want int64
+	}{
+		{"message", &models.Update{Message: &models.Message{Chat: models.Chat{ID: 1}}}, 1},
+		{"channel post", &models.Update{ChannelPost: &models.Message{Chat: models.Chat{ID: -100}}}, -100},
+		{"callback", &models.Update{CallbackQuery: &models.CallbackQuery{Message: models.MaybeInaccessibleMessage{Message: &models.Message{Chat: models.Chat{ID: 2}}}}}, 2},
+		{"inline callback", &models.Update{CallbackQuery: &models.CallbackQuery{}}, 0},
+		{"empty", &models.Update{}, 0},
+	}
+	for _, tt := range tests {
+		if got := ChatIDFromUpdate(tt.u); got != tt.want {
+			t.Errorf("%s: ChatIDFromUpdate = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBotUsernameSet(t *testing.T) {
+	d := &HandlerDeps{}
+	d.SetBotUsername("MyBot")
+	// set at startup: no getMe (the nil bot would panic)
+	if got := d.BotUsername(context.Background(), nil); got != "MyBot" {
+		t.Fatalf("BotUsername = %q, want MyBot", got)
+	}
+}
+
+func TestLang(t *testing.T) {
+	bundle, err := i18n.Load("../i18n/locales", "en")
+	if err != nil {
+		t.Fatalf("load locales: %v", err)
+	}
+	users := repo.NewMemoryUserRepository()
+	ctx := context.Background()
+	for _, u := range []*entities.UserEntity{
+		{User: models.User{ID: 1, LanguageCode: "en"}, Language: "it"},
+		{User: models.User{ID: 2, LanguageCode: "it"}},
+	} {
+		if _, err := users.Create(ctx, u); err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+	}
+	d := &HandlerDeps{I18n: bundle, Access: rbac.New(users, nil, nil, nil, nil, nil)}
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		from *models.User
+		want string
+	}{
+		{"stored preference", ctx, &models.User{ID: 1, LanguageCode: "en"}, "it"},
+		{"client language", ctx, &models.User{ID: 2, LanguageCode: "it"}, "it"},
+		{"unknown user", ctx, &models.User{ID: 3, LanguageCode: "en-US"}, "en"},
+		{"from the context", WithLang(ctx, "en"), &models.User{ID: 1, LanguageCode: "it"}, "en"},
+		{"no sender", ctx, nil, "en"},
+	}
+	for _, tt := range tests {
+		if got := d.Lang(tt.ctx, tt.from); got != tt.want {
+			t.Errorf("%s: Lang = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}